@@ -2,9 +2,9 @@ package main
 
 import (
 	"embed"
-	"runtime"
 
 	_ "github.com/KubeOperator/kubepi/cmd/server/docs"
+	"github.com/KubeOperator/kubepi/internal/api/v1/cluster"
 	_ "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
 	_ "github.com/KubeOperator/kubepi/internal/model/v1/clusterrepo"
 	_ "github.com/KubeOperator/kubepi/internal/model/v1/docs"
@@ -37,12 +37,6 @@ var embedWebDashboard embed.FS
 //go:embed web/terminal
 var embedWebTerminal embed.FS
 
-//go:embed script/darwin/init-kube.sh
-var webkubectlEntrypointDarwin string
-
-//go:embed script/linux/init-kube.sh
-var webkubectlEntrypointLinux string
-
 //go:embed helper/ip/qqwry.dat
 var IpCommonDictionary []byte
 
@@ -59,12 +53,8 @@ var RootCmd = &cobra.Command{
 		server.EmbedWebDashboard = embedWebDashboard
 		server.EmbedWebTerminal = embedWebTerminal
 		server.EmbedWebKubePi = embedWebKubePi
-		if runtime.GOOS == "darwin" {
-			server.WebkubectlEntrypoint = webkubectlEntrypointDarwin
-		} else {
-			server.WebkubectlEntrypoint = webkubectlEntrypointLinux
-		}
 		ip.IpCommonDictionary = IpCommonDictionary
+		server.RegisterStartupTask(cluster.StartHealthMonitor)
 		return server.Listen(route.InitRoute,
 			server.WithCustomConfigFilePath(configPath),
 			server.WithServerBindHost(serverBindHost),
@@ -1,6 +1,7 @@
 package chart
 
 import (
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
 	"github.com/KubeOperator/kubepi/internal/service/v1/chart"
 	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
 	"github.com/kataras/iris/v12"
@@ -272,6 +273,7 @@ func (h *Handler) GetAppDetail() iris.Handler {
 func Install(parent iris.Party) {
 	handler := NewHandler()
 	sp := parent.Party("/charts/:cluster")
+	sp.Use(commons.ClusterAccessHandler("cluster"))
 	sp.Get("/repos", handler.ListRepo())
 	sp.Get("/repos/:name", handler.GetRepo())
 	sp.Post("/repos", handler.AddRepo())
@@ -284,6 +286,7 @@ func Install(parent iris.Party) {
 	sp.Get("/detail/:name", handler.GetChartByVersion())
 	sp.Post("/install", handler.InstallChart())
 	app := parent.Party("/apps/:cluster")
+	app.Use(commons.ClusterAccessHandler("cluster"))
 	app.Get("/search", handler.AllInstalled())
 	app.Delete("/:namespace/:name", handler.UnInstall())
 	app.Get("/:name", handler.GetAppDetail())
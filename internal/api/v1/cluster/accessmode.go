@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// UpdateClusterAccessMode 设置集群的只读或维护模式,只有管理员可以操作
+func (h *Handler) UpdateClusterAccessMode() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if !profile.IsAdministrator {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", []string{"permission %s required", "admin"})
+			return
+		}
+		var req v1Cluster.AccessMode
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		switch req.Mode {
+		case v1Cluster.AccessModeNormal, v1Cluster.AccessModeReadOnly, v1Cluster.AccessModeMaintenance:
+		default:
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "unknown access mode: "+req.Mode)
+			return
+		}
+		if !req.StartTime.IsZero() && !req.EndTime.IsZero() && !req.EndTime.After(req.StartTime) {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "end time must be after start time")
+			return
+		}
+		c, err := h.clusterService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if req.Mode == v1Cluster.AccessModeNormal {
+			req = v1Cluster.AccessMode{}
+		} else {
+			req.Operator = profile.Name
+		}
+		c.Spec.AccessMode = req
+		if err := h.clusterService.Update(name, c, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", c.Spec.AccessMode)
+	}
+}
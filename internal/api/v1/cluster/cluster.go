@@ -1,18 +1,17 @@
 package cluster
 
 import (
-	goContext "context"
 	"errors"
 	"fmt"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/KubeOperator/kubepi/internal/service/v1/clusterapp"
 	"github.com/KubeOperator/kubepi/internal/service/v1/clusterrepo"
 	"github.com/KubeOperator/kubepi/internal/service/v1/imagerepo"
 
 	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/proxy"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
 	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
@@ -27,7 +26,6 @@ import (
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
 	authV1 "k8s.io/api/authorization/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Handler struct {
@@ -295,6 +293,7 @@ func (h *Handler) SearchClusters() iris.Handler {
 		for i := range clusters {
 
 			c := Cluster{Cluster: clusters[i]}
+			c.Spec.Prometheus = hidePrometheusSecrets(c.Spec.Prometheus)
 			if profile.IsAdministrator {
 				c.Accessable = true
 			} else {
@@ -314,88 +313,12 @@ func (h *Handler) SearchClusters() iris.Handler {
 			result = append(result, c)
 		}
 		if showExtra {
-			ctx1, cancel := goContext.WithTimeout(goContext.Background(), 2*time.Second)
-			defer cancel()
-
-			wg := sync.WaitGroup{}
-			go func(result []Cluster) {
-				for i := range result {
-					wg.Add(1)
-					c := kubernetes.NewKubernetes(&result[i].Cluster)
-					go func(i int, ctx1 goContext.Context) {
-						defer wg.Done()
-						info, _ := getExtraClusterInfo(ctx1, c)
-						result[i].ExtraClusterInfo = info
-					}(i, ctx1)
-				}
-				wg.Wait()
-				cancel()
-			}(result)
-
-			<-ctx1.Done()
-		}
-		ctx.Values().Set("data", pkgV1.Page{Items: result, Total: total})
-	}
-}
-func getExtraClusterInfo(context goContext.Context, client kubernetes.Interface) (ExtraClusterInfo, error) {
-	err := client.Ping()
-	if err != nil {
-		return ExtraClusterInfo{Health: false, Message: err.Error()}, err
-	}
-	c, err := client.Client()
-	if err != nil {
-		return ExtraClusterInfo{Health: false, Message: err.Error()}, err
-	}
-	nodesList, err := c.CoreV1().Nodes().List(context, metav1.ListOptions{})
-	if err != nil {
-		return ExtraClusterInfo{Health: true, Message: err.Error()}, err
-	}
-	nodes := nodesList.Items
-
-	totalCpu := float64(0)
-	totalMemory := float64(0)
-	usedCpu := float64(0)
-	usedMemory := float64(0)
-	readyNodes := 0
-	for i := range nodes {
-		conditions := nodes[i].Status.Conditions
-		for i := range conditions {
-			if conditions[i].Type == "Ready" {
-				if conditions[i].Status == "True" {
-					readyNodes += 1
-				}
+			for i := range result {
+				result[i].ExtraClusterInfo = extraClusterInfo(result[i].Status.Health)
 			}
 		}
-		cpu := nodes[i].Status.Allocatable.Cpu().AsApproximateFloat64()
-		totalCpu += cpu
-		memory := nodes[i].Status.Allocatable.Memory().AsApproximateFloat64()
-		totalMemory += memory
-	}
-	podsList, err := c.CoreV1().Pods("").List(goContext.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return ExtraClusterInfo{Health: true, Message: err.Error()}, err
-	}
-	pods := podsList.Items
-	for i := range pods {
-		for j := range pods[i].Spec.Containers {
-			cpu := pods[i].Spec.Containers[j].Resources.Requests.Cpu().AsApproximateFloat64()
-			usedCpu += cpu
-			memory := pods[i].Spec.Containers[j].Resources.Requests.Memory().AsApproximateFloat64()
-			usedMemory += memory
-
-		}
-	}
-	result := ExtraClusterInfo{
-		Health:            true,
-		TotalNodeNum:      len(nodes),
-		ReadyNodeNum:      readyNodes,
-		CPUAllocatable:    totalCpu,
-		CPURequested:      usedCpu,
-		MemoryAllocatable: totalMemory,
-		MemoryRequested:   usedMemory,
+		ctx.Values().Set("data", pkgV1.Page{Items: result, Total: total})
 	}
-	return result, nil
-
 }
 
 // Get Cluster
@@ -417,6 +340,7 @@ func (h *Handler) GetCluster() iris.Handler {
 			ctx.Values().Set("message", fmt.Sprintf("get clusters failed: %s", err.Error()))
 			return
 		}
+		c.Spec.Prometheus = hidePrometheusSecrets(c.Spec.Prometheus)
 		ctx.Values().Set("data", c)
 	}
 }
@@ -485,6 +409,7 @@ func (h *Handler) UpdateCluster() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		proxy.ForgetCluster(c.UUID)
 	}
 }
 
@@ -519,6 +444,7 @@ func (h *Handler) ListClusters() iris.Handler {
 			rc := Cluster{
 				Cluster: clusters[i],
 			}
+			rc.Spec.Prometheus = hidePrometheusSecrets(rc.Spec.Prometheus)
 			for j := range mbs {
 				if mbs[j].UserRef == profile.Name {
 					rc.Accessable = true
@@ -597,6 +523,7 @@ func (h *Handler) DeleteCluster() iris.Handler {
 		k := kubernetes.NewKubernetes(c)
 		_ = k.CleanAllRBACResource()
 		_ = tx.Commit()
+		proxy.ForgetCluster(c.UUID)
 		ctx.StatusCode(iris.StatusOK)
 	}
 }
@@ -609,7 +536,30 @@ func Install(parent iris.Party) {
 	sp.Get("/:name", handler.GetCluster())
 	sp.Put("/:name", handler.UpdateCluster())
 	sp.Delete("/:name", handler.DeleteCluster())
+	sp.Put("/:name/accessmode", handler.UpdateClusterAccessMode())
+	sp.Get("/:name/health", handler.GetClusterHealth())
+	sp.Get("/:name/metrics/summary", handler.GetClusterMetricsSummary())
+	sp.Get("/:name/metrics/nodes", handler.ListNodeMetrics())
+	sp.Get("/:name/metrics/namespaces", handler.ListNamespaceMetrics())
+	sp.Get("/:name/metrics/workloads", handler.ListWorkloadMetrics())
+	sp.Get("/:name/metrics/pods", handler.ListTopPodMetrics())
+	sp.Put("/:name/prometheus", handler.UpdateClusterPrometheus())
+	sp.Get("/:name/prometheus/series", handler.QueryClusterPrometheus())
+	sp.Post("/:name/nodes/:node/cordon", handler.CordonNode())
+	sp.Post("/:name/nodes/:node/uncordon", handler.UncordonNode())
+	sp.Post("/:name/nodes/:node/drain", handler.DrainNode())
+	sp.Get("/:name/nodes/:node/drain/:task", handler.GetDrainTask())
+	sp.Get("/:name/nodes/:node/shell/session", handler.NodeShellSessionHandler())
+	sp.Post("/:name/namespaces/:namespace/:kind/:workload/restart", handler.RestartWorkload())
+	sp.Put("/:name/namespaces/:namespace/:kind/:workload/scale", handler.ScaleWorkload())
+	sp.Post("/:name/namespaces/:namespace/:kind/:workload/pause", handler.PauseWorkload())
+	sp.Post("/:name/namespaces/:namespace/:kind/:workload/resume", handler.ResumeWorkload())
+	sp.Get("/:name/namespaces/:namespace/:kind/:workload/history", handler.ListWorkloadHistory())
+	sp.Post("/:name/namespaces/:namespace/:kind/:workload/rollback", handler.RollbackWorkload())
+	sp.Post("/:name/namespaces/:namespace/:kind/:workload/trigger", handler.TriggerCronJob())
+	sp.Post("/:name/namespaces/:namespace/:kind/:workload/rerun", handler.RerunJob())
 	sp.Post("/search", handler.SearchClusters())
+	sp.Post("/resources/search", handler.GlobalSearch())
 	sp.Get("/:name/members", handler.ListClusterMembers())
 	sp.Post("/:name/members", handler.CreateClusterMember())
 	sp.Delete("/:name/members/:member", handler.DeleteClusterMember())
@@ -623,7 +573,14 @@ func Install(parent iris.Party) {
 	sp.Get("/:name/apigroups/{group:path}", handler.ListApiGroupResources())
 	sp.Get("/:name/namespaces", handler.ListNamespace())
 	sp.Get("/:name/terminal/session", handler.TerminalSessionHandler())
+	sp.Get("/:name/terminal/debug/session", handler.DebugSessionHandler())
+	sp.Get("/:name/terminal/sessions/:session", handler.GetSharedTerminal())
+	sp.Post("/:name/terminal/sessions/:session/invites", handler.InviteTerminalUsers())
+	sp.Delete("/:name/terminal/sessions/:session/invites/:user", handler.RevokeTerminalInvite())
+	sp.Post("/:name/terminal/sessions/:session/join", handler.JoinSharedTerminal())
 	sp.Get("/:name/logging/session", handler.LoggingHandler())
+	sp.Get("/:name/logging/aggregate/session", handler.AggregatedLoggingHandler())
+	sp.Get("/:name/kubeconfig", handler.DownloadKubeconfig())
 	sp.Get("/:name/repos", handler.ListClusterRepos())
 	sp.Get("/:name/repos/detail", handler.ListClusterReposDetail())
 	sp.Post("/:name/repos", handler.AddCLusterRepo())
@@ -0,0 +1,220 @@
+package cluster
+
+import (
+	goContext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/asdine/storm/v3"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	coreV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	k8sClient "k8s.io/client-go/kubernetes"
+)
+
+// 临时容器从 1.23 开始默认开启,并使用 Pod 作为 ephemeralcontainers 子资源的请求体
+var minEphemeralContainerVersion = utilversion.MustParseGeneric("1.23.0")
+
+// ephemeralContainerSupported 检查集群版本是否支持临时容器,不支持时返回提示信息
+func ephemeralContainerSupported(gitVersion string) error {
+	v, err := utilversion.ParseGeneric(gitVersion)
+	if err != nil {
+		return fmt.Errorf("can not parse cluster version %s: %s", gitVersion, err.Error())
+	}
+	if v.LessThan(minEphemeralContainerVersion) {
+		return fmt.Errorf("ephemeral debug containers require Kubernetes v1.23 or later, the cluster version is %s, please use a container image with a shell instead", gitVersion)
+	}
+	return nil
+}
+
+// debugContainer 创建共享目标容器进程命名空间的临时容器,开启 stdin 和 tty 使容器保持运行
+func debugContainer(name, image, target string) coreV1.EphemeralContainer {
+	return coreV1.EphemeralContainer{
+		EphemeralContainerCommon: coreV1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    image,
+			ImagePullPolicy:          coreV1.PullIfNotPresent,
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: coreV1.TerminationMessageReadFile,
+		},
+		TargetContainerName: target,
+	}
+}
+
+// addDebugContainer 通过 ephemeralcontainers 子资源向 pod 添加临时容器
+func addDebugContainer(ctx goContext.Context, client k8sClient.Interface, namespace, podName string, container coreV1.EphemeralContainer) error {
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if container.TargetContainerName != "" {
+		found := false
+		for i := range pod.Spec.Containers {
+			if pod.Spec.Containers[i].Name == container.TargetContainerName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("container %s not found in pod %s", container.TargetContainerName, podName)
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"ephemeralContainers": []coreV1.EphemeralContainer{container},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().Pods(namespace).Patch(ctx, podName, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "ephemeralcontainers")
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("ephemeral containers are disabled for this cluster: %s", err.Error())
+	}
+	return err
+}
+
+// debugImage 返回调试容器使用的镜像,非管理员只能使用默认镜像和允许的镜像
+func debugImage(conf v1Config.DebugConfig, requested string, admin bool) (string, error) {
+	if requested == "" || requested == conf.Image {
+		return conf.Image, nil
+	}
+	if admin {
+		return requested, nil
+	}
+	for i := range conf.AllowedImages {
+		if conf.AllowedImages[i] == requested {
+			return requested, nil
+		}
+	}
+	return "", fmt.Errorf("image %s is not allowed for debug containers", requested)
+}
+
+// DebugSessionHandler 向 pod 添加临时调试容器并打开终端,用于没有 shell 的镜像
+func (h *Handler) DebugSessionHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("name")
+		namespace := ctx.URLParam("namespace")
+		podName := ctx.URLParam("podName")
+		target := ctx.URLParam("containerName")
+		shell := ctx.URLParam("shell")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		debugConf := server.Config().Spec.Terminal.Debug
+		image, err := debugImage(debugConf, ctx.URLParam("image"), profile.IsAdministrator)
+		if err != nil {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if namespace == "" || podName == "" || image == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "namespace, podName and image are required")
+			return
+		}
+		if shell == "" {
+			shell = "sh"
+		}
+		limits, ok := checkTerminalLimits(ctx, clusterName)
+		if !ok {
+			return
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, true) {
+			return
+		}
+		// 以用户身份添加临时容器和打开终端,由集群的 RBAC 决定是否允许
+		conf, err := commons.UserRestConfig(c, profile)
+		if errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", fmt.Sprintf("user %s is not a member of cluster %s", profile.Name, clusterName))
+			return
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		client, err := k8sClient.NewForConfig(conf)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		info, err := client.Discovery().ServerVersion()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if err := ephemeralContainerSupported(info.GitVersion); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		sessionID, err := terminal.GenTerminalSessionId()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		release, ok := commons.AcquireStream(ctx, clusterName)
+		if !ok {
+			return
+		}
+		container := debugContainer("debugger-"+sessionID[:5], image, target)
+		if err := addDebugContainer(ctx.Request().Context(), client, namespace, podName, container); err != nil {
+			release()
+			writeWorkloadError(ctx, err)
+			return
+		}
+		startTimeout := time.Duration(debugConf.StartTimeout) * time.Second
+		if startTimeout <= 0 {
+			startTimeout = defaultContainerStartTimeout
+		}
+		if err := waitForContainerRunning(ctx.Request().Context(), client, namespace, podName, container.Name, startTimeout); err != nil {
+			release()
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		finishRecording, ok := openTerminal(ctx, sessionID, limits, terminalTarget{
+			cluster:   clusterName,
+			namespace: namespace,
+			pod:       podName,
+			container: container.Name,
+			shell:     shell,
+			shareable: true,
+		})
+		if !ok {
+			release()
+			return
+		}
+		go func() {
+			defer release()
+			defer finishRecording()
+			terminal.WaitForTerminal(client, conf, namespace, podName, container.Name, sessionID, shell)
+		}()
+		ctx.Values().Set("data", TerminalResponse{ID: sessionID})
+	}
+}
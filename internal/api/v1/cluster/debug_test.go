@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	goContext "context"
+	"testing"
+
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEphemeralContainerSupported(t *testing.T) {
+	for version, supported := range map[string]bool{"v1.22.3": false, "v1.23.0": true, "v1.24.1+k3s1": true, "v1.20.4-aliyun.1": false} {
+		if err := ephemeralContainerSupported(version); (err == nil) != supported {
+			t.Errorf("version %s: unexpected result %v", version, err)
+		}
+	}
+}
+
+func TestAddDebugContainer(t *testing.T) {
+	client := fake.NewSimpleClientset(&coreV1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       coreV1.PodSpec{Containers: []coreV1.Container{{Name: "app", Image: "gcr.io/distroless/static"}}},
+	})
+	ctx := goContext.Background()
+	if err := addDebugContainer(ctx, client, "default", "web", debugContainer("debugger-1", "busybox", "missing")); err == nil {
+		t.Error("missing target container should be rejected")
+	}
+	if err := addDebugContainer(ctx, client, "default", "web", debugContainer("debugger-1", "busybox", "app")); err != nil {
+		t.Fatal(err)
+	}
+	pod, _ := client.CoreV1().Pods("default").Get(ctx, "web", metav1.GetOptions{})
+	if len(pod.Spec.EphemeralContainers) != 1 || pod.Spec.EphemeralContainers[0].TargetContainerName != "app" || !pod.Spec.EphemeralContainers[0].TTY {
+		t.Errorf("unexpected ephemeral containers %+v", pod.Spec.EphemeralContainers)
+	}
+}
+
+func TestDebugImage(t *testing.T) {
+	conf := v1Config.DebugConfig{Image: "busybox:1.33", AllowedImages: []string{"nicolaka/netshoot"}}
+	tests := []struct {
+		requested string
+		admin     bool
+		want      string
+		allowed   bool
+	}{
+		{"", false, "busybox:1.33", true},
+		{"busybox:1.33", false, "busybox:1.33", true},
+		{"nicolaka/netshoot", false, "nicolaka/netshoot", true},
+		{"attacker/image", false, "", false},
+		{"attacker/image", true, "attacker/image", true},
+	}
+	for _, tt := range tests {
+		image, err := debugImage(conf, tt.requested, tt.admin)
+		if (err == nil) != tt.allowed || image != tt.want {
+			t.Errorf("debugImage(%q, %v) = %q, %v", tt.requested, tt.admin, image, err)
+		}
+	}
+}
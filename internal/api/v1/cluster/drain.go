@@ -0,0 +1,262 @@
+package cluster
+
+import (
+	goContext "context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/google/uuid"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sClient "k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+const (
+	DrainTaskRunning   = "Running"
+	DrainTaskSucceeded = "Succeeded"
+	DrainTaskFailed    = "Failed"
+
+	DrainPodPending = "Pending"
+	DrainPodEvicted = "Evicted"
+	DrainPodDeleted = "Deleted"
+	DrainPodFailed  = "Failed"
+
+	defaultDrainTimeout = 5 * time.Minute
+	// 已结束的任务保留一小时
+	drainTaskRetention = time.Hour
+	// 每个任务最多保留的日志行数
+	drainTaskLogLimit = 200
+)
+
+// DrainOptions 与 kubectl drain 的参数对应,DaemonSet 管理的 pod 总是被忽略
+type DrainOptions struct {
+	Force              bool `json:"force"`
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData"`
+	// 为空时使用 pod 自身的 terminationGracePeriodSeconds
+	GracePeriodSeconds *int `json:"gracePeriodSeconds"`
+	TimeoutSeconds     int  `json:"timeoutSeconds"`
+}
+
+type DrainPodResult struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+type DrainTask struct {
+	ID        string           `json:"id"`
+	Cluster   string           `json:"cluster"`
+	Node      string           `json:"node"`
+	Operator  string           `json:"operator"`
+	Options   DrainOptions     `json:"options"`
+	Status    string           `json:"status"`
+	Message   string           `json:"message,omitempty"`
+	Warnings  string           `json:"warnings,omitempty"`
+	Total     int              `json:"total"`
+	Done      int              `json:"done"`
+	Pods      []DrainPodResult `json:"pods"`
+	Logs      []string         `json:"logs"`
+	StartTime time.Time        `json:"startTime"`
+	EndTime   time.Time        `json:"endTime,omitempty"`
+}
+
+// drainTask 后台任务会持续更新 DrainTask,读写都需要加锁
+type drainTask struct {
+	mu   sync.Mutex
+	task DrainTask
+}
+
+// snapshot 返回任务当前状态的拷贝,避免序列化时与后台任务并发读写
+func (t *drainTask) snapshot() DrainTask {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := t.task
+	result.Pods = append([]DrainPodResult{}, t.task.Pods...)
+	result.Logs = append([]string{}, t.task.Logs...)
+	return result
+}
+
+func (t *drainTask) setPods(pods []coreV1.Pod, warnings string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.task.Warnings = warnings
+	t.task.Total = len(pods)
+	t.task.Pods = make([]DrainPodResult, 0, len(pods))
+	for i := range pods {
+		t.task.Pods = append(t.task.Pods, DrainPodResult{Namespace: pods[i].Namespace, Name: pods[i].Name, Status: DrainPodPending})
+	}
+}
+
+// podDone 记录 pod 已被驱逐或删除
+func (t *drainTask) podDone(namespace, name string, usingEviction bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.task.Pods {
+		if t.task.Pods[i].Namespace == namespace && t.task.Pods[i].Name == name && t.task.Pods[i].Status == DrainPodPending {
+			t.task.Pods[i].Status = DrainPodDeleted
+			if usingEviction {
+				t.task.Pods[i].Status = DrainPodEvicted
+			}
+			t.task.Done++
+			return
+		}
+	}
+}
+
+// finish 结束任务,err 不为空时仍未完成的 pod 标记为失败
+func (t *drainTask) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.task.EndTime = time.Now()
+	if err == nil {
+		t.task.Status = DrainTaskSucceeded
+		return
+	}
+	t.task.Status = DrainTaskFailed
+	t.task.Message = err.Error()
+	for i := range t.task.Pods {
+		if t.task.Pods[i].Status == DrainPodPending {
+			t.task.Pods[i].Status = DrainPodFailed
+			t.task.Pods[i].Message = podDrainError(err, t.task.Pods[i].Namespace, t.task.Pods[i].Name)
+		}
+	}
+}
+
+// podDrainError 从 kubectl 汇总的错误中找出与 pod 相关的部分
+func podDrainError(err error, namespace, name string) string {
+	for _, line := range strings.Split(err.Error(), ", ") {
+		if strings.Contains(line, fmt.Sprintf("%q -n %q", name, namespace)) || strings.Contains(line, namespace+"/"+name) {
+			return strings.Trim(line, "[]")
+		}
+	}
+	return err.Error()
+}
+
+// Write 收集 kubectl drain 输出的日志,例如因 PodDisruptionBudget 限制而等待重试的信息
+func (t *drainTask) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		t.task.Logs = append(t.task.Logs, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), line))
+	}
+	if len(t.task.Logs) > drainTaskLogLimit {
+		t.task.Logs = t.task.Logs[len(t.task.Logs)-drainTaskLogLimit:]
+	}
+	return len(p), nil
+}
+
+type drainTaskStore struct {
+	mu    sync.Mutex
+	tasks map[string]*drainTask
+}
+
+var drainTasks = &drainTaskStore{tasks: map[string]*drainTask{}}
+
+// add 登记新任务,同一节点已有正在执行的任务时返回该任务
+func (s *drainTaskStore) add(task *drainTask) (*drainTask, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tasks {
+		snap := t.snapshot()
+		if snap.Status != DrainTaskRunning && time.Since(snap.EndTime) > drainTaskRetention {
+			delete(s.tasks, id)
+			continue
+		}
+		if snap.Status == DrainTaskRunning && snap.Cluster == task.task.Cluster && snap.Node == task.task.Node {
+			return t, false
+		}
+	}
+	s.tasks[task.task.ID] = task
+	return task, true
+}
+
+func (s *drainTaskStore) get(id string) (*drainTask, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	return t, ok
+}
+
+func newDrainTask(cluster, node, operator string, options DrainOptions) *drainTask {
+	if options.TimeoutSeconds <= 0 {
+		options.TimeoutSeconds = int(defaultDrainTimeout.Seconds())
+	}
+	return &drainTask{task: DrainTask{
+		ID:        uuid.New().String(),
+		Cluster:   cluster,
+		Node:      node,
+		Operator:  operator,
+		Options:   options,
+		Status:    DrainTaskRunning,
+		Pods:      []DrainPodResult{},
+		Logs:      []string{},
+		StartTime: time.Now(),
+	}}
+}
+
+func newDrainHelper(ctx goContext.Context, client k8sClient.Interface, options DrainOptions, out *drainTask) *drain.Helper {
+	gracePeriod := -1
+	if options.GracePeriodSeconds != nil {
+		gracePeriod = *options.GracePeriodSeconds
+	}
+	helper := &drain.Helper{
+		Ctx:                 ctx,
+		Client:              client,
+		Force:               options.Force,
+		GracePeriodSeconds:  gracePeriod,
+		IgnoreAllDaemonSets: true,
+		DeleteEmptyDirData:  options.DeleteEmptyDirData,
+		Timeout:             time.Duration(options.TimeoutSeconds) * time.Second,
+		Out:                 out,
+		ErrOut:              out,
+		OnPodDeletedOrEvicted: func(pod *coreV1.Pod, usingEviction bool) {
+			out.podDone(pod.Namespace, pod.Name, usingEviction)
+		},
+	}
+	return helper
+}
+
+// cordonNode 设置节点是否可调度
+func cordonNode(ctx goContext.Context, client k8sClient.Interface, name string, unschedulable bool) error {
+	node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return drain.RunCordonOrUncordon(&drain.Helper{Ctx: ctx, Client: client}, node, unschedulable)
+}
+
+// drainNode 先禁止调度,再通过 eviction api 驱逐节点上的 pod,受 PodDisruptionBudget 限制的 pod 会一直重试到超时
+func drainNode(ctx goContext.Context, client k8sClient.Interface, t *drainTask) error {
+	// 任务创建后 node 以及参数不会再改变
+	node := t.task.Node
+	helper := newDrainHelper(ctx, client, t.task.Options, t)
+	if err := cordonNode(ctx, client, node, true); err != nil {
+		return err
+	}
+	list, errs := helper.GetPodsForDeletion(node)
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for i := range errs {
+			msgs = append(msgs, errs[i].Error())
+		}
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+	t.setPods(list.Pods(), list.Warnings())
+	return helper.DeleteOrEvictPods(list.Pods())
+}
+
+func runDrainTask(client k8sClient.Interface, t *drainTask) {
+	err := drainNode(goContext.Background(), client, t)
+	if err != nil {
+		server.Logger().Errorf("drain node %s of cluster %s failed: %s", t.task.Node, t.task.Cluster, err.Error())
+	}
+	t.finish(err)
+}
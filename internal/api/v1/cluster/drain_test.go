@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	goContext "context"
+	"strings"
+	"testing"
+
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	policyV1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func newDrainFakeClient(pods ...*coreV1.Pod) *fake.Clientset {
+	objects := []runtime.Object{
+		&coreV1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&appsV1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent-owner"}},
+	}
+	for i := range pods {
+		pods[i].Spec.NodeName = "node-1"
+		objects = append(objects, pods[i])
+	}
+	client := fake.NewSimpleClientset(objects...)
+	client.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods/eviction", Kind: "Eviction", Group: "policy", Version: "v1"}},
+	}}
+	// 模拟驱逐成功后 pod 被删除
+	client.PrependReactor("create", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8sTesting.CreateAction).GetObject().(*policyV1.Eviction)
+		return true, nil, client.Tracker().Delete(coreV1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+	})
+	return client
+}
+
+func newPod(name string, owner string) *coreV1.Pod {
+	pod := &coreV1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	if owner != "" {
+		controller := true
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: owner, Name: name + "-owner", Controller: &controller}}
+	}
+	return pod
+}
+
+func TestDrainNode(t *testing.T) {
+	client := newDrainFakeClient(newPod("web", "ReplicaSet"), newPod("agent", "DaemonSet"))
+	task := newDrainTask("test", "node-1", "admin", DrainOptions{})
+	if err := drainNode(goContext.Background(), client, task); err != nil {
+		t.Fatal(err)
+	}
+	task.finish(nil)
+	snap := task.snapshot()
+	if snap.Status != DrainTaskSucceeded || snap.Total != 1 || snap.Done != 1 {
+		t.Fatalf("unexpected task %+v", snap)
+	}
+	if snap.Pods[0].Name != "web" || snap.Pods[0].Status != DrainPodEvicted {
+		t.Errorf("unexpected pod result %+v", snap.Pods[0])
+	}
+	if !strings.Contains(snap.Warnings, "default/agent") {
+		t.Errorf("daemonset pod should be ignored with warning, got %q", snap.Warnings)
+	}
+	node, _ := client.CoreV1().Nodes().Get(goContext.Background(), "node-1", metav1.GetOptions{})
+	if !node.Spec.Unschedulable {
+		t.Error("node should be cordoned")
+	}
+}
+
+func TestDrainNodeBlocked(t *testing.T) {
+	client := newDrainFakeClient(newPod("web", "ReplicaSet"), newPod("bare", ""))
+	task := newDrainTask("test", "node-1", "admin", DrainOptions{})
+	err := drainNode(goContext.Background(), client, task)
+	if err == nil || !strings.Contains(err.Error(), "default/bare") {
+		t.Fatalf("unmanaged pod should block drain without force, got %v", err)
+	}
+	if _, err := client.CoreV1().Pods("default").Get(goContext.Background(), "web", metav1.GetOptions{}); err != nil {
+		t.Errorf("no pod should be evicted when drain is blocked: %v", err)
+	}
+}
+
+func TestDrainTaskStore(t *testing.T) {
+	store := &drainTaskStore{tasks: map[string]*drainTask{}}
+	first, created := store.add(newDrainTask("test", "node-1", "admin", DrainOptions{}))
+	if !created {
+		t.Fatal("first task should be created")
+	}
+	if task, created := store.add(newDrainTask("test", "node-1", "admin", DrainOptions{})); created || task != first {
+		t.Error("node with running task should not be drained again")
+	}
+	first.finish(nil)
+	if _, created := store.add(newDrainTask("test", "node-1", "admin", DrainOptions{})); !created {
+		t.Error("node should be drained again after previous task finished")
+	}
+}
@@ -0,0 +1,275 @@
+package cluster
+
+import (
+	goContext "context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/metrics"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	coreV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sClient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	// 同时巡检的集群数量
+	healthMonitorConcurrency = 10
+	// 统计资源请求时每页读取的 pod 数量
+	healthPodPageSize = 500
+)
+
+type HealthResponse struct {
+	Health  v1Cluster.HealthStatus   `json:"health"`
+	History []v1Cluster.HealthRecord `json:"history"`
+}
+
+// GetClusterHealth 返回后台巡检缓存的集群健康状态及历史
+func (h *Handler) GetClusterHealth() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		c, err := h.clusterService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, false) {
+			return
+		}
+		history := c.Status.HealthHistory
+		if history == nil {
+			history = []v1Cluster.HealthRecord{}
+		}
+		ctx.Values().Set("data", HealthResponse{Health: c.Status.Health, History: history})
+	}
+}
+
+var healthMonitorOnce sync.Once
+
+// StartHealthMonitor 启动后台巡检,按配置的间隔探测所有集群的健康状态
+func StartHealthMonitor() {
+	clusterService := cluster.NewService()
+	conf := server.Config().Spec.Monitor
+	if !conf.Enable || conf.Interval <= 0 {
+		return
+	}
+	healthMonitorOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Duration(conf.Interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				probeAllClusters(clusterService, time.Duration(conf.Timeout)*time.Second, conf.HistoryLimit)
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+func probeAllClusters(clusterService cluster.Service, timeout time.Duration, historyLimit int) {
+	clusters, err := clusterService.List(common.DBOptions{})
+	if err != nil {
+		server.Logger().Errorf("list clusters for health monitor failed: %s", err.Error())
+		return
+	}
+	sem := make(chan struct{}, healthMonitorConcurrency)
+	wg := sync.WaitGroup{}
+	for i := range clusters {
+		if clusters[i].Status.Phase == clusterStatusInitializing {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c v1Cluster.Cluster) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ctx, cancel := goContext.WithTimeout(goContext.Background(), timeout)
+			defer cancel()
+			health := probeClusterHealth(ctx, kubernetes.NewKubernetes(&c))
+			if err := saveClusterHealth(clusterService, c.Name, health, historyLimit); err != nil {
+				server.Logger().Errorf("update health status of cluster %s failed: %s", c.Name, err.Error())
+			}
+		}(clusters[i])
+	}
+	wg.Wait()
+}
+
+// saveClusterHealth 在事务中重新读取集群并只更新健康相关的字段,避免覆盖巡检期间对集群的修改
+func saveClusterHealth(clusterService cluster.Service, name string, health v1Cluster.HealthStatus, historyLimit int) error {
+	tx, err := server.DB().Begin(true)
+	if err != nil {
+		return err
+	}
+	txOptions := common.DBOptions{DB: tx}
+	c, err := clusterService.Get(name, txOptions)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	status := c.Status
+	status.Health = health
+	if health.Version != "" {
+		status.Version = health.Version
+	}
+	status.HealthHistory = appendHealthRecord(status.HealthHistory, health, historyLimit)
+	if err := clusterService.UpdateStatus(name, status, txOptions); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// appendHealthRecord 追加一条历史记录,只保留最近的 limit 条
+func appendHealthRecord(history []v1Cluster.HealthRecord, health v1Cluster.HealthStatus, limit int) []v1Cluster.HealthRecord {
+	history = append(history, v1Cluster.HealthRecord{
+		Healthy:      health.Healthy,
+		Ready:        health.Ready,
+		ReadyNodeNum: health.ReadyNodeNum,
+		TotalNodeNum: health.TotalNodeNum,
+		Message:      health.Message,
+		ProbeTime:    health.ProbeTime,
+	})
+	if limit > 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history
+}
+
+// probeClusterHealth 探测 readyz、版本、节点就绪情况以及组件状态,并统计资源的分配情况
+func probeClusterHealth(ctx goContext.Context, k kubernetes.Interface) v1Cluster.HealthStatus {
+	result := v1Cluster.HealthStatus{ProbeTime: time.Now()}
+	client, err := k.Client()
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if err := probeReadyz(ctx, client); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Ready = true
+	result.Healthy = true
+	if v, err := client.Discovery().ServerVersion(); err == nil {
+		result.Version = v.GitVersion
+	}
+	var messages []string
+	nodesList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		for i := range nodesList.Items {
+			if isNodeReady(nodesList.Items[i]) {
+				result.ReadyNodeNum += 1
+			}
+			result.CPUAllocatable += nodesList.Items[i].Status.Allocatable.Cpu().AsApproximateFloat64()
+			result.MemoryAllocatable += nodesList.Items[i].Status.Allocatable.Memory().AsApproximateFloat64()
+		}
+		result.TotalNodeNum = len(nodesList.Items)
+	}
+	if cpu, memory, err := sumPodRequests(ctx, client); err != nil {
+		messages = append(messages, err.Error())
+	} else {
+		result.CPURequested = cpu
+		result.MemoryRequested = memory
+	}
+	// 未安装 metrics-server 时只统计 requests
+	if nodes, err := metrics.NewClient(client).NodeUsages(ctx); err == nil {
+		summary := metrics.Summarize(nodes)
+		result.MetricsAvailable = true
+		result.CPUUsage = summary.Usage.CPU
+		result.MemoryUsage = summary.Usage.Memory
+	}
+	// componentstatuses 在新版本中已废弃,获取失败时忽略
+	if cs, err := client.CoreV1().ComponentStatuses().List(ctx, metav1.ListOptions{}); err == nil {
+		for i := range cs.Items {
+			component := v1Cluster.ComponentStatus{Name: cs.Items[i].Name}
+			for _, condition := range cs.Items[i].Conditions {
+				if condition.Type == coreV1.ComponentHealthy {
+					component.Healthy = condition.Status == coreV1.ConditionTrue
+					component.Message = condition.Message
+					if condition.Error != "" {
+						component.Message = condition.Error
+					}
+				}
+			}
+			result.Components = append(result.Components, component)
+		}
+	}
+	result.Message = strings.Join(messages, "; ")
+	return result
+}
+
+// sumPodRequests 分页统计未结束的 pod 的资源请求,已结束的 pod 不占用资源
+func sumPodRequests(ctx goContext.Context, client k8sClient.Interface) (cpu, memory float64, err error) {
+	opts := metav1.ListOptions{
+		Limit:         healthPodPageSize,
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	}
+	for {
+		pods, err := client.CoreV1().Pods("").List(ctx, opts)
+		if err != nil {
+			return 0, 0, err
+		}
+		for i := range pods.Items {
+			for j := range pods.Items[i].Spec.Containers {
+				requests := pods.Items[i].Spec.Containers[j].Resources.Requests
+				cpu += requests.Cpu().AsApproximateFloat64()
+				memory += requests.Memory().AsApproximateFloat64()
+			}
+		}
+		if pods.Continue == "" {
+			return cpu, memory, nil
+		}
+		opts.Continue = pods.Continue
+	}
+}
+
+// probeReadyz 访问 /readyz,不支持 readyz 的旧版本集群使用 /healthz
+func probeReadyz(ctx goContext.Context, client k8sClient.Interface) error {
+	_, err := client.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+	if err == nil {
+		return nil
+	}
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Code == http.StatusNotFound {
+		_, err = client.Discovery().RESTClient().Get().AbsPath("/healthz").DoRaw(ctx)
+	}
+	return err
+}
+
+func isNodeReady(node coreV1.Node) bool {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == coreV1.NodeReady {
+			return node.Status.Conditions[i].Status == coreV1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// extraClusterInfo 将缓存的健康状态转换为列表接口使用的集群信息
+func extraClusterInfo(health v1Cluster.HealthStatus) ExtraClusterInfo {
+	return ExtraClusterInfo{
+		TotalNodeNum:      health.TotalNodeNum,
+		ReadyNodeNum:      health.ReadyNodeNum,
+		CPUAllocatable:    health.CPUAllocatable,
+		CPURequested:      health.CPURequested,
+		MemoryAllocatable: health.MemoryAllocatable,
+		MemoryRequested:   health.MemoryRequested,
+		MetricsAvailable:  health.MetricsAvailable,
+		CPUUsage:          health.CPUUsage,
+		MemoryUsage:       health.MemoryUsage,
+		Health:            health.Healthy,
+		Message:           health.Message,
+	}
+}
@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	goContext "context"
+	"testing"
+	"time"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+func TestAppendHealthRecord(t *testing.T) {
+	var history []v1Cluster.HealthRecord
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		history = appendHealthRecord(history, v1Cluster.HealthStatus{
+			Healthy:   i%2 == 0,
+			ProbeTime: start.Add(time.Duration(i) * time.Minute),
+		}, 3)
+	}
+	if len(history) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(history))
+	}
+	if !history[0].ProbeTime.Equal(start.Add(2*time.Minute)) || !history[2].ProbeTime.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("history should keep the latest records, got %v", history)
+	}
+}
+
+func testPodWithRequests(name, cpu, memory string) coreV1.Pod {
+	return coreV1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: coreV1.PodSpec{Containers: []coreV1.Container{{
+			Resources: coreV1.ResourceRequirements{Requests: coreV1.ResourceList{
+				coreV1.ResourceCPU:    resource.MustParse(cpu),
+				coreV1.ResourceMemory: resource.MustParse(memory),
+			}},
+		}}},
+	}
+}
+
+func TestSumPodRequests(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var requests []metav1.ListOptions
+	client.PrependReactor("list", "pods", func(action kubetesting.Action) (bool, runtime.Object, error) {
+		restrictions := action.(kubetesting.ListActionImpl).GetListRestrictions()
+		requests = append(requests, metav1.ListOptions{FieldSelector: restrictions.Fields.String()})
+		if len(requests) == 1 {
+			list := &coreV1.PodList{Items: []coreV1.Pod{testPodWithRequests("a", "500m", "1Gi")}}
+			list.Continue = "next"
+			return true, list, nil
+		}
+		return true, &coreV1.PodList{Items: []coreV1.Pod{testPodWithRequests("b", "250m", "1Gi")}}, nil
+	})
+	cpu, memory, err := sumPodRequests(goContext.TODO(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 pages, got %d", len(requests))
+	}
+	if requests[0].FieldSelector != "status.phase!=Failed,status.phase!=Succeeded" {
+		t.Errorf("unexpected field selector %s", requests[0].FieldSelector)
+	}
+	if cpu != 0.75 || memory != 2*1024*1024*1024 {
+		t.Errorf("unexpected requests cpu %v memory %v", cpu, memory)
+	}
+}
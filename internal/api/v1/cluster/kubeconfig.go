@@ -0,0 +1,166 @@
+package cluster
+
+import (
+	goContext "context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var kubeconfigAuditService = system.NewService()
+
+const (
+	// apiserver 允许的最短证书有效期
+	minKubeconfigExpiration     = 600
+	defaultKubeconfigExpiration = 8 * 3600
+)
+
+// kubeconfigExpiration 计算证书有效期,requested 为 0 时使用默认有效期
+func kubeconfigExpiration(conf v1Config.KubeconfigConfig, requested int) (time.Duration, error) {
+	if requested == 0 {
+		requested = conf.DefaultExpiration
+	}
+	if requested == 0 {
+		requested = defaultKubeconfigExpiration
+	}
+	if requested < minKubeconfigExpiration {
+		return 0, fmt.Errorf("expiration must be at least %d seconds", minKubeconfigExpiration)
+	}
+	if conf.MaxExpiration > 0 && requested > conf.MaxExpiration {
+		return 0, fmt.Errorf("expiration must not exceed %d seconds", conf.MaxExpiration)
+	}
+	return time.Duration(requested) * time.Second, nil
+}
+
+// clusterCAData 返回集群的 CA 证书,连接配置中没有 CA 时读取 kube-root-ca.crt
+func clusterCAData(cfg *rest.Config, k kubernetes.Interface) ([]byte, error) {
+	if len(cfg.CAData) > 0 {
+		return cfg.CAData, nil
+	}
+	if cfg.CAFile != "" {
+		return os.ReadFile(cfg.CAFile)
+	}
+	client, err := k.Client()
+	if err != nil {
+		return nil, err
+	}
+	cm, err := client.CoreV1().ConfigMaps(metav1.NamespaceDefault).Get(goContext.TODO(), "kube-root-ca.crt", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can not get the CA certificate of the cluster: %s", err.Error())
+	}
+	if ca := cm.Data["ca.crt"]; ca != "" {
+		return []byte(ca), nil
+	}
+	return nil, errors.New("can not get the CA certificate of the cluster")
+}
+
+func buildKubeconfig(clusterName, host, user string, ca, cert, key []byte) *clientcmdapi.Config {
+	cc := clientcmdapi.NewConfig()
+	cc.Clusters[clusterName] = &clientcmdapi.Cluster{
+		Server:                   host,
+		CertificateAuthorityData: ca,
+	}
+	cc.AuthInfos[user] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: cert,
+		ClientKeyData:         key,
+	}
+	contextName := fmt.Sprintf("%s@%s", clusterName, user)
+	cc.Contexts[contextName] = &clientcmdapi.Context{
+		Cluster:  clusterName,
+		AuthInfo: user,
+	}
+	cc.CurrentContext = contextName
+	return cc
+}
+
+func saveKubeconfigLog(operator, cluster string, statusCode int, detail string) {
+	log := v1System.OperationLog{
+		Operator:            operator,
+		Operation:           "download",
+		OperationDomain:     "clusters_kubeconfig",
+		SpecificInformation: fmt.Sprintf("[%s] %s", cluster, operator),
+		Cluster:             cluster,
+		Resource:            "kubeconfig",
+		ResourceName:        operator,
+		StatusCode:          statusCode,
+		Detail:              detail,
+	}
+	go kubeconfigAuditService.CreateOperationLog(&log, common.DBOptions{})
+}
+
+// DownloadKubeconfig 为集群成员签发短期证书并下载 kubeconfig,每次签发都记录操作日志
+func (h *Handler) DownloadKubeconfig() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		expiration, err := kubeconfigExpiration(server.Config().Spec.Kubeconfig, ctx.URLParamIntDefault("expiration", 0))
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		c, err := h.clusterService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, true) {
+			return
+		}
+		if _, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(name, profile.Name, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", fmt.Sprintf("user %s is not a member of cluster %s", profile.Name, name))
+			return
+		}
+		k := kubernetes.NewKubernetes(c)
+		cfg, err := k.Config()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ca, err := clusterCAData(cfg, k)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		cert, key, err := k.CreateTemporaryUser(profile.Name, expiration)
+		if err != nil {
+			saveKubeconfigLog(profile.Name, name, iris.StatusInternalServerError, err.Error())
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("issue certificate failed: %s", err.Error()))
+			return
+		}
+		data, err := clientcmd.Write(*buildKubeconfig(name, cfg.Host, profile.Name, ca, cert, key))
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		expiresAt := time.Now().Add(expiration)
+		saveKubeconfigLog(profile.Name, name, iris.StatusOK, fmt.Sprintf("expires at %s", expiresAt.Format(time.RFC3339)))
+
+		ctx.Header("Content-Type", server.ContentTypeDownload)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%s-kubeconfig", name))
+		ctx.Header("Content-Transfer-Encoding", "binary")
+		_, _ = ctx.Write(data)
+	}
+}
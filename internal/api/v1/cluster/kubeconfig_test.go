@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+)
+
+func TestKubeconfigExpiration(t *testing.T) {
+	conf := v1Config.KubeconfigConfig{DefaultExpiration: 3600, MaxExpiration: 7200}
+	if d, err := kubeconfigExpiration(conf, 0); err != nil || d != time.Hour {
+		t.Errorf("unexpected default expiration %s %v", d, err)
+	}
+	if d, err := kubeconfigExpiration(conf, 1800); err != nil || d != 30*time.Minute {
+		t.Errorf("unexpected expiration %s %v", d, err)
+	}
+	if _, err := kubeconfigExpiration(conf, 60); err == nil {
+		t.Error("expiration shorter than 600 seconds should be rejected")
+	}
+	if _, err := kubeconfigExpiration(conf, 7201); err == nil {
+		t.Error("expiration longer than the max expiration should be rejected")
+	}
+	if d, _ := kubeconfigExpiration(v1Config.KubeconfigConfig{}, 0); d != defaultKubeconfigExpiration*time.Second {
+		t.Errorf("unexpected fallback expiration %s", d)
+	}
+}
+
+func TestBuildKubeconfig(t *testing.T) {
+	cc := buildKubeconfig("test", "https://10.0.0.1:6443", "alice", []byte("ca"), []byte("cert"), []byte("key"))
+	if cc.CurrentContext != "test@alice" {
+		t.Errorf("unexpected context %s", cc.CurrentContext)
+	}
+	cluster := cc.Clusters["test"]
+	if cluster.InsecureSkipTLSVerify || string(cluster.CertificateAuthorityData) != "ca" || cluster.Server != "https://10.0.0.1:6443" {
+		t.Errorf("unexpected cluster %+v", cluster)
+	}
+	if string(cc.AuthInfos["alice"].ClientCertificateData) != "cert" || string(cc.AuthInfos["alice"].ClientKeyData) != "key" {
+		t.Error("unexpected auth info")
+	}
+}
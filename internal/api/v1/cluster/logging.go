@@ -1,11 +1,18 @@
 package cluster
 
 import (
+	goContext "context"
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"github.com/KubeOperator/kubepi/pkg/logging"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sClient "k8s.io/client-go/kubernetes"
 )
 
 func (h *Handler) LoggingHandler() iris.Handler {
@@ -43,6 +50,9 @@ func (h *Handler) LoggingHandler() iris.Handler {
 			ctx.Values().Set("message", err)
 			return
 		}
+		if !commons.CheckClusterAccess(ctx, c, false) {
+			return
+		}
 		k := kubernetes.NewKubernetes(c)
 		client, err := k.Client()
 		if err != nil {
@@ -50,11 +60,154 @@ func (h *Handler) LoggingHandler() iris.Handler {
 			ctx.Values().Set("message", err)
 			return
 		}
+		release, ok := commons.AcquireStream(ctx, clusterName)
+		if !ok {
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		logging.LogSessions.Set(sessionId, logging.LogSession{
+			Id:    sessionId,
+			Bound: make(chan error),
+			User:  profile.Name,
+		})
+		go func() {
+			defer release()
+			logging.WaitForLoggingStream(client, namespace, podName, containerName, tailLines, follow, sessionId)
+		}()
+		ctx.Values().Set("data", TerminalResponse{ID: sessionId})
+	}
+}
+
+const kindReplicaSets = "replicasets"
+
+// workloadSelector 返回工作负载选择 pod 使用的标签选择器
+func workloadSelector(ctx goContext.Context, client k8sClient.Interface, kind, namespace, name string) (string, error) {
+	var selector *metav1.LabelSelector
+	switch kind {
+	case kindDeployments:
+		d, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = d.Spec.Selector
+	case kindStatefulSets:
+		s, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = s.Spec.Selector
+	case kindDaemonSets:
+		d, err := client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = d.Spec.Selector
+	case kindReplicaSets:
+		r, err := client.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = r.Spec.Selector
+	case kindJobs:
+		j, err := client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = j.Spec.Selector
+	default:
+		return "", fmt.Errorf("%s does not support this action", kind)
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return s.String(), nil
+}
+
+// AggregatedLoggingHandler 按标签选择器或工作负载同时读取多个 pod 的日志
+func (h *Handler) AggregatedLoggingHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("name")
+		opts := logging.AggregateOptions{
+			Namespace: ctx.URLParam("namespace"),
+			Selector:  ctx.URLParam("selector"),
+			Container: ctx.URLParam("containerName"),
+			TailLines: 100,
+		}
+		if opts.Namespace == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "namespace is required")
+			return
+		}
+		if ctx.URLParamExists("tailLines") {
+			lines, err := ctx.URLParamInt64("tailLines")
+			if err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				return
+			}
+			opts.TailLines = lines
+		}
+		if ctx.URLParamExists("follow") {
+			f, err := ctx.URLParamBool("follow")
+			if err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				return
+			}
+			opts.Follow = f
+		}
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, false) {
+			return
+		}
+		k := kubernetes.NewKubernetes(c)
+		namespaces, ok := userNamespaces(ctx, k)
+		if !ok {
+			return
+		}
+		if namespaces != nil && !namespaces.Exists(opts.Namespace) {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", fmt.Sprintf("namespace %s is not accessible", opts.Namespace))
+			return
+		}
+		client, err := k.Client()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		if kind := ctx.URLParam("kind"); kind != "" {
+			selector, err := workloadSelector(goContext.TODO(), client, kind, opts.Namespace, ctx.URLParam("workload"))
+			if err != nil {
+				writeWorkloadError(ctx, err)
+				return
+			}
+			opts.Selector = selector
+		}
+		sessionId, err := logging.GenLoggingSessionId()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		release, ok := commons.AcquireStream(ctx, clusterName)
+		if !ok {
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
 		logging.LogSessions.Set(sessionId, logging.LogSession{
 			Id:    sessionId,
 			Bound: make(chan error),
+			User:  profile.Name,
 		})
-		go logging.WaitForLoggingStream(client, namespace, podName, containerName, tailLines, follow, sessionId)
+		go func() {
+			defer release()
+			logging.WaitForAggregatedStream(client, opts, sessionId)
+		}()
 		ctx.Values().Set("data", TerminalResponse{ID: sessionId})
 	}
 }
@@ -0,0 +1,35 @@
+package cluster
+
+import (
+	goContext "context"
+	"testing"
+
+	appsV1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWorkloadSelector(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsV1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: appsV1.DeploymentSpec{Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "web"},
+			MatchExpressions: []metav1.LabelSelectorRequirement{{
+				Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"frontend"},
+			}},
+		}},
+	})
+	selector, err := workloadSelector(goContext.Background(), client, kindDeployments, "default", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selector != "app=web,tier in (frontend)" {
+		t.Errorf("unexpected selector %s", selector)
+	}
+	if _, err := workloadSelector(goContext.Background(), client, kindCronJobs, "default", "web"); err == nil {
+		t.Error("cronjobs should not be supported")
+	}
+	if _, err := workloadSelector(goContext.Background(), client, kindDeployments, "default", "api"); err == nil {
+		t.Error("missing workload should return an error")
+	}
+}
@@ -0,0 +1,194 @@
+package cluster
+
+import (
+	goContext "context"
+	"errors"
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/collectons"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/metrics"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// 默认返回的 top pod 数量
+const defaultTopPodNum = 10
+
+// MetricsResponse 集群未安装 metrics-server 时 Available 为 false,Items 为空
+type MetricsResponse struct {
+	Available bool        `json:"available"`
+	Message   string      `json:"message,omitempty"`
+	Items     interface{} `json:"items"`
+}
+
+type metricsScope struct {
+	client *metrics.Client
+	// 非空时只能查看这些 namespace 下的 pod
+	namespaces *collectons.StringSet
+}
+
+// metricsScope 生成 metrics 客户端并确定当前用户可以查看的 namespace
+func (h *Handler) metricsScope(ctx *context.Context) (*metricsScope, bool) {
+	name := ctx.Params().GetString("name")
+	c, err := h.clusterService.Get(name, common.DBOptions{})
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+		return nil, false
+	}
+	if !commons.CheckClusterAccess(ctx, c, false) {
+		return nil, false
+	}
+	// 集群和节点的用量不属于任何 namespace,只允许集群成员查看
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if !profile.IsAdministrator {
+		if _, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", fmt.Sprintf("user %s is not a member of cluster %s", profile.Name, c.Name))
+			return nil, false
+		}
+	}
+	k := kubernetes.NewKubernetes(c)
+	client, err := k.Client()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	namespaces, ok := userNamespaces(ctx, k)
+	if !ok {
+		return nil, false
+	}
+	return &metricsScope{client: metrics.NewClient(client), namespaces: namespaces}, true
+}
+
+// userNamespaces 返回当前用户可以访问的 namespace,可以访问所有 namespace 时返回 nil
+func userNamespaces(ctx *context.Context, k kubernetes.Interface) (*collectons.StringSet, bool) {
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if profile.IsAdministrator {
+		return nil, true
+	}
+	canVisitAll, err := k.CanVisitAllNamespace(profile.Name)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	if canVisitAll {
+		return nil, true
+	}
+	names, err := k.GetUserNamespaceNames(profile.Name)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	namespaces := collectons.NewStringSet()
+	for i := range names {
+		namespaces.Add(names[i])
+	}
+	return namespaces, true
+}
+
+// podUsages 返回用户有权限查看的 pod 用量
+func (s *metricsScope) podUsages(ctx goContext.Context, namespace string) ([]metrics.PodUsage, error) {
+	if s.namespaces != nil && namespace != "" && !s.namespaces.Exists(namespace) {
+		return []metrics.PodUsage{}, nil
+	}
+	pods, err := s.client.PodUsages(ctx, namespace)
+	if err != nil || s.namespaces == nil {
+		return pods, err
+	}
+	result := make([]metrics.PodUsage, 0, len(pods))
+	for i := range pods {
+		if s.namespaces.Exists(pods[i].Namespace) {
+			result = append(result, pods[i])
+		}
+	}
+	return result, nil
+}
+
+// writeMetrics 统一处理 metrics api 不可用的情况
+func writeMetrics(ctx *context.Context, items interface{}, err error) {
+	if errors.Is(err, metrics.ErrMetricsUnavailable) {
+		ctx.Values().Set("data", MetricsResponse{Available: false, Message: err.Error(), Items: []interface{}{}})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return
+	}
+	ctx.Values().Set("data", MetricsResponse{Available: true, Items: items})
+}
+
+// GetClusterMetricsSummary 集群整体的 CPU/内存实际用量
+func (h *Handler) GetClusterMetricsSummary() iris.Handler {
+	return func(ctx *context.Context) {
+		scope, ok := h.metricsScope(ctx)
+		if !ok {
+			return
+		}
+		nodes, err := scope.client.NodeUsages(ctx.Request().Context())
+		writeMetrics(ctx, metrics.Summarize(nodes), err)
+	}
+}
+
+// ListNodeMetrics 每个节点的实际用量
+func (h *Handler) ListNodeMetrics() iris.Handler {
+	return func(ctx *context.Context) {
+		scope, ok := h.metricsScope(ctx)
+		if !ok {
+			return
+		}
+		nodes, err := scope.client.NodeUsages(ctx.Request().Context())
+		writeMetrics(ctx, nodes, err)
+	}
+}
+
+// ListNamespaceMetrics 按 namespace 汇总的实际用量
+func (h *Handler) ListNamespaceMetrics() iris.Handler {
+	return func(ctx *context.Context) {
+		scope, ok := h.metricsScope(ctx)
+		if !ok {
+			return
+		}
+		pods, err := scope.podUsages(ctx.Request().Context(), "")
+		writeMetrics(ctx, metrics.GroupByNamespace(pods), err)
+	}
+}
+
+// ListWorkloadMetrics 按工作负载汇总的实际用量
+func (h *Handler) ListWorkloadMetrics() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace := ctx.URLParam("namespace")
+		scope, ok := h.metricsScope(ctx)
+		if !ok {
+			return
+		}
+		pods, err := scope.podUsages(ctx.Request().Context(), namespace)
+		if err == nil {
+			err = scope.client.ResolveWorkloads(ctx.Request().Context(), namespace, pods)
+		}
+		writeMetrics(ctx, metrics.GroupByWorkload(pods), err)
+	}
+}
+
+// ListTopPodMetrics 按 CPU 或内存用量排序的前 n 个 pod
+func (h *Handler) ListTopPodMetrics() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace := ctx.URLParam("namespace")
+		n := ctx.URLParamIntDefault("n", defaultTopPodNum)
+		sortBy := ctx.URLParamDefault("sortBy", metrics.SortByCPU)
+		scope, ok := h.metricsScope(ctx)
+		if !ok {
+			return
+		}
+		pods, err := scope.podUsages(ctx.Request().Context(), namespace)
+		writeMetrics(ctx, metrics.TopPods(pods, n, sortBy), err)
+	}
+}
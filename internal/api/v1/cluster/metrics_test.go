@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type fakeClusterService struct {
+	cluster.Service
+}
+
+func (f *fakeClusterService) Get(name string, _ common.DBOptions) (*v1Cluster.Cluster, error) {
+	return &v1Cluster.Cluster{Metadata: v1.Metadata{Name: name}}, nil
+}
+
+type fakeBindingService struct {
+	clusterbinding.Service
+	members map[string]bool
+}
+
+func (f *fakeBindingService) GetBindingByClusterNameAndUserName(_ string, userName string, _ common.DBOptions) (*v1Cluster.Binding, error) {
+	if f.members[userName] {
+		return &v1Cluster.Binding{}, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestMetricsNonMember(t *testing.T) {
+	h := &Handler{clusterService: &fakeClusterService{}, clusterBindingService: &fakeBindingService{}}
+	app := iris.New()
+	app.Use(func(ctx *context.Context) {
+		ctx.Values().Set("profile", session.UserProfile{Name: "bob"})
+		ctx.Next()
+	})
+	app.Get("/clusters/{name}/metrics/summary", h.GetClusterMetricsSummary())
+	app.Get("/clusters/{name}/metrics/nodes", h.ListNodeMetrics())
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/clusters/c1/metrics/summary", "/clusters/c1/metrics/nodes"} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s by a non-member: got %d, want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+}
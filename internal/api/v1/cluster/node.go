@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/asdine/storm/v3"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	k8sClient "k8s.io/client-go/kubernetes"
+)
+
+// userClient 以当前用户身份创建集群客户端,操作节点的权限由集群的 RBAC 控制
+func (h *Handler) userClient(ctx *context.Context, write bool) (k8sClient.Interface, bool) {
+	name := ctx.Params().GetString("name")
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	c, err := h.clusterService.Get(name, common.DBOptions{})
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+		return nil, false
+	}
+	if !commons.CheckClusterAccess(ctx, c, write) {
+		return nil, false
+	}
+	cfg, err := commons.UserRestConfig(c, profile)
+	if errors.Is(err, storm.ErrNotFound) {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.Values().Set("message", fmt.Sprintf("user %s is not a member of cluster %s", profile.Name, name))
+		return nil, false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	client, err := k8sClient.NewForConfig(cfg)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	return client, true
+}
+
+func (h *Handler) cordonNodeHandler(unschedulable bool) iris.Handler {
+	return func(ctx *context.Context) {
+		node := ctx.Params().GetString("node")
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		if err := cordonNode(ctx.Request().Context(), client, node, unschedulable); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", node)
+	}
+}
+
+// CordonNode 禁止调度
+func (h *Handler) CordonNode() iris.Handler {
+	return h.cordonNodeHandler(true)
+}
+
+// UncordonNode 恢复调度
+func (h *Handler) UncordonNode() iris.Handler {
+	return h.cordonNodeHandler(false)
+}
+
+// DrainNode 在后台排空节点,返回任务用于查询进度
+func (h *Handler) DrainNode() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		node := ctx.Params().GetString("node")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		var options DrainOptions
+		if ctx.GetContentLength() > 0 {
+			if err := ctx.ReadJSON(&options); err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		task, created := drainTasks.add(newDrainTask(name, node, profile.Name, options))
+		if !created {
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.Values().Set("message", fmt.Sprintf("node %s is draining, task id: %s", node, task.snapshot().ID))
+			return
+		}
+		go runDrainTask(client, task)
+		ctx.Values().Set("data", task.snapshot())
+	}
+}
+
+// GetDrainTask 查询排空任务的进度以及每个 pod 的结果
+func (h *Handler) GetDrainTask() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		node := ctx.Params().GetString("node")
+		id := ctx.Params().GetString("task")
+		task, ok := drainTasks.get(id)
+		var snap DrainTask
+		if ok {
+			snap = task.snapshot()
+		}
+		if !ok || snap.Cluster != name || snap.Node != node {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", fmt.Sprintf("drain task %s not found", id))
+			return
+		}
+		ctx.Values().Set("data", snap)
+	}
+}
@@ -0,0 +1,230 @@
+package cluster
+
+import (
+	goContext "context"
+	"fmt"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sClient "k8s.io/client-go/kubernetes"
+)
+
+const (
+	nodeShellContainer      = "shell"
+	nodeShellComponentKey   = "kubepi.kubeoperator.io/component"
+	nodeShellNodeAnnotation = "kubepi.kubeoperator.io/node"
+	// 删除节点终端 pod 的超时时间
+	nodeShellDeleteTimeout = 30 * time.Second
+	// 未配置时等待容器启动的超时时间
+	defaultContainerStartTimeout = 60 * time.Second
+)
+
+// containerWaitingFailures 容器处于这些状态时不会自动恢复,不再等待容器启动
+var containerWaitingFailures = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// nodeShellPod 创建固定在节点上的特权 pod,通过 nsenter 进入节点的命名空间
+func nodeShellPod(name, node string, conf v1Config.NodeShellConfig) *coreV1.Pod {
+	if conf.Namespace == "" {
+		conf.Namespace = metav1.NamespaceSystem
+	}
+	privileged := true
+	var gracePeriod int64
+	pod := &coreV1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   conf.Namespace,
+			Labels:      map[string]string{"app.kubernetes.io/managed-by": "kubepi", nodeShellComponentKey: "node-shell"},
+			Annotations: map[string]string{nodeShellNodeAnnotation: node},
+		},
+		Spec: coreV1.PodSpec{
+			NodeName:                      node,
+			HostPID:                       true,
+			HostNetwork:                   true,
+			HostIPC:                       true,
+			RestartPolicy:                 coreV1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: &gracePeriod,
+			Tolerations:                   []coreV1.Toleration{{Operator: coreV1.TolerationOpExists}},
+			Containers: []coreV1.Container{{
+				Name:            nodeShellContainer,
+				Image:           conf.Image,
+				ImagePullPolicy: coreV1.PullIfNotPresent,
+				Command:         []string{"sleep", fmt.Sprint(conf.MaxDuration)},
+				SecurityContext: &coreV1.SecurityContext{Privileged: &privileged},
+			}},
+		},
+	}
+	if conf.MaxDuration > 0 {
+		deadline := int64(conf.MaxDuration)
+		pod.Spec.ActiveDeadlineSeconds = &deadline
+	} else {
+		pod.Spec.Containers[0].Command = []string{"sh", "-c", "while true; do sleep 3600; done"}
+	}
+	return pod
+}
+
+// nodeShellCommand 在节点的命名空间中执行 shell,未指定 shell 时优先使用 bash
+func nodeShellCommand(shell string) []string {
+	cmd := []string{"nsenter", "--target", "1", "--mount", "--uts", "--ipc", "--net", "--pid", "--"}
+	if shell != "" {
+		return append(cmd, shell)
+	}
+	return append(cmd, "sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash -l; else exec sh -l; fi")
+}
+
+// waitForContainerRunning 等待 pod 中的容器运行,包括临时容器,容器无法启动时提前返回错误
+func waitForContainerRunning(ctx goContext.Context, client k8sClient.Interface, namespace, name, container string, timeout time.Duration) error {
+	var lastErr error
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		pod, err := client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		if pod.Status.Phase == coreV1.PodFailed || pod.Status.Phase == coreV1.PodSucceeded {
+			return false, fmt.Errorf("pod %s exited: %s", name, pod.Status.Reason)
+		}
+		statuses := append(pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses...)
+		for _, status := range statuses {
+			if status.Name != container {
+				continue
+			}
+			if status.State.Running != nil {
+				return true, nil
+			}
+			if status.State.Terminated != nil {
+				return false, fmt.Errorf("container %s exited: %s", container, status.State.Terminated.Reason)
+			}
+			if status.State.Waiting != nil && containerWaitingFailures[status.State.Waiting.Reason] {
+				return false, fmt.Errorf("container %s can not start: %s %s", container, status.State.Waiting.Reason, status.State.Waiting.Message)
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return fmt.Errorf("wait for container %s running timeout: %s", container, lastErr.Error())
+	}
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("wait for container %s running timeout", container)
+	}
+	return err
+}
+
+func deleteNodeShellPod(client k8sClient.Interface, namespace, name string) {
+	ctx, cancel := goContext.WithTimeout(goContext.Background(), nodeShellDeleteTimeout)
+	defer cancel()
+	var gracePeriod int64
+	if err := client.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}); err != nil {
+		server.Logger().Errorf("delete node shell pod %s/%s failed: %s", namespace, name, err.Error())
+	}
+}
+
+// NodeShellSessionHandler 创建节点终端会话,只有管理员可以使用
+func (h *Handler) NodeShellSessionHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("name")
+		node := ctx.Params().GetString("node")
+		shell := ctx.URLParam("shell")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if !profile.IsAdministrator {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", []string{"permission %s required", "admin"})
+			return
+		}
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, true) {
+			return
+		}
+		k := kubernetes.NewKubernetes(c)
+		conf, err := k.Config()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		client, err := k.Client()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		limits, ok := checkTerminalLimits(ctx, clusterName)
+		if !ok {
+			return
+		}
+		if _, err := client.CoreV1().Nodes().Get(ctx.Request().Context(), node, metav1.GetOptions{}); err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		sessionID, err := terminal.GenTerminalSessionId()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		release, ok := commons.AcquireStream(ctx, clusterName)
+		if !ok {
+			return
+		}
+
+		shellConf := server.Config().Spec.Terminal.NodeShell
+		pod := nodeShellPod("kubepi-node-shell-"+sessionID[:10], node, shellConf)
+		if _, err := client.CoreV1().Pods(pod.Namespace).Create(ctx.Request().Context(), pod, metav1.CreateOptions{}); err != nil {
+			release()
+			writeWorkloadError(ctx, err)
+			return
+		}
+		startTimeout := time.Duration(shellConf.StartTimeout) * time.Second
+		if startTimeout <= 0 {
+			startTimeout = defaultContainerStartTimeout
+		}
+		if err := waitForContainerRunning(ctx.Request().Context(), client, pod.Namespace, pod.Name, nodeShellContainer, startTimeout); err != nil {
+			release()
+			deleteNodeShellPod(client, pod.Namespace, pod.Name)
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		finishRecording, ok := openTerminal(ctx, sessionID, limits, terminalTarget{
+			cluster:   clusterName,
+			namespace: pod.Namespace,
+			pod:       pod.Name,
+			container: nodeShellContainer,
+			shell:     shell,
+		})
+		if !ok {
+			release()
+			deleteNodeShellPod(client, pod.Namespace, pod.Name)
+			return
+		}
+		go func() {
+			defer release()
+			defer deleteNodeShellPod(client, pod.Namespace, pod.Name)
+			defer finishRecording()
+			terminal.WaitForCommand(client, conf, pod.Namespace, pod.Name, nodeShellContainer, sessionID, nodeShellCommand(shell))
+		}()
+		ctx.Values().Set("data", TerminalResponse{ID: sessionID})
+	}
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	goContext "context"
+	"strings"
+	"testing"
+	"time"
+
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	coreV1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeShellPod(t *testing.T) {
+	pod := nodeShellPod("kubepi-node-shell-1", "node-1", v1Config.NodeShellConfig{Image: "alpine:3.13", MaxDuration: 60})
+	if pod.Namespace != "kube-system" || pod.Spec.NodeName != "node-1" || !pod.Spec.HostPID || !pod.Spec.HostNetwork {
+		t.Errorf("unexpected pod %+v", pod.Spec)
+	}
+	if c := pod.Spec.Containers[0]; !*c.SecurityContext.Privileged || c.Image != "alpine:3.13" || *pod.Spec.ActiveDeadlineSeconds != 60 {
+		t.Errorf("unexpected container %+v", c)
+	}
+	if cmd := strings.Join(nodeShellCommand("bash"), " "); cmd != "nsenter --target 1 --mount --uts --ipc --net --pid -- bash" {
+		t.Errorf("unexpected command %s", cmd)
+	}
+}
+
+func TestWaitForContainerRunning(t *testing.T) {
+	pod := func(name string, status coreV1.PodStatus) *coreV1.Pod {
+		return &coreV1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: name}, Status: status}
+	}
+	client := fake.NewSimpleClientset(
+		pod("running", coreV1.PodStatus{Phase: coreV1.PodRunning, ContainerStatuses: []coreV1.ContainerStatus{{
+			Name: "shell", State: coreV1.ContainerState{Running: &coreV1.ContainerStateRunning{}},
+		}}}),
+		pod("pull", coreV1.PodStatus{Phase: coreV1.PodRunning, EphemeralContainerStatuses: []coreV1.ContainerStatus{{
+			Name: "debugger", State: coreV1.ContainerState{Waiting: &coreV1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}}}),
+	)
+	ctx := goContext.Background()
+	if err := waitForContainerRunning(ctx, client, "kube-system", "running", "shell", time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := waitForContainerRunning(ctx, client, "kube-system", "pull", "debugger", time.Minute); err == nil || !strings.Contains(err.Error(), "ImagePullBackOff") {
+		t.Errorf("image pull error should be returned, got %v", err)
+	}
+	if err := waitForContainerRunning(ctx, client, "kube-system", "missing", "shell", time.Second); err == nil {
+		t.Error("missing pod should time out")
+	}
+}
@@ -0,0 +1,267 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/prometheus"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// 默认查询最近一小时
+	defaultSeriesRange = time.Hour
+	// 默认每条序列返回的点数
+	defaultSeriesPoints = 120
+	minSeriesStep       = 15 * time.Second
+	// Prometheus 单次查询最多返回 11000 个点
+	maxSeriesPoints = 11000
+)
+
+// UpdateClusterPrometheus 配置集群的 Prometheus,只有管理员可以操作
+func (h *Handler) UpdateClusterPrometheus() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if !profile.IsAdministrator {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", []string{"permission %s required", "admin"})
+			return
+		}
+		var req v1Cluster.Prometheus
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if err := validatePrometheus(req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		c, err := h.clusterService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		keepPrometheusSecrets(&req, c.Spec.Prometheus)
+		c.Spec.Prometheus = req
+		if err := h.clusterService.Update(name, c, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", hidePrometheusSecrets(c.Spec.Prometheus))
+	}
+}
+
+// hidePrometheusSecrets 返回的配置中不包含密码和 token
+func hidePrometheusSecrets(p v1Cluster.Prometheus) v1Cluster.Prometheus {
+	p.Password = ""
+	p.BearerToken = ""
+	return p
+}
+
+// keepPrometheusSecrets 认证方式不变且请求中的密码或 token 为空时沿用已保存的值
+func keepPrometheusSecrets(req *v1Cluster.Prometheus, saved v1Cluster.Prometheus) {
+	if req.AuthMode != saved.AuthMode {
+		return
+	}
+	if req.Password == "" && req.Username == saved.Username {
+		req.Password = saved.Password
+	}
+	if req.BearerToken == "" {
+		req.BearerToken = saved.BearerToken
+	}
+}
+
+func validatePrometheus(p v1Cluster.Prometheus) error {
+	if !p.Enable {
+		return nil
+	}
+	switch p.AuthMode {
+	case v1Cluster.PrometheusAuthNone, v1Cluster.PrometheusAuthBasic, v1Cluster.PrometheusAuthBearer:
+	default:
+		return fmt.Errorf("unknown auth mode %s", p.AuthMode)
+	}
+	if p.ServiceProxy.Enable {
+		if p.ServiceProxy.Namespace == "" || p.ServiceProxy.Service == "" {
+			return fmt.Errorf("namespace and service are required when using service proxy")
+		}
+		return nil
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid prometheus url %s", p.URL)
+	}
+	return nil
+}
+
+// newPrometheusClient 根据集群配置创建 Prometheus 客户端,通过 service proxy 访问时使用集群的管理员凭据
+func newPrometheusClient(c *v1Cluster.Cluster) (*prometheus.Client, error) {
+	p := c.Spec.Prometheus
+	if p.ServiceProxy.Enable {
+		cfg, err := kubernetes.NewKubernetes(c).Config()
+		if err != nil {
+			return nil, err
+		}
+		rt, err := rest.TransportFor(cfg)
+		if err != nil {
+			return nil, err
+		}
+		scheme := p.ServiceProxy.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		address := fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s:%s:%s/proxy",
+			strings.TrimSuffix(cfg.Host, "/"), p.ServiceProxy.Namespace, scheme, p.ServiceProxy.Service, p.ServiceProxy.Port)
+		return prometheus.NewClient(address, rt)
+	}
+	var rt http.RoundTripper = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: p.InsecureSkipVerify},
+	}
+	switch p.AuthMode {
+	case v1Cluster.PrometheusAuthBasic:
+		rt = &prometheus.BasicAuthRoundTripper{Username: p.Username, Password: p.Password, Next: rt}
+	case v1Cluster.PrometheusAuthBearer:
+		rt = &prometheus.BearerTokenRoundTripper{Token: p.BearerToken, Next: rt}
+	}
+	return prometheus.NewClient(p.URL, rt)
+}
+
+// parseSeriesRange 解析 start、end(unix 秒) 以及 step(秒),返回查询范围和 rate 使用的时间窗口
+func parseSeriesRange(ctx *context.Context) (time.Time, time.Time, time.Duration, error) {
+	end := time.Now()
+	if ctx.URLParamExists("end") {
+		v, err := ctx.URLParamInt64("end")
+		if err != nil {
+			return end, end, 0, fmt.Errorf("invalid end")
+		}
+		end = time.Unix(v, 0)
+	}
+	start := end.Add(-defaultSeriesRange)
+	if ctx.URLParamExists("start") {
+		v, err := ctx.URLParamInt64("start")
+		if err != nil {
+			return start, end, 0, fmt.Errorf("invalid start")
+		}
+		start = time.Unix(v, 0)
+	}
+	if !end.After(start) {
+		return start, end, 0, fmt.Errorf("end must be after start")
+	}
+	step := end.Sub(start) / defaultSeriesPoints
+	if ctx.URLParamExists("step") {
+		v, err := ctx.URLParamInt64("step")
+		if err != nil {
+			return start, end, 0, fmt.Errorf("invalid step")
+		}
+		step = time.Duration(v) * time.Second
+	}
+	if step < minSeriesStep {
+		step = minSeriesStep
+	}
+	if end.Sub(start)/step > maxSeriesPoints {
+		return start, end, 0, fmt.Errorf("too many points, please increase step")
+	}
+	return start, end, step, nil
+}
+
+// rateWindow rate 的窗口至少覆盖两个步长,且不小于 1 分钟
+func rateWindow(step time.Duration) string {
+	window := 2 * step
+	if window < time.Minute {
+		window = time.Minute
+	}
+	return fmt.Sprintf("%ds", int(window.Seconds()))
+}
+
+// QueryClusterPrometheus 使用内置 PromQL 模版查询节点、pod、工作负载或 namespace 的时间序列
+func (h *Handler) QueryClusterPrometheus() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		target := ctx.URLParam("target")
+		metric := ctx.URLParam("metric")
+		params := prometheus.Params{
+			Node:      ctx.URLParam("node"),
+			Namespace: ctx.URLParam("namespace"),
+			Pod:       ctx.URLParam("pod"),
+			Kind:      ctx.URLParam("kind"),
+			Workload:  ctx.URLParam("workload"),
+		}
+		start, end, step, err := parseSeriesRange(ctx)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		params.Window = rateWindow(step)
+		queries, err := prometheus.Render(target, metric, params)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		c, err := h.clusterService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, false) {
+			return
+		}
+		if !c.Spec.Prometheus.Enable {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("prometheus is not configured for cluster %s", name))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if target == prometheus.TargetNode {
+			// 节点的监控数据不属于任何 namespace,只允许集群成员查看
+			if !profile.IsAdministrator {
+				if _, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{}); err != nil {
+					ctx.StatusCode(iris.StatusForbidden)
+					ctx.Values().Set("message", fmt.Sprintf("user %s is not a member of cluster %s", profile.Name, c.Name))
+					return
+				}
+			}
+		} else {
+			namespaces, ok := userNamespaces(ctx, kubernetes.NewKubernetes(c))
+			if !ok {
+				return
+			}
+			if namespaces != nil && !namespaces.Exists(params.Namespace) {
+				ctx.StatusCode(iris.StatusForbidden)
+				ctx.Values().Set("message", []string{"user %s can not access resource %s %s", profile.Name, "namespace", params.Namespace})
+				return
+			}
+		}
+		client, err := newPrometheusClient(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		series, err := client.QueryRange(ctx.Request().Context(), queries, start, end, step)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadGateway)
+			ctx.Values().Set("message", fmt.Sprintf("query prometheus failed: %s", err.Error()))
+			return
+		}
+		ctx.Values().Set("data", series)
+	}
+}
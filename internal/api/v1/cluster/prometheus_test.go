@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"testing"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+)
+
+func TestPrometheusSecrets(t *testing.T) {
+	saved := v1Cluster.Prometheus{AuthMode: v1Cluster.PrometheusAuthBasic, Username: "admin", Password: "secret"}
+	if p := hidePrometheusSecrets(saved); p.Password != "" || p.Username != "admin" {
+		t.Errorf("unexpected response %+v", p)
+	}
+
+	// 回传隐藏后的配置时保留已保存的密码
+	req := hidePrometheusSecrets(saved)
+	keepPrometheusSecrets(&req, saved)
+	if req.Password != "secret" {
+		t.Errorf("saved password should be kept, got %q", req.Password)
+	}
+	req = v1Cluster.Prometheus{AuthMode: v1Cluster.PrometheusAuthBasic, Username: "admin", Password: "new"}
+	keepPrometheusSecrets(&req, saved)
+	if req.Password != "new" {
+		t.Errorf("password should be updated, got %q", req.Password)
+	}
+	req = v1Cluster.Prometheus{AuthMode: v1Cluster.PrometheusAuthBasic, Username: "other"}
+	keepPrometheusSecrets(&req, saved)
+	if req.Password != "" {
+		t.Error("saved password should not be used for another user")
+	}
+	req = v1Cluster.Prometheus{AuthMode: v1Cluster.PrometheusAuthBearer}
+	keepPrometheusSecrets(&req, saved)
+	if req.Password != "" || req.BearerToken != "" {
+		t.Error("saved secrets should not be kept when the auth mode changes")
+	}
+}
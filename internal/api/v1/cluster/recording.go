@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	terminalService "github.com/KubeOperator/kubepi/internal/service/v1/terminal"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+)
+
+var recordingService = terminalService.NewService()
+
+// startRecording 开启录像时创建录像文件和记录,返回的函数在会话结束时调用
+func startRecording(recording v1Terminal.Recording) (*terminal.Recorder, func()) {
+	conf := server.Config().Spec.Terminal.Recording
+	if !conf.Enable {
+		return nil, func() {}
+	}
+	recording.Name = recording.SessionID
+	recording.BaseModel = v1.BaseModel{ApiVersion: "v1", Kind: "TerminalRecording", CreatedBy: recording.User}
+	recording.StartTime = time.Now()
+	recording.RecordStdin = conf.RecordStdin
+	recording.Path = filepath.Join(conf.Path, recording.StartTime.Format("2006-01-02"), recording.SessionID+".cast")
+	title := fmt.Sprintf("%s/%s/%s/%s", recording.Cluster, recording.Namespace, recording.Pod, recording.Container)
+	recorder, err := terminal.NewRecorder(recording.Path, title, recording.Shell, conf.RecordStdin)
+	if err != nil {
+		server.Logger().Errorf("create terminal recording %s failed: %s", recording.Path, err.Error())
+		return nil, func() {}
+	}
+	if err := recordingService.CreateRecording(&recording, common.DBOptions{}); err != nil {
+		server.Logger().Errorf("save terminal recording %s failed: %s", recording.SessionID, err.Error())
+	}
+	return recorder, func() {
+		if err := recorder.Close(); err != nil {
+			server.Logger().Errorf("close terminal recording %s failed: %s", recording.Path, err.Error())
+		}
+		if err := recordingService.FinishRecording(recording.Name, time.Now(), recorder.Size(), common.DBOptions{}); err != nil {
+			server.Logger().Errorf("update terminal recording %s failed: %s", recording.SessionID, err.Error())
+		}
+	}
+}
+
+// startCommandAudit 开启命令审计时记录会话中执行的命令,命令匹配黑名单时阻断会话
+// 无法创建审计时返回错误,此时不允许打开终端
+func startCommandAudit(command v1Terminal.Command) (*terminal.CommandAuditor, error) {
+	conf := server.Config().Spec.Terminal.Audit
+	if !conf.Enable {
+		return nil, nil
+	}
+	auditor, err := terminal.NewCommandAuditor(conf.DenyList, func(line string, blocked bool) {
+		c := command
+		c.BaseModel = v1.BaseModel{ApiVersion: "v1", Kind: "TerminalCommand", CreatedBy: command.User}
+		c.Command = line
+		c.Blocked = blocked
+		c.Time = time.Now()
+		if err := recordingService.CreateCommand(&c, common.DBOptions{}); err != nil {
+			server.Logger().Errorf("save terminal command of session %s failed: %s", command.SessionID, err.Error())
+		}
+	})
+	if err != nil {
+		server.Logger().Errorf("invalid terminal command deny list: %s", err.Error())
+		return nil, err
+	}
+	return auditor, nil
+}
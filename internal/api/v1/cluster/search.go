@@ -0,0 +1,363 @@
+package cluster
+
+import (
+	goContext "context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// 同时搜索的集群数量
+	globalSearchConcurrency = 10
+	defaultSearchTimeout    = 10 * time.Second
+	maxSearchTimeout        = 60 * time.Second
+	defaultSearchLimit      = 500
+)
+
+// searchableKind 可以搜索的资源,podSpecPath 为空的资源不支持按镜像搜索
+type searchableKind struct {
+	Kind        string
+	GVR         schema.GroupVersionResource
+	Fallback    *schema.GroupVersionResource
+	PodSpecPath []string
+}
+
+var searchableKinds = map[string]searchableKind{
+	"pods": {Kind: "Pod", GVR: schema.GroupVersionResource{Version: "v1", Resource: "pods"},
+		PodSpecPath: []string{"spec"}},
+	"deployments": {Kind: "Deployment", GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		PodSpecPath: []string{"spec", "template", "spec"}},
+	"statefulsets": {Kind: "StatefulSet", GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"},
+		PodSpecPath: []string{"spec", "template", "spec"}},
+	"daemonsets": {Kind: "DaemonSet", GVR: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"},
+		PodSpecPath: []string{"spec", "template", "spec"}},
+	"jobs": {Kind: "Job", GVR: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"},
+		PodSpecPath: []string{"spec", "template", "spec"}},
+	"cronjobs": {Kind: "CronJob", GVR: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"},
+		Fallback:    &schema.GroupVersionResource{Group: "batch", Version: "v1beta1", Resource: "cronjobs"},
+		PodSpecPath: []string{"spec", "jobTemplate", "spec", "template", "spec"}},
+	"services": {Kind: "Service", GVR: schema.GroupVersionResource{Version: "v1", Resource: "services"}},
+	"ingresses": {Kind: "Ingress", GVR: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+		Fallback: &schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"}},
+	"configmaps": {Kind: "ConfigMap", GVR: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+	"secrets":    {Kind: "Secret", GVR: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}},
+}
+
+var defaultSearchKinds = []string{"pods", "deployments", "statefulsets", "daemonsets", "jobs", "cronjobs", "services", "ingresses"}
+
+// GlobalSearchRequest 名称、标签选择器和镜像至少需要指定一个,多个条件同时满足才会返回
+type GlobalSearchRequest struct {
+	// 为空时搜索所有可以访问的集群
+	Clusters      []string `json:"clusters"`
+	Kinds         []string `json:"kinds"`
+	Namespace     string   `json:"namespace"`
+	Name          string   `json:"name"`
+	LabelSelector string   `json:"labelSelector"`
+	Image         string   `json:"image"`
+	// 每个集群的超时时间
+	TimeoutSeconds int `json:"timeoutSeconds"`
+	Limit          int `json:"limit"`
+}
+
+type GlobalSearchResult struct {
+	Cluster           string            `json:"cluster"`
+	Namespace         string            `json:"namespace"`
+	Kind              string            `json:"kind"`
+	Name              string            `json:"name"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Images            []string          `json:"images,omitempty"`
+	CreationTimestamp time.Time         `json:"creationTimestamp"`
+}
+
+type GlobalSearchError struct {
+	Cluster string `json:"cluster"`
+	Message string `json:"message"`
+}
+
+type GlobalSearchResponse struct {
+	Items     []GlobalSearchResult `json:"items"`
+	Errors    []GlobalSearchError  `json:"errors"`
+	Truncated bool                 `json:"truncated"`
+}
+
+// searchTarget 一个集群的搜索范围,namespaces 为空时搜索所有 namespace
+type searchTarget struct {
+	cluster    string
+	client     dynamic.Interface
+	namespaces []string
+}
+
+func (r *GlobalSearchRequest) validate() error {
+	if r.Name == "" && r.LabelSelector == "" && r.Image == "" {
+		return fmt.Errorf("one of name, labelSelector and image is required")
+	}
+	if r.LabelSelector != "" {
+		if _, err := labels.Parse(r.LabelSelector); err != nil {
+			return fmt.Errorf("invalid label selector: %s", err.Error())
+		}
+	}
+	if len(r.Kinds) == 0 {
+		r.Kinds = defaultSearchKinds
+	}
+	for i := range r.Kinds {
+		if _, ok := searchableKinds[r.Kinds[i]]; !ok {
+			return fmt.Errorf("unsupported kind %s", r.Kinds[i])
+		}
+	}
+	if r.TimeoutSeconds <= 0 {
+		r.TimeoutSeconds = int(defaultSearchTimeout.Seconds())
+	}
+	if time.Duration(r.TimeoutSeconds)*time.Second > maxSearchTimeout {
+		r.TimeoutSeconds = int(maxSearchTimeout.Seconds())
+	}
+	if r.Limit <= 0 {
+		r.Limit = defaultSearchLimit
+	}
+	return nil
+}
+
+func matchImage(images []string, image string) bool {
+	for i := range images {
+		if strings.Contains(images[i], image) {
+			return true
+		}
+	}
+	return false
+}
+
+func containerImages(obj unstructured.Unstructured, podSpecPath []string) []string {
+	var images []string
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(obj.Object, append(append([]string{}, podSpecPath...), field)...)
+		for i := range containers {
+			if c, ok := containers[i].(map[string]interface{}); ok {
+				if image, ok := c["image"].(string); ok {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	return images
+}
+
+// listKind 列出资源,集群不支持时使用旧的 api 版本
+func listKind(ctx goContext.Context, client dynamic.Interface, kind searchableKind, namespace string, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list, err := client.Resource(kind.GVR).Namespace(namespace).List(ctx, opts)
+	if err != nil && kind.Fallback != nil && apierrors.IsNotFound(err) {
+		return client.Resource(*kind.Fallback).Namespace(namespace).List(ctx, opts)
+	}
+	return list, err
+}
+
+// searchCluster 在一个集群中按请求的条件搜索资源
+func searchCluster(ctx goContext.Context, target searchTarget, req GlobalSearchRequest) ([]GlobalSearchResult, error) {
+	namespaces := target.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	if req.Namespace != "" {
+		if len(target.namespaces) > 0 && !containsString(target.namespaces, req.Namespace) {
+			return []GlobalSearchResult{}, nil
+		}
+		namespaces = []string{req.Namespace}
+	}
+	name := strings.ToLower(req.Name)
+	result := make([]GlobalSearchResult, 0)
+	var errs []string
+	for _, k := range req.Kinds {
+		kind := searchableKinds[k]
+		if req.Image != "" && kind.PodSpecPath == nil {
+			continue
+		}
+		for _, namespace := range namespaces {
+			list, err := listKind(ctx, target.client, kind, namespace, metav1.ListOptions{LabelSelector: req.LabelSelector})
+			// 没有权限列出某种资源时继续搜索其他资源
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("list %s failed: %s", k, err.Error()))
+				continue
+			}
+			for i := range list.Items {
+				item := list.Items[i]
+				if name != "" && !strings.Contains(strings.ToLower(item.GetName()), name) {
+					continue
+				}
+				var images []string
+				if kind.PodSpecPath != nil {
+					images = containerImages(item, kind.PodSpecPath)
+				}
+				if req.Image != "" && !matchImage(images, req.Image) {
+					continue
+				}
+				result = append(result, GlobalSearchResult{
+					Cluster:           target.cluster,
+					Namespace:         item.GetNamespace(),
+					Kind:              kind.Kind,
+					Name:              item.GetName(),
+					Labels:            item.GetLabels(),
+					Images:            images,
+					CreationTimestamp: item.GetCreationTimestamp().Time,
+				})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+func containsString(items []string, s string) bool {
+	for i := range items {
+		if items[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// globalSearch 并发搜索所有集群,单个集群失败或超时不影响其他集群的结果
+func globalSearch(targets []searchTarget, req GlobalSearchRequest) GlobalSearchResponse {
+	resp := GlobalSearchResponse{Items: []GlobalSearchResult{}, Errors: []GlobalSearchError{}}
+	var mu sync.Mutex
+	sem := make(chan struct{}, globalSearchConcurrency)
+	wg := sync.WaitGroup{}
+	for i := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target searchTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ctx, cancel := goContext.WithTimeout(goContext.Background(), time.Duration(req.TimeoutSeconds)*time.Second)
+			defer cancel()
+			items, err := searchCluster(ctx, target, req)
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Items = append(resp.Items, items...)
+			if err != nil {
+				resp.Errors = append(resp.Errors, GlobalSearchError{Cluster: target.cluster, Message: err.Error()})
+			}
+		}(targets[i])
+	}
+	wg.Wait()
+	sort.Slice(resp.Items, func(i, j int) bool {
+		a, b := resp.Items[i], resp.Items[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(resp.Errors, func(i, j int) bool {
+		return resp.Errors[i].Cluster < resp.Errors[j].Cluster
+	})
+	if len(resp.Items) > req.Limit {
+		resp.Items = resp.Items[:req.Limit]
+		resp.Truncated = true
+	}
+	return resp
+}
+
+// searchTargetOf 以当前用户身份创建集群客户端,不能访问所有 namespace 的用户只搜索被授权的 namespace
+func (h *Handler) searchTargetOf(c *v1Cluster.Cluster, profile session.UserProfile) (searchTarget, error) {
+	target := searchTarget{cluster: c.Name}
+	if !profile.IsAdministrator {
+		if _, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{}); err != nil {
+			return target, fmt.Errorf("user %s is not a member of cluster %s", profile.Name, c.Name)
+		}
+		k := kubernetes.NewKubernetes(c)
+		canVisitAll, err := k.CanVisitAllNamespace(profile.Name)
+		if err != nil {
+			return target, err
+		}
+		if !canVisitAll {
+			namespaces, err := k.GetUserNamespaceNames(profile.Name)
+			if err != nil {
+				return target, err
+			}
+			if len(namespaces) == 0 {
+				return target, fmt.Errorf("user %s can not access any namespace of cluster %s", profile.Name, c.Name)
+			}
+			target.namespaces = namespaces
+		}
+	}
+	cfg, err := commons.UserRestConfig(c, profile)
+	if err != nil {
+		return target, err
+	}
+	target.client, err = dynamic.NewForConfig(cfg)
+	return target, err
+}
+
+// GlobalSearch 跨集群搜索资源,返回资源所在的集群、namespace、类型和名称
+func (h *Handler) GlobalSearch() iris.Handler {
+	return func(ctx *context.Context) {
+		var req GlobalSearchRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if err := req.validate(); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		clusters, err := h.clusterService.List(common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		var targets []searchTarget
+		var errs []GlobalSearchError
+		for i := range clusters {
+			c := clusters[i]
+			if len(req.Clusters) > 0 && !containsString(req.Clusters, c.Name) {
+				continue
+			}
+			if c.Status.Phase == clusterStatusInitializing || commons.ActiveAccessMode(c.Spec.AccessMode, time.Now()) == v1Cluster.AccessModeMaintenance {
+				continue
+			}
+			// 未指定集群时跳过没有权限的集群,指定的集群没有权限时返回错误
+			if !profile.IsAdministrator && len(req.Clusters) == 0 {
+				if _, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{}); err != nil {
+					continue
+				}
+			}
+			target, err := h.searchTargetOf(&c, profile)
+			if err != nil {
+				errs = append(errs, GlobalSearchError{Cluster: c.Name, Message: err.Error()})
+				continue
+			}
+			targets = append(targets, target)
+		}
+		resp := globalSearch(targets, req)
+		resp.Errors = append(resp.Errors, errs...)
+		ctx.Values().Set("data", resp)
+	}
+}
@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func newSearchFakeClient(objects ...runtime.Object) *dynamicFake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, kind := range searchableKinds {
+		listKinds[kind.GVR] = kind.Kind + "List"
+	}
+	return dynamicFake.NewSimpleDynamicClientWithCustomListKinds(scheme.Scheme, listKinds, objects...)
+}
+
+func newDeployment(namespace, name, image string, labels map[string]string) *appsV1.Deployment {
+	d := &appsV1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+	d.Spec.Template.Spec.Containers = []coreV1.Container{{Name: name, Image: image}}
+	return d
+}
+
+func TestGlobalSearch(t *testing.T) {
+	c1 := newSearchFakeClient(
+		newDeployment("default", "order-api", "registry/order:v1", map[string]string{"app": "order"}),
+		newDeployment("kube-system", "coredns", "coredns:1.8", nil),
+		&coreV1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "order-api", Labels: map[string]string{"app": "order"}}},
+	)
+	c2 := newSearchFakeClient(newDeployment("shop", "order-api", "registry/order:v2", map[string]string{"app": "order"}))
+	broken := newSearchFakeClient()
+	broken.PrependReactor("list", "*", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "deployments"}, "", errors.New("forbidden"))
+	})
+	targets := []searchTarget{
+		{cluster: "c1", client: c1},
+		{cluster: "c2", client: c2, namespaces: []string{"shop"}},
+		{cluster: "broken", client: broken},
+	}
+
+	req := GlobalSearchRequest{Name: "ORDER"}
+	if err := req.validate(); err != nil {
+		t.Fatal(err)
+	}
+	resp := globalSearch(targets, req)
+	if len(resp.Items) != 3 || resp.Items[0].Cluster != "c1" || resp.Items[0].Kind != "Deployment" || resp.Items[1].Kind != "Service" {
+		t.Fatalf("unexpected search result %+v", resp.Items)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Cluster != "broken" {
+		t.Errorf("unexpected errors %+v", resp.Errors)
+	}
+
+	req = GlobalSearchRequest{Image: "order:v2", LabelSelector: "app=order"}
+	if err := req.validate(); err != nil {
+		t.Fatal(err)
+	}
+	resp = globalSearch(targets[:2], req)
+	if len(resp.Items) != 1 || resp.Items[0].Cluster != "c2" || resp.Items[0].Images[0] != "registry/order:v2" {
+		t.Errorf("unexpected image search result %+v", resp.Items)
+	}
+
+	req = GlobalSearchRequest{Name: "order", Limit: 1}
+	if err := req.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if resp = globalSearch(targets[:2], req); len(resp.Items) != 1 || !resp.Truncated {
+		t.Errorf("result should be truncated, got %+v", resp)
+	}
+}
+
+func TestGlobalSearchRequestValidate(t *testing.T) {
+	if err := (&GlobalSearchRequest{}).validate(); err == nil {
+		t.Error("empty search should be rejected")
+	}
+	if err := (&GlobalSearchRequest{Name: "a", Kinds: []string{"nodes"}}).validate(); err == nil {
+		t.Error("unsupported kind should be rejected")
+	}
+	req := GlobalSearchRequest{Name: "a", TimeoutSeconds: 3600}
+	if err := req.validate(); err != nil || req.TimeoutSeconds != 60 || len(req.Kinds) != len(defaultSearchKinds) {
+		t.Errorf("unexpected defaults %+v, %v", req, err)
+	}
+}
@@ -1,12 +1,12 @@
 package cluster
 
 import (
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"github.com/KubeOperator/kubepi/pkg/terminal"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
-	"k8s.io/client-go/tools/remotecommand"
 )
 
 type TerminalResponse struct {
@@ -33,6 +33,9 @@ func (h *Handler) TerminalSessionHandler() iris.Handler {
 			ctx.Values().Set("message", err)
 			return
 		}
+		if !commons.CheckClusterAccess(ctx, c, true) {
+			return
+		}
 		k := kubernetes.NewKubernetes(c)
 		conf, err := k.Config()
 		if err != nil {
@@ -49,12 +52,31 @@ func (h *Handler) TerminalSessionHandler() iris.Handler {
 		if shell == "" {
 			shell = "sh"
 		}
-		terminal.TerminalSessions.Set(sessionID, terminal.TerminalSession{
-			Id:       sessionID,
-			Bound:    make(chan error),
-			SizeChan: make(chan remotecommand.TerminalSize),
+		limits, ok := checkTerminalLimits(ctx, clusterName)
+		if !ok {
+			return
+		}
+		release, ok := commons.AcquireStream(ctx, clusterName)
+		if !ok {
+			return
+		}
+		finishRecording, ok := openTerminal(ctx, sessionID, limits, terminalTarget{
+			cluster:   clusterName,
+			namespace: namespace,
+			pod:       podName,
+			container: containerName,
+			shell:     shell,
+			shareable: true,
 		})
-		go terminal.WaitForTerminal(client, conf, namespace, podName, containerName, sessionID, shell)
+		if !ok {
+			release()
+			return
+		}
+		go func() {
+			defer release()
+			defer finishRecording()
+			terminal.WaitForTerminal(client, conf, namespace, podName, containerName, sessionID, shell)
+		}()
 		resp := TerminalResponse{ID: sessionID}
 		ctx.Values().Set("data", resp)
 	}
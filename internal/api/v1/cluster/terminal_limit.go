@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	v1Role "github.com/KubeOperator/kubepi/internal/model/v1/role"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/rolebinding"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var roleBindingService = rolebinding.NewService()
+
+type terminalLimits struct {
+	idleTimeout time.Duration
+	maxDuration time.Duration
+	limit       terminal.SessionLimit
+}
+
+// looser 返回更宽松的限制,0 表示不限制
+func looser(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// resolveTerminalLimits 用户的角色有单独的设置时覆盖全局设置,多个角色取最宽松的设置
+func resolveTerminalLimits(conf v1Config.TerminalLimitConfig, roles []string) terminalLimits {
+	idle, maxDuration, maxPerUser := conf.IdleTimeout, conf.MaxDuration, conf.MaxPerUser
+	matched := false
+	for _, role := range roles {
+		r, ok := conf.Roles[role]
+		if !ok {
+			continue
+		}
+		if r.IdleTimeout == 0 {
+			r.IdleTimeout = conf.IdleTimeout
+		}
+		if !matched {
+			idle, maxDuration, maxPerUser = r.IdleTimeout, r.MaxDuration, r.MaxPerUser
+			matched = true
+			continue
+		}
+		if r.IdleTimeout > idle {
+			idle = r.IdleTimeout
+		}
+		maxDuration = looser(maxDuration, r.MaxDuration)
+		maxPerUser = looser(maxPerUser, r.MaxPerUser)
+	}
+	return terminalLimits{
+		idleTimeout: time.Duration(idle) * time.Second,
+		maxDuration: time.Duration(maxDuration) * time.Second,
+		limit:       terminal.SessionLimit{MaxPerUser: maxPerUser, MaxPerCluster: conf.MaxPerCluster},
+	}
+}
+
+// checkTerminalLimits 计算当前用户的终端限制,已达到上限时返回 429
+func checkTerminalLimits(ctx *context.Context, cluster string) (terminalLimits, bool) {
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	conf := server.Config().Spec.Terminal.Limit
+	var roles []string
+	if len(conf.Roles) > 0 {
+		bindings, _ := roleBindingService.GetRoleBindingBySubject(v1Role.Subject{Kind: "User", Name: profile.Name}, common.DBOptions{})
+		for i := range bindings {
+			roles = append(roles, bindings[i].RoleRef)
+		}
+	}
+	limits := resolveTerminalLimits(conf, roles)
+	if err := terminal.TerminalSessions.CheckLimit(profile.Name, cluster, limits.limit); err != nil {
+		ctx.StatusCode(iris.StatusTooManyRequests)
+		ctx.Values().Set("message", err.Error())
+		return limits, false
+	}
+	return limits, true
+}
+
+type terminalTarget struct {
+	cluster   string
+	namespace string
+	pod       string
+	container string
+	shell     string
+	shareable bool
+}
+
+// openTerminal 登记终端会话并开启录像和命令审计,返回的函数在会话结束时调用
+func openTerminal(ctx *context.Context, sessionID string, limits terminalLimits, target terminalTarget) (func(), bool) {
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	s := terminal.TerminalSession{
+		Id:          sessionID,
+		Bound:       make(chan error),
+		SizeChan:    make(chan remotecommand.TerminalSize),
+		User:        profile.Name,
+		Cluster:     target.cluster,
+		Namespace:   target.namespace,
+		Pod:         target.pod,
+		Container:   target.container,
+		IdleTimeout: limits.idleTimeout,
+		MaxDuration: limits.maxDuration,
+	}
+	if target.shareable {
+		s.Shared = terminal.NewSharedSession(profile.Name, target.cluster)
+	}
+	if err := terminal.TerminalSessions.Add(s, limits.limit); err != nil {
+		ctx.StatusCode(iris.StatusTooManyRequests)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	auditor, err := startCommandAudit(v1Terminal.Command{
+		SessionID: sessionID,
+		User:      profile.Name,
+		Cluster:   target.cluster,
+		Namespace: target.namespace,
+		Pod:       target.pod,
+		Container: target.container,
+	})
+	if err != nil {
+		terminal.TerminalSessions.Close(sessionID, 2, "")
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", fmt.Sprintf("start command audit failed: %s", err.Error()))
+		return nil, false
+	}
+	recorder, finishRecording := startRecording(v1Terminal.Recording{
+		SessionID: sessionID,
+		User:      profile.Name,
+		Cluster:   target.cluster,
+		Namespace: target.namespace,
+		Pod:       target.pod,
+		Container: target.container,
+		Shell:     target.shell,
+	})
+	s = terminal.TerminalSessions.Get(sessionID)
+	s.Recorder = recorder
+	s.Auditor = auditor
+	terminal.TerminalSessions.Set(sessionID, s)
+	return finishRecording, true
+}
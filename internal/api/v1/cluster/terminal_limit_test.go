@@ -0,0 +1,33 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+)
+
+func TestResolveTerminalLimits(t *testing.T) {
+	conf := v1Config.TerminalLimitConfig{
+		IdleTimeout:   300,
+		MaxDuration:   3600,
+		MaxPerUser:    2,
+		MaxPerCluster: 50,
+		Roles: map[string]v1Config.TerminalRoleLimit{
+			"Developer": {MaxDuration: 7200, MaxPerUser: 5},
+			"SRE":       {IdleTimeout: 1800, MaxPerUser: 0},
+		},
+	}
+	limits := resolveTerminalLimits(conf, []string{"Common User"})
+	if limits.idleTimeout != 5*time.Minute || limits.maxDuration != time.Hour || limits.limit.MaxPerUser != 2 {
+		t.Errorf("global limits should be used, got %+v", limits)
+	}
+	limits = resolveTerminalLimits(conf, []string{"Developer"})
+	if limits.idleTimeout != 5*time.Minute || limits.maxDuration != 2*time.Hour || limits.limit.MaxPerUser != 5 {
+		t.Errorf("unexpected role limits %+v", limits)
+	}
+	limits = resolveTerminalLimits(conf, []string{"Developer", "SRE"})
+	if limits.idleTimeout != 30*time.Minute || limits.maxDuration != 0 || limits.limit.MaxPerUser != 0 || limits.limit.MaxPerCluster != 50 {
+		t.Errorf("the loosest limits should be used, got %+v", limits)
+	}
+}
@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type TerminalInviteRequest struct {
+	Users []string `json:"users"`
+	// 为 false 时只能观看
+	Writable bool `json:"writable"`
+}
+
+type SharedTerminal struct {
+	ID           string                 `json:"id"`
+	Owner        string                 `json:"owner"`
+	Cluster      string                 `json:"cluster"`
+	Invites      map[string]bool        `json:"invites,omitempty"`
+	Participants []terminal.Participant `json:"participants"`
+}
+
+type JoinTerminalResponse struct {
+	ID       string `json:"id"`
+	Owner    string `json:"owner"`
+	Writable bool   `json:"writable"`
+}
+
+// sharedTerminal 查找集群中可共享的终端会话
+func sharedTerminal(ctx *context.Context) (*terminal.SharedSession, bool) {
+	id := ctx.Params().GetString("session")
+	s := terminal.TerminalSessions.Get(id)
+	if s.Id == "" || s.Shared == nil || s.Shared.Cluster != ctx.Params().GetString("name") {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.Values().Set("message", fmt.Sprintf("terminal session %s not found", id))
+		return nil, false
+	}
+	return s.Shared, true
+}
+
+// sharedTerminalOwner 只有会话所有者可以管理邀请
+func sharedTerminalOwner(ctx *context.Context) (*terminal.SharedSession, bool) {
+	shared, ok := sharedTerminal(ctx)
+	if !ok {
+		return nil, false
+	}
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if shared.Owner != profile.Name {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.Values().Set("message", "only the owner of the terminal session can manage invitations")
+		return nil, false
+	}
+	return shared, true
+}
+
+// GetSharedTerminal 返回共享会话的参与者,所有者和被邀请的用户可以查看
+func (h *Handler) GetSharedTerminal() iris.Handler {
+	return func(ctx *context.Context) {
+		shared, ok := sharedTerminal(ctx)
+		if !ok {
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		resp := SharedTerminal{
+			ID:           ctx.Params().GetString("session"),
+			Owner:        shared.Owner,
+			Cluster:      shared.Cluster,
+			Participants: shared.Participants(),
+		}
+		if shared.Owner == profile.Name {
+			resp.Invites = shared.Invites()
+		} else if _, invited := shared.Invitation(profile.Name); !invited {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", "you are not invited to the terminal session")
+			return
+		}
+		ctx.Values().Set("data", resp)
+	}
+}
+
+// InviteTerminalUsers 邀请用户观看或共同操作终端
+func (h *Handler) InviteTerminalUsers() iris.Handler {
+	return func(ctx *context.Context) {
+		shared, ok := sharedTerminalOwner(ctx)
+		if !ok {
+			return
+		}
+		var req TerminalInviteRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if len(req.Users) == 0 {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "users is required")
+			return
+		}
+		for _, user := range req.Users {
+			if user == shared.Owner {
+				continue
+			}
+			shared.Invite(user, req.Writable)
+		}
+		ctx.Values().Set("data", shared.Invites())
+	}
+}
+
+// RevokeTerminalInvite 取消邀请并断开该用户的连接
+func (h *Handler) RevokeTerminalInvite() iris.Handler {
+	return func(ctx *context.Context) {
+		shared, ok := sharedTerminalOwner(ctx)
+		if !ok {
+			return
+		}
+		shared.Revoke(ctx.Params().GetString("user"))
+		ctx.Values().Set("data", shared.Invites())
+	}
+}
+
+// JoinSharedTerminal 加入共享会话,加入的用户需要是集群的成员
+func (h *Handler) JoinSharedTerminal() iris.Handler {
+	return func(ctx *context.Context) {
+		shared, ok := sharedTerminal(ctx)
+		if !ok {
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		writable, invited := shared.Invitation(profile.Name)
+		if !invited {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", "you are not invited to the terminal session")
+			return
+		}
+		c, err := h.clusterService.Get(shared.Cluster, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if !profile.IsAdministrator {
+			if _, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{}); err != nil {
+				ctx.StatusCode(iris.StatusForbidden)
+				ctx.Values().Set("message", fmt.Sprintf("you are not a member of cluster %s", c.Name))
+				return
+			}
+		}
+		if !commons.CheckClusterAccess(ctx, c, writable) {
+			return
+		}
+		id, writable, err := shared.Join(profile.Name)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", JoinTerminalResponse{ID: id, Owner: shared.Owner, Writable: writable})
+	}
+}
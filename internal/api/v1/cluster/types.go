@@ -43,6 +43,9 @@ type ExtraClusterInfo struct {
 	CPURequested      float64 `json:"cpuRequested"`
 	MemoryAllocatable float64 `json:"memoryAllocatable"`
 	MemoryRequested   float64 `json:"memoryRequested"`
+	MetricsAvailable  bool    `json:"metricsAvailable"`
+	CPUUsage          float64 `json:"cpuUsage"`
+	MemoryUsage       float64 `json:"memoryUsage"`
 	Health            bool    `json:"health"`
 	Message           string  `json:"message"`
 }
@@ -0,0 +1,521 @@
+package cluster
+
+import (
+	goContext "context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	appsV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
+	coreV1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	k8sClient "k8s.io/client-go/kubernetes"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/polymorphichelpers"
+	deploymentutil "k8s.io/kubectl/pkg/util/deployment"
+)
+
+const (
+	kindDeployments  = "deployments"
+	kindStatefulSets = "statefulsets"
+	kindDaemonSets   = "daemonsets"
+	kindCronJobs     = "cronjobs"
+	kindJobs         = "jobs"
+
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+	instantiateAnnotation = "cronjob.kubernetes.io/instantiate"
+)
+
+var workloadGroupKinds = map[string]schema.GroupKind{
+	kindDeployments:  {Group: "apps", Kind: "Deployment"},
+	kindStatefulSets: {Group: "apps", Kind: "StatefulSet"},
+	kindDaemonSets:   {Group: "apps", Kind: "DaemonSet"},
+}
+
+type ScaleRequest struct {
+	Replicas int32 `json:"replicas"`
+}
+
+type RollbackRequest struct {
+	// 为 0 时回滚到上一个版本
+	Revision int64 `json:"revision"`
+}
+
+type WorkloadRevision struct {
+	Revision          int64     `json:"revision"`
+	Name              string    `json:"name"`
+	ChangeCause       string    `json:"changeCause"`
+	Images            []string  `json:"images"`
+	Current           bool      `json:"current"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+}
+
+// workloadParams 解析路径参数并检查资源类型是否支持该操作
+func workloadParams(ctx *context.Context, kinds ...string) (string, string, string, bool) {
+	namespace := ctx.Params().GetString("namespace")
+	kind := ctx.Params().GetString("kind")
+	name := ctx.Params().GetString("workload")
+	for i := range kinds {
+		if kinds[i] == kind {
+			return namespace, kind, name, true
+		}
+	}
+	ctx.StatusCode(iris.StatusBadRequest)
+	ctx.Values().Set("message", fmt.Sprintf("%s does not support this action", kind))
+	return "", "", "", false
+}
+
+func patchWorkload(ctx goContext.Context, client k8sClient.Interface, kind, namespace, name string, pt types.PatchType, data []byte) error {
+	var err error
+	switch kind {
+	case kindDeployments:
+		_, err = client.AppsV1().Deployments(namespace).Patch(ctx, name, pt, data, metav1.PatchOptions{})
+	case kindStatefulSets:
+		_, err = client.AppsV1().StatefulSets(namespace).Patch(ctx, name, pt, data, metav1.PatchOptions{})
+	case kindDaemonSets:
+		_, err = client.AppsV1().DaemonSets(namespace).Patch(ctx, name, pt, data, metav1.PatchOptions{})
+	default:
+		err = fmt.Errorf("unsupported workload kind %s", kind)
+	}
+	return err
+}
+
+// restartWorkload 与 kubectl rollout restart 相同,修改 pod 模版的注解触发滚动更新
+func restartWorkload(ctx goContext.Context, client k8sClient.Interface, kind, namespace, name string) error {
+	if kind == kindDeployments {
+		d, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if d.Spec.Paused {
+			return fmt.Errorf("can not restart paused deployment %s, resume it first", name)
+		}
+	}
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return patchWorkload(ctx, client, kind, namespace, name, types.StrategicMergePatchType, data)
+}
+
+func scaleWorkload(ctx goContext.Context, client k8sClient.Interface, kind, namespace, name string, replicas int32) error {
+	switch kind {
+	case kindDeployments:
+		scale, err := client.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		scale.Spec.Replicas = replicas
+		_, err = client.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	case kindStatefulSets:
+		scale, err := client.AppsV1().StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		scale.Spec.Replicas = replicas
+		_, err = client.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	}
+	return fmt.Errorf("unsupported workload kind %s", kind)
+}
+
+func imagesOf(spec coreV1.PodSpec) []string {
+	images := make([]string, 0, len(spec.Containers))
+	for i := range spec.Containers {
+		images = append(images, spec.Containers[i].Image)
+	}
+	return images
+}
+
+// workloadHistory 返回 Deployment 的 ReplicaSet 或 StatefulSet、DaemonSet 的 ControllerRevision 历史,按版本倒序
+func workloadHistory(ctx goContext.Context, client k8sClient.Interface, kind, namespace, name string) ([]WorkloadRevision, error) {
+	result := make([]WorkloadRevision, 0)
+	if kind == kindDeployments {
+		d, err := client.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		_, allOld, newRS, err := deploymentutil.GetAllReplicaSets(d, client.AppsV1())
+		if err != nil {
+			return nil, err
+		}
+		if newRS != nil {
+			allOld = append(allOld, newRS)
+		}
+		for i := range allOld {
+			revision, err := deploymentutil.Revision(allOld[i])
+			if err != nil {
+				continue
+			}
+			result = append(result, WorkloadRevision{
+				Revision:          revision,
+				Name:              allOld[i].Name,
+				ChangeCause:       allOld[i].Annotations[changeCauseAnnotation],
+				Images:            imagesOf(allOld[i].Spec.Template.Spec),
+				Current:           allOld[i] == newRS,
+				CreationTimestamp: allOld[i].CreationTimestamp.Time,
+			})
+		}
+	} else {
+		var owner metav1.Object
+		var selector *metav1.LabelSelector
+		currentRevision := ""
+		switch kind {
+		case kindStatefulSets:
+			s, err := client.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			owner, selector, currentRevision = s, s.Spec.Selector, s.Status.UpdateRevision
+		case kindDaemonSets:
+			d, err := client.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			owner, selector = d, d.Spec.Selector
+		default:
+			return nil, fmt.Errorf("unsupported workload kind %s", kind)
+		}
+		revisions, err := controllerRevisions(ctx, client, owner, selector)
+		if err != nil {
+			return nil, err
+		}
+		for i := range revisions {
+			result = append(result, WorkloadRevision{
+				Revision:          revisions[i].Revision,
+				Name:              revisions[i].Name,
+				ChangeCause:       revisions[i].Annotations[changeCauseAnnotation],
+				Images:            revisionImages(revisions[i]),
+				Current:           revisions[i].Name == currentRevision,
+				CreationTimestamp: revisions[i].CreationTimestamp.Time,
+			})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Revision > result[j].Revision
+	})
+	// DaemonSet 的 status 中没有记录当前版本,最新的版本即为当前版本
+	if kind == kindDaemonSets && len(result) > 0 {
+		result[0].Current = true
+	}
+	return result, nil
+}
+
+func controllerRevisions(ctx goContext.Context, client k8sClient.Interface, owner metav1.Object, selector *metav1.LabelSelector) ([]appsV1.ControllerRevision, error) {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.AppsV1().ControllerRevisions(owner.GetNamespace()).List(ctx, metav1.ListOptions{LabelSelector: s.String()})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]appsV1.ControllerRevision, 0, len(list.Items))
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], owner) {
+			result = append(result, list.Items[i])
+		}
+	}
+	return result, nil
+}
+
+// revisionImages ControllerRevision 中保存的是 pod 模版的 patch,只解析其中的镜像
+func revisionImages(revision appsV1.ControllerRevision) []string {
+	var data struct {
+		Spec struct {
+			Template struct {
+				Spec coreV1.PodSpec `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(revision.Data.Raw, &data); err != nil {
+		return []string{}
+	}
+	return imagesOf(data.Spec.Template.Spec)
+}
+
+// rollbackWorkload 与 kubectl rollout undo 相同,revision 为 0 时回滚到上一个版本
+func rollbackWorkload(client k8sClient.Interface, kind, namespace, name string, revision int64) (string, error) {
+	rollbacker, err := polymorphichelpers.RollbackerFor(workloadGroupKinds[kind], client)
+	if err != nil {
+		return "", err
+	}
+	obj := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	return rollbacker.Rollback(obj, nil, revision, cmdutil.DryRunNone)
+}
+
+// generateJobName 生成不超过 63 个字符的 Job 名称
+func generateJobName(prefix, suffix string) string {
+	maxLen := 63 - len(suffix) - 7
+	if len(prefix) > maxLen {
+		prefix = prefix[:maxLen]
+	}
+	return fmt.Sprintf("%s-%s-%s", prefix, suffix, utilrand.String(5))
+}
+
+// triggerCronJob 与 kubectl create job --from=cronjob 相同,根据 CronJob 的模版立即创建一个 Job,低版本集群使用 batch/v1beta1
+func triggerCronJob(ctx goContext.Context, client k8sClient.Interface, namespace, name string) (*batchV1.Job, error) {
+	var template metav1.ObjectMeta
+	var spec batchV1.JobSpec
+	owner := metav1.OwnerReference{Kind: "CronJob", Name: name, Controller: boolPtr(true)}
+	cronJob, err := client.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		template, spec = cronJob.Spec.JobTemplate.ObjectMeta, cronJob.Spec.JobTemplate.Spec
+		owner.APIVersion, owner.UID = "batch/v1", cronJob.UID
+	} else if apierrors.IsNotFound(err) {
+		legacy, legacyErr := client.BatchV1beta1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if legacyErr != nil {
+			return nil, err
+		}
+		template, spec = legacy.Spec.JobTemplate.ObjectMeta, legacy.Spec.JobTemplate.Spec
+		owner.APIVersion, owner.UID = "batch/v1beta1", legacy.UID
+	} else {
+		return nil, err
+	}
+	annotations := map[string]string{instantiateAnnotation: "manual"}
+	for k, v := range template.Annotations {
+		annotations[k] = v
+	}
+	job := &batchV1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       namespace,
+			Name:            generateJobName(name, "manual"),
+			Labels:          template.Labels,
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: spec,
+	}
+	return client.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+}
+
+// rerunJob 复制 Job 重新执行,去掉 Job controller 自动生成的 selector 和标签
+func rerunJob(ctx goContext.Context, client k8sClient.Interface, namespace, name string) (*batchV1.Job, error) {
+	old, err := client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	job := &batchV1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        generateJobName(name, "rerun"),
+			Labels:      old.Labels,
+			Annotations: old.Annotations,
+		},
+		Spec: *old.Spec.DeepCopy(),
+	}
+	if old.Spec.ManualSelector == nil || !*old.Spec.ManualSelector {
+		job.Spec.Selector = nil
+		job.Labels = withoutJobLabels(job.Labels)
+		job.Spec.Template.Labels = withoutJobLabels(job.Spec.Template.Labels)
+	}
+	return client.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+}
+
+func withoutJobLabels(l map[string]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range l {
+		if k == "controller-uid" || k == "job-name" {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// RestartWorkload 重启 Deployment、StatefulSet 或 DaemonSet
+func (h *Handler) RestartWorkload() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, kind, name, ok := workloadParams(ctx, kindDeployments, kindStatefulSets, kindDaemonSets)
+		if !ok {
+			return
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		if err := restartWorkload(ctx.Request().Context(), client, kind, namespace, name); err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", name)
+	}
+}
+
+// ScaleWorkload 调整 Deployment 或 StatefulSet 的副本数
+func (h *Handler) ScaleWorkload() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, kind, name, ok := workloadParams(ctx, kindDeployments, kindStatefulSets)
+		if !ok {
+			return
+		}
+		var req ScaleRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if req.Replicas < 0 {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "replicas must not be negative")
+			return
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		if err := scaleWorkload(ctx.Request().Context(), client, kind, namespace, name, req.Replicas); err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", req)
+	}
+}
+
+func (h *Handler) pauseWorkload(paused bool) iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, kind, name, ok := workloadParams(ctx, kindDeployments)
+		if !ok {
+			return
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		data := []byte(fmt.Sprintf(`{"spec":{"paused":%t}}`, paused))
+		if err := patchWorkload(ctx.Request().Context(), client, kind, namespace, name, types.MergePatchType, data); err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", name)
+	}
+}
+
+// PauseWorkload 暂停 Deployment 的滚动更新
+func (h *Handler) PauseWorkload() iris.Handler {
+	return h.pauseWorkload(true)
+}
+
+// ResumeWorkload 恢复 Deployment 的滚动更新
+func (h *Handler) ResumeWorkload() iris.Handler {
+	return h.pauseWorkload(false)
+}
+
+// ListWorkloadHistory 查看 Deployment、StatefulSet 或 DaemonSet 的历史版本
+func (h *Handler) ListWorkloadHistory() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, kind, name, ok := workloadParams(ctx, kindDeployments, kindStatefulSets, kindDaemonSets)
+		if !ok {
+			return
+		}
+		client, ok := h.userClient(ctx, false)
+		if !ok {
+			return
+		}
+		history, err := workloadHistory(ctx.Request().Context(), client, kind, namespace, name)
+		if err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", history)
+	}
+}
+
+// RollbackWorkload 回滚到指定版本
+func (h *Handler) RollbackWorkload() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, kind, name, ok := workloadParams(ctx, kindDeployments, kindStatefulSets, kindDaemonSets)
+		if !ok {
+			return
+		}
+		var req RollbackRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		message, err := rollbackWorkload(client, kind, namespace, name, req.Revision)
+		if err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", message)
+	}
+}
+
+// TriggerCronJob 立即执行一次 CronJob
+func (h *Handler) TriggerCronJob() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, _, name, ok := workloadParams(ctx, kindCronJobs)
+		if !ok {
+			return
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		job, err := triggerCronJob(ctx.Request().Context(), client, namespace, name)
+		if err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", job)
+	}
+}
+
+// RerunJob 重新执行 Job
+func (h *Handler) RerunJob() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace, _, name, ok := workloadParams(ctx, kindJobs)
+		if !ok {
+			return
+		}
+		client, ok := h.userClient(ctx, true)
+		if !ok {
+			return
+		}
+		job, err := rerunJob(ctx.Request().Context(), client, namespace, name)
+		if err != nil {
+			writeWorkloadError(ctx, err)
+			return
+		}
+		ctx.Values().Set("data", job)
+	}
+}
+
+// writeWorkloadError 透传集群返回的状态码,例如用户没有权限时返回 403
+func writeWorkloadError(ctx *context.Context, err error) {
+	code := iris.StatusInternalServerError
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Code > 0 {
+		code = int(status.Status().Code)
+	}
+	ctx.StatusCode(code)
+	ctx.Values().Set("message", err.Error())
+}
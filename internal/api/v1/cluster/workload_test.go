@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	goContext "context"
+	"strings"
+	"testing"
+
+	appsV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRestartWorkload(t *testing.T) {
+	client := fake.NewSimpleClientset(&appsV1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}})
+	if err := restartWorkload(goContext.Background(), client, kindDeployments, "default", "web"); err != nil {
+		t.Fatal(err)
+	}
+	d, _ := client.AppsV1().Deployments("default").Get(goContext.Background(), "web", metav1.GetOptions{})
+	if d.Spec.Template.Annotations[restartedAtAnnotation] == "" {
+		t.Error("pod template should be annotated with restartedAt")
+	}
+}
+
+func TestStatefulSetHistory(t *testing.T) {
+	controller := true
+	sts := &appsV1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db", UID: "sts-uid"},
+		Spec:       appsV1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}},
+		Status:     appsV1.StatefulSetStatus{UpdateRevision: "db-2"},
+	}
+	revision := func(name string, rev int64, image string) *appsV1.ControllerRevision {
+		return &appsV1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            name,
+				Labels:          map[string]string{"app": "db"},
+				Annotations:     map[string]string{changeCauseAnnotation: "update to " + image},
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db", UID: "sts-uid", Controller: &controller}},
+			},
+			Data:     runtime.RawExtension{Raw: []byte(`{"spec":{"template":{"spec":{"containers":[{"name":"db","image":"` + image + `"}]}}}}`)},
+			Revision: rev,
+		}
+	}
+	client := fake.NewSimpleClientset(sts, revision("db-1", 1, "mysql:5.7"), revision("db-2", 2, "mysql:8.0"))
+	history, err := workloadHistory(goContext.Background(), client, kindStatefulSets, "default", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Revision != 2 || !history[0].Current || history[1].Current {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if history[1].ChangeCause != "update to mysql:5.7" || history[1].Images[0] != "mysql:5.7" {
+		t.Errorf("unexpected revision %+v", history[1])
+	}
+}
+
+func TestTriggerCronJob(t *testing.T) {
+	client := fake.NewSimpleClientset(&batchV1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backup", UID: "cj-uid"},
+		Spec: batchV1.CronJobSpec{JobTemplate: batchV1.JobTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "backup"}},
+		}},
+	})
+	job, err := triggerCronJob(goContext.Background(), client, "default", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(job.Name, "backup-manual-") || job.Annotations[instantiateAnnotation] != "manual" || job.Labels["app"] != "backup" {
+		t.Errorf("unexpected job %+v", job.ObjectMeta)
+	}
+	if len(job.OwnerReferences) != 1 || job.OwnerReferences[0].UID != "cj-uid" {
+		t.Errorf("job should be owned by cronjob, got %+v", job.OwnerReferences)
+	}
+}
+
+func TestRerunJob(t *testing.T) {
+	generated := map[string]string{"app": "migrate", "controller-uid": "1", "job-name": "migrate"}
+	client := fake.NewSimpleClientset(&batchV1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "migrate", Labels: generated},
+		Spec: batchV1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "1"}},
+		},
+	})
+	job, err := rerunJob(goContext.Background(), client, "default", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.Selector != nil || job.Labels["controller-uid"] != "" || job.Labels["app"] != "migrate" {
+		t.Errorf("generated selector and labels should be removed, got %+v %+v", job.Labels, job.Spec.Selector)
+	}
+	if len(generateJobName(strings.Repeat("a", 63), "rerun")) > 63 {
+		t.Error("job name should not exceed 63 characters")
+	}
+}
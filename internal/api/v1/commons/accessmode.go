@@ -0,0 +1,88 @@
+package commons
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+var clusterService = cluster.NewService()
+
+// ActiveAccessMode 返回集群在 now 时刻生效的访问模式,不在计划时间内时为正常模式
+func ActiveAccessMode(m v1Cluster.AccessMode, now time.Time) string {
+	if m.Mode == v1Cluster.AccessModeNormal {
+		return v1Cluster.AccessModeNormal
+	}
+	if !m.StartTime.IsZero() && now.Before(m.StartTime) {
+		return v1Cluster.AccessModeNormal
+	}
+	if !m.EndTime.IsZero() && !now.Before(m.EndTime) {
+		return v1Cluster.AccessModeNormal
+	}
+	return m.Mode
+}
+
+func accessModeReason(m v1Cluster.AccessMode) string {
+	reason := m.Reason
+	if reason == "" {
+		reason = "-"
+	}
+	if !m.EndTime.IsZero() {
+		reason = fmt.Sprintf("%s (until %s)", reason, m.EndTime.Local().Format("2006-01-02 15:04"))
+	}
+	return reason
+}
+
+// CheckClusterAccess 检查集群的只读和维护模式,write 表示请求会修改集群或在容器内执行命令;
+// 维护模式下禁止所有访问,只读模式下只有管理员可以执行写操作,不允许访问时写入错误并返回 false
+func CheckClusterAccess(ctx *context.Context, c *v1Cluster.Cluster, write bool) bool {
+	clusterName := c.Name
+	m := c.Spec.AccessMode
+	switch ActiveAccessMode(m, time.Now()) {
+	case v1Cluster.AccessModeMaintenance:
+		ctx.StatusCode(iris.StatusServiceUnavailable)
+		ctx.Values().Set("message", []string{"cluster %s is under maintenance: %s", clusterName, accessModeReason(m)})
+		return false
+	case v1Cluster.AccessModeReadOnly:
+		if !write {
+			return true
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if profile.IsAdministrator {
+			return true
+		}
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.Values().Set("message", []string{"cluster %s is read only: %s", clusterName, accessModeReason(m)})
+		return false
+	}
+	return true
+}
+
+// CheckClusterAccessByName 同 CheckClusterAccess,用于只知道集群名称的场景
+func CheckClusterAccessByName(ctx *context.Context, clusterName string, write bool) bool {
+	c, err := clusterService.Get(clusterName, common.DBOptions{})
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+		return false
+	}
+	return CheckClusterAccess(ctx, c, write)
+}
+
+// ClusterAccessHandler 按集群访问模式拦截请求,集群名称取自路由参数 param,非 GET 请求视为写操作
+func ClusterAccessHandler(param string) iris.Handler {
+	return func(ctx *context.Context) {
+		write := ctx.Method() != http.MethodGet && ctx.Method() != http.MethodHead
+		if !CheckClusterAccessByName(ctx, ctx.Params().GetString(param), write) {
+			return
+		}
+		ctx.Next()
+	}
+}
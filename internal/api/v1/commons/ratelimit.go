@@ -0,0 +1,128 @@
+package commons
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/pkg/ratelimit"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	throttleScopeUser    = "user"
+	throttleScopeCluster = "cluster"
+	throttleScopeStream  = "stream"
+
+	// 长连接数量超限时建议客户端重试的间隔
+	streamRetryAfter = 10 * time.Second
+)
+
+var (
+	throttledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubepi",
+		Subsystem: "proxy",
+		Name:      "throttled_requests_total",
+		Help:      "Number of requests rejected by the kubepi rate limiter.",
+	}, []string{"cluster", "scope"})
+	activeStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kubepi",
+		Subsystem: "proxy",
+		Name:      "active_streams",
+		Help:      "Number of long-running streams (logs, exec, watches) currently open.",
+	}, []string{"cluster"})
+)
+
+func init() {
+	prometheus.MustRegister(throttledRequests, activeStreams)
+}
+
+type throttle struct {
+	enable        bool
+	users         *ratelimit.KeyedLimiter
+	clusters      *ratelimit.KeyedLimiter
+	userStreams   *ratelimit.Counter
+	clusterStream *ratelimit.Counter
+}
+
+var (
+	defaultThrottle     *throttle
+	defaultThrottleOnce sync.Once
+)
+
+func getThrottle() *throttle {
+	defaultThrottleOnce.Do(func() {
+		c := server.Config().Spec.RateLimit
+		defaultThrottle = &throttle{
+			enable:        c.Enable,
+			users:         ratelimit.NewKeyedLimiter(c.UserQPS, c.UserBurst),
+			clusters:      ratelimit.NewKeyedLimiter(c.ClusterQPS, c.ClusterBurst),
+			userStreams:   ratelimit.NewCounter(c.MaxStreamsPerUser),
+			clusterStream: ratelimit.NewCounter(c.MaxStreamsPerCluster),
+		}
+	})
+	return defaultThrottle
+}
+
+func tooManyRequests(ctx *context.Context, cluster, scope string, retryAfter time.Duration) {
+	throttledRequests.WithLabelValues(cluster, scope).Inc()
+	seconds := fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds())))
+	ctx.Header("Retry-After", seconds)
+	ctx.StatusCode(iris.StatusTooManyRequests)
+	ctx.Values().Set("message", []string{"rate limited, retry after %s seconds", seconds})
+}
+
+// RateLimitHandler 按用户和集群限制访问集群的请求速率,集群名称取自路由参数 name
+func RateLimitHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		t := getThrottle()
+		if !t.enable {
+			ctx.Next()
+			return
+		}
+		cluster := ctx.Params().GetString("name")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if delay := t.users.Reserve(fmt.Sprintf("%s/%s", cluster, profile.Name)); delay > 0 {
+			tooManyRequests(ctx, cluster, throttleScopeUser, delay)
+			return
+		}
+		if delay := t.clusters.Reserve(cluster); delay > 0 {
+			tooManyRequests(ctx, cluster, throttleScopeCluster, delay)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// AcquireStream 为长连接占用用户和集群的并发名额,返回的 release 需在连接结束时调用;
+// 超过上限时直接返回 429 并且 ok 为 false
+func AcquireStream(ctx *context.Context, cluster string) (release func(), ok bool) {
+	t := getThrottle()
+	if !t.enable {
+		return func() {}, true
+	}
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if !t.userStreams.Acquire(profile.Name) {
+		tooManyRequests(ctx, cluster, throttleScopeStream, streamRetryAfter)
+		return nil, false
+	}
+	if !t.clusterStream.Acquire(cluster) {
+		t.userStreams.Release(profile.Name)
+		tooManyRequests(ctx, cluster, throttleScopeStream, streamRetryAfter)
+		return nil, false
+	}
+	activeStreams.WithLabelValues(cluster).Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.userStreams.Release(profile.Name)
+			t.clusterStream.Release(cluster)
+			activeStreams.WithLabelValues(cluster).Dec()
+		})
+	}, true
+}
@@ -0,0 +1,33 @@
+package commons
+
+import (
+	"encoding/pem"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var clusterBindingService = clusterbinding.NewService()
+
+// UserRestConfig 生成以当前用户身份访问集群的配置,管理员使用集群的管理员凭据
+func UserRestConfig(c *v1Cluster.Cluster, profile session.UserProfile) (*rest.Config, error) {
+	if profile.IsAdministrator {
+		return kubernetes.NewKubernetes(c).Config()
+	}
+	binding, err := clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &rest.Config{
+		Host: c.Spec.Connect.Forward.ApiServer,
+		TLSClientConfig: rest.TLSClientConfig{
+			Insecure: true,
+			CertData: binding.Certificate,
+			KeyData:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey}),
+		},
+	}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"errors"
 	"fmt"
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
 	fileModel "github.com/KubeOperator/kubepi/internal/model/v1/file"
 	"github.com/KubeOperator/kubepi/internal/service/v1/file"
 	"github.com/kataras/iris/v12"
@@ -33,6 +34,9 @@ func (h *Handler) ListFiles() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, false) {
+			return
+		}
 		res, err := h.fileService.ListFiles(req)
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
@@ -51,6 +55,9 @@ func (h *Handler) CreateFolder() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, true) {
+			return
+		}
 		req.Commands = []string{"mkdir", req.Path}
 		if _, err := h.fileService.ExecNewCommand(req); err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
@@ -68,6 +75,9 @@ func (h *Handler) CreateFile() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, true) {
+			return
+		}
 		command := "echo '" + req.Content + "' >> " + req.Path
 		req.Commands = []string{"sh", "-c", command}
 		if _, err := h.fileService.ExecNewCommand(req); err != nil {
@@ -86,6 +96,9 @@ func (h *Handler) UpdateFile() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, true) {
+			return
+		}
 		if err := h.fileService.EditFile(req); err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err.Error())
@@ -102,6 +115,9 @@ func (h *Handler) OpenFile() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, false) {
+			return
+		}
 		res, err := h.fileService.CatFile(req)
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
@@ -120,6 +136,9 @@ func (h *Handler) ReNameFile() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, true) {
+			return
+		}
 		if req.OldPath == "" {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", "file or path is not exist")
@@ -143,6 +162,9 @@ func (h *Handler) RmFolder() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, true) {
+			return
+		}
 		req.Commands = []string{"rm", req.Path}
 		if _, err := h.fileService.ExecNewCommand(req); err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
@@ -161,6 +183,9 @@ func (h *Handler) DownloadFile() iris.Handler {
 		req.Cluster = ctx.URLParam("cluster")
 		req.PodName = ctx.URLParam("podName")
 		req.ContainerName = ctx.URLParam("containerName")
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, false) {
+			return
+		}
 
 		file, err := h.fileService.DownloadFile(req)
 		if err != nil {
@@ -187,6 +212,9 @@ func (h *Handler) UploadFile() iris.Handler {
 		req.Cluster = ctx.URLParam("cluster")
 		req.PodName = ctx.URLParam("podName")
 		req.ContainerName = ctx.URLParam("containerName")
+		if !commons.CheckClusterAccessByName(ctx, req.Cluster, true) {
+			return
+		}
 
 		srcPath := filepath.Join(os.TempDir(), fmt.Sprintf("%d", time.Now().UnixNano()))
 		err := saveTarFile(ctx, srcPath)
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bytes"
+	goContext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+)
+
+const applyFieldManager = "kubepi"
+
+// ApplyResult 单个对象的 apply 结果
+type ApplyResult struct {
+	ApiVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Resource   string `json:"resource,omitempty"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message,omitempty"`
+
+	// 以下字段用于记录操作日志
+	group      string
+	statusCode int
+	before     map[string]interface{}
+	after      map[string]interface{}
+}
+
+// ApplyResources 以 server-side apply 的方式创建或更新多文档 yaml 中的全部对象
+func (h *Handler) ApplyResources() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		defaultNamespace := ctx.URLParamDefault("namespace", "default")
+		force, _ := ctx.URLParamBool("force")
+		var dryRun []string
+		if ctx.URLParam("dryRun") == metav1.DryRunAll {
+			dryRun = []string{metav1.DryRunAll}
+		}
+
+		c, err := h.clusterService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		if !commons.CheckClusterAccess(ctx, c, len(dryRun) == 0) {
+			return
+		}
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+
+		body, err := ctx.GetBody()
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		objects, err := decodeObjects(body)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		cfg, err := h.generateRestConfig(c, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		dynamicClient, err := dynamic.NewForConfig(cfg)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+
+		results := make([]ApplyResult, 0, len(objects))
+		for i := range objects {
+			results = append(results, applyObject(ctx.Request().Context(), dynamicClient, mapper, objects[i], defaultNamespace, dryRun, force))
+		}
+		if len(dryRun) == 0 {
+			for i := range results {
+				recordApplyResult(profile.Name, name, results[i])
+			}
+		}
+		_, _ = ctx.JSON(iris.Map{
+			"success": true,
+			"data":    results,
+		})
+	}
+}
+
+// decodeObjects 解析多文档 yaml 或 json,kind: List 的文档展开为其中的对象
+func decodeObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var objects []*unstructured.Unstructured
+	for doc := 1; ; doc++ {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("can not decode yaml document %d: %s", doc, err.Error())
+		}
+		if len(raw) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+			return nil, fmt.Errorf("yaml document %d must contain apiVersion and kind", doc)
+		}
+		if !obj.IsList() {
+			objects = append(objects, obj)
+			continue
+		}
+		err := obj.EachListItem(func(item runtime.Object) error {
+			o := item.(*unstructured.Unstructured)
+			if o.GetAPIVersion() == "" || o.GetKind() == "" {
+				return fmt.Errorf("items of yaml document %d must contain apiVersion and kind", doc)
+			}
+			objects = append(objects, o)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// resettableMapper 可以清空发现缓存的 RESTMapper
+type resettableMapper interface {
+	Reset()
+}
+
+// restMapping 找不到资源类型时清空发现缓存后重试一次,以支持同一份 yaml 中先创建 CRD 再创建对应的资源
+func restMapping(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (*meta.RESTMapping, error) {
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err == nil || !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+	r, ok := mapper.(resettableMapper)
+	if !ok {
+		return nil, err
+	}
+	r.Reset()
+	return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+}
+
+func applyObject(ctx goContext.Context, client dynamic.Interface, mapper meta.RESTMapper, obj *unstructured.Unstructured, defaultNamespace string, dryRun []string, force bool) ApplyResult {
+	gvk := obj.GroupVersionKind()
+	result := ApplyResult{
+		ApiVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Name:       obj.GetName(),
+	}
+	if result.Name == "" {
+		result.Message = "metadata.name is required"
+		return result
+	}
+	mapping, err := restMapping(mapper, gvk)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Resource = mapping.Resource.Resource
+	result.group = mapping.Resource.Group
+	var ri dynamic.ResourceInterface = client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(defaultNamespace)
+		}
+		result.Namespace = obj.GetNamespace()
+		ri = client.Resource(mapping.Resource).Namespace(result.Namespace)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	if current, err := ri.Get(ctx, result.Name, metav1.GetOptions{}); err == nil {
+		result.before = current.Object
+	}
+	applied, err := ri.Patch(ctx, result.Name, types.ApplyPatchType, data, metav1.PatchOptions{
+		DryRun:       dryRun,
+		Force:        &force,
+		FieldManager: applyFieldManager,
+	})
+	if err != nil {
+		result.statusCode = http.StatusInternalServerError
+		if status, ok := err.(apierrors.APIStatus); ok {
+			result.statusCode = int(status.Status().Code)
+		}
+		result.Message = err.Error()
+		return result
+	}
+	result.statusCode = http.StatusOK
+	result.after = applied.Object
+	result.Success = true
+	return result
+}
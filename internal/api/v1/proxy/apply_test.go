@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	goContext "context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestDecodeObjects(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		kinds []string
+		fail  bool
+	}{
+		{"empty", "", nil, false},
+		{"empty documents", "---\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n---\n", []string{"ConfigMap"}, false},
+		{"multiple documents", "apiVersion: v1\nkind: ConfigMap\n---\napiVersion: apps/v1\nkind: Deployment\n", []string{"ConfigMap", "Deployment"}, false},
+		{"json", `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"s"}}`, []string{"Secret"}, false},
+		{"list", "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: ConfigMap\n- apiVersion: v1\n  kind: Service\n", []string{"ConfigMap", "Service"}, false},
+		{"missing apiVersion", "kind: ConfigMap\n", nil, true},
+		{"missing kind", "apiVersion: v1\n", nil, true},
+		{"list item without kind", "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n", nil, true},
+		{"invalid yaml", "apiVersion: [v1\n", nil, true},
+	}
+	for _, tt := range tests {
+		objects, err := decodeObjects([]byte(tt.data))
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		var kinds []string
+		for i := range objects {
+			kinds = append(kinds, objects[i].GetKind())
+		}
+		if len(kinds) != len(tt.kinds) {
+			t.Errorf("%s: got kinds %v, want %v", tt.name, kinds, tt.kinds)
+			continue
+		}
+		for i := range kinds {
+			if kinds[i] != tt.kinds[i] {
+				t.Errorf("%s: got kinds %v, want %v", tt.name, kinds, tt.kinds)
+				break
+			}
+		}
+	}
+}
+
+var (
+	configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	namespaceGVK = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+	crontabGVK   = schema.GroupVersionKind{Group: "stable.example.com", Version: "v1", Kind: "CronTab"}
+)
+
+func newApplyTestMapper() *meta.DefaultRESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(configMapGVK, meta.RESTScopeNamespace)
+	mapper.Add(namespaceGVK, meta.RESTScopeRoot)
+	return mapper
+}
+
+// newApplyTestClient 返回的客户端把 apply 的内容原样作为结果返回
+func newApplyTestClient() (*dynamicFake.FakeDynamicClient, *[]k8sTesting.PatchAction) {
+	client := dynamicFake.NewSimpleDynamicClient(scheme.Scheme)
+	var patches []k8sTesting.PatchAction
+	client.PrependReactor("patch", "*", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8sTesting.PatchAction)
+		patches = append(patches, patch)
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &obj.Object); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+	return client, &patches
+}
+
+func newApplyTestObject(gvk schema.GroupVersionKind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestApplyObject(t *testing.T) {
+	tests := []struct {
+		name      string
+		obj       *unstructured.Unstructured
+		namespace string
+		resource  string
+		success   bool
+	}{
+		{"default namespace", newApplyTestObject(configMapGVK, "", "a"), "dev", "configmaps", true},
+		{"explicit namespace", newApplyTestObject(configMapGVK, "prod", "a"), "prod", "configmaps", true},
+		{"cluster scoped", newApplyTestObject(namespaceGVK, "", "dev"), "", "namespaces", true},
+		{"missing name", newApplyTestObject(configMapGVK, "", ""), "", "", false},
+		{"unknown kind", newApplyTestObject(crontabGVK, "", "a"), "", "", false},
+	}
+	for _, tt := range tests {
+		client, patches := newApplyTestClient()
+		result := applyObject(goContext.Background(), client, newApplyTestMapper(), tt.obj, "dev", nil, false)
+		if result.Success != tt.success || result.Namespace != tt.namespace || result.Resource != tt.resource {
+			t.Errorf("%s: unexpected result %+v", tt.name, result)
+			continue
+		}
+		if !tt.success {
+			if len(*patches) != 0 {
+				t.Errorf("%s: failed object should not be applied", tt.name)
+			}
+			continue
+		}
+		if len(*patches) != 1 {
+			t.Fatalf("%s: expected one patch, got %d", tt.name, len(*patches))
+		}
+		patch := (*patches)[0]
+		if patch.GetNamespace() != tt.namespace || patch.GetResource().Resource != tt.resource || patch.GetPatchType() != types.ApplyPatchType {
+			t.Errorf("%s: unexpected patch %s %s %s", tt.name, patch.GetNamespace(), patch.GetResource().Resource, patch.GetPatchType())
+		}
+		if result.statusCode != http.StatusOK || result.after == nil {
+			t.Errorf("%s: applied object is not recorded", tt.name)
+		}
+	}
+}
+
+// crdMapper 模拟 CRD 创建后重新发现才能找到新的资源类型
+type crdMapper struct {
+	*meta.DefaultRESTMapper
+	resets int
+}
+
+func (m *crdMapper) Reset() {
+	m.resets++
+	m.Add(crontabGVK, meta.RESTScopeNamespace)
+}
+
+func TestRestMappingRefresh(t *testing.T) {
+	mapper := &crdMapper{DefaultRESTMapper: newApplyTestMapper()}
+	if _, err := restMapping(mapper, configMapGVK); err != nil || mapper.resets != 0 {
+		t.Errorf("known kinds should not reset the mapper: %v", err)
+	}
+	mapping, err := restMapping(mapper, crontabGVK)
+	if err != nil || mapping.Resource.Resource != "crontabs" || mapper.resets != 1 {
+		t.Errorf("new kinds should be found after reset: %v", err)
+	}
+	if _, err := restMapping(newApplyTestMapper(), crontabGVK); !meta.IsNoMatchError(err) {
+		t.Errorf("expected no match error, got %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	goContext "context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 敏感字段在审计日志中的替换值
+	auditMaskedValue = "******"
+	// 单条审计日志最多记录的差异行数
+	auditMaxDiffLines = 100
+)
+
+// 不参与差异比较的字段
+var auditIgnoredFields = map[string]bool{
+	"metadata.managedFields":   true,
+	"metadata.resourceVersion": true,
+	"metadata.generation":      true,
+}
+
+var auditService = system.NewService()
+
+// resourcePath 从 k8s api 路径中解析出的资源信息
+type resourcePath struct {
+	group       string
+	version     string
+	namespace   string
+	resource    string
+	name        string
+	subresource string
+}
+
+// parseResourcePath 解析 /api/{v}/... 以及 /apis/{g}/{v}/... 形式的路径
+func parseResourcePath(path string) resourcePath {
+	var r resourcePath
+	ss := strings.Split(strings.Trim(path, "/"), "/")
+	var rest []string
+	switch {
+	case len(ss) >= 2 && ss[0] == "api":
+		r.version = ss[1]
+		rest = ss[2:]
+	case len(ss) >= 3 && ss[0] == "apis":
+		r.group, r.version = ss[1], ss[2]
+		rest = ss[3:]
+	default:
+		return r
+	}
+	// namespaces/{name}/status 和 namespaces/{name}/finalize 是 namespace 本身的子资源
+	if len(rest) >= 3 && rest[0] == "namespaces" && rest[2] != "status" && rest[2] != "finalize" {
+		r.namespace = rest[1]
+		rest = rest[2:]
+	}
+	if len(rest) > 0 {
+		r.resource = rest[0]
+	}
+	if len(rest) > 1 {
+		r.name = rest[1]
+	}
+	if len(rest) > 2 {
+		r.subresource = rest[2]
+	}
+	return r
+}
+
+// gvr 返回 group/version/resource 形式的资源标识,核心组省略 group
+func (r resourcePath) gvr() string {
+	s := r.version + "/" + r.resource
+	if r.group != "" {
+		s = r.group + "/" + s
+	}
+	if r.subresource != "" {
+		s = s + "/" + r.subresource
+	}
+	return s
+}
+
+// isMutatingRequest 判断请求是否会修改集群,权限检查类的 review 请求虽然是 POST 但不修改集群
+func isMutatingRequest(method string, path string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return !strings.HasPrefix(path, "/apis/authorization.k8s.io/") &&
+			!strings.HasPrefix(path, "/apis/authentication.k8s.io/")
+	}
+	return false
+}
+
+func isDryRun(query url.Values) bool {
+	_, ok := query["dryRun"]
+	return ok
+}
+
+// proxyAudit 记录一次经过代理的变更操作
+type proxyAudit struct {
+	operator    string
+	cluster     string
+	method      string
+	path        resourcePath
+	requestBody []byte
+	before      map[string]interface{}
+}
+
+func newProxyAudit(operator, cluster, method string, path resourcePath, requestBody []byte) *proxyAudit {
+	return &proxyAudit{
+		operator:    operator,
+		cluster:     cluster,
+		method:      method,
+		path:        path,
+		requestBody: requestBody,
+	}
+}
+
+// fetchBefore 在更新前读取对象的当前状态,用于生成变更前后的差异
+func (a *proxyAudit) fetchBefore(ctx goContext.Context, client *http.Client, apiUrl url.URL) {
+	if a.method != http.MethodPut && a.method != http.MethodPatch {
+		return
+	}
+	if a.path.name == "" {
+		return
+	}
+	apiUrl.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiUrl.String(), nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logrus.Errorf("fetch %s before update failed: %s", apiUrl.Path, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	var obj map[string]interface{}
+	if json.Unmarshal(data, &obj) == nil {
+		a.before = obj
+	}
+}
+
+// record 根据 k8s 的返回生成操作日志并异步保存
+func (a *proxyAudit) record(statusCode int, responseBody []byte) {
+	var after map[string]interface{}
+	if statusCode < http.StatusBadRequest {
+		_ = json.Unmarshal(responseBody, &after)
+	}
+	name := a.path.name
+	namespace := a.path.namespace
+	if name == "" {
+		var requestObj map[string]interface{}
+		_ = json.Unmarshal(a.requestBody, &requestObj)
+		for _, obj := range []map[string]interface{}{after, requestObj} {
+			if n, ns := objectName(obj); n != "" {
+				name = n
+				if namespace == "" {
+					namespace = ns
+				}
+				break
+			}
+		}
+	}
+	var detail string
+	if a.before != nil && after != nil && isAuditedObject(after) {
+		detail = strings.Join(diffObjects(a.before, after, a.path.resource == "secrets"), "\n")
+	}
+	saveAuditLog(a.operator, strings.ToLower(a.method), a.cluster, namespace, name, a.path, statusCode, detail)
+}
+
+func saveAuditLog(operator, operation, cluster, namespace, name string, path resourcePath, statusCode int, detail string) {
+	log := v1System.OperationLog{
+		Operator:            operator,
+		Operation:           operation,
+		OperationDomain:     fmt.Sprintf("clusters_%s", path.resource),
+		SpecificInformation: fmt.Sprintf("[%s] %s", cluster, auditObjectName(namespace, name)),
+		Cluster:             cluster,
+		Namespace:           namespace,
+		Resource:            path.gvr(),
+		ResourceName:        name,
+		StatusCode:          statusCode,
+		Detail:              detail,
+	}
+	go auditService.CreateOperationLog(&log, common.DBOptions{})
+}
+
+func objectName(obj map[string]interface{}) (string, string) {
+	m, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+	name, _ := m["name"].(string)
+	namespace, _ := m["namespace"].(string)
+	return name, namespace
+}
+
+func auditObjectName(namespace, name string) string {
+	if name == "" {
+		name = "-"
+	}
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// 返回 Status 时说明结果不是资源对象本身
+func isAuditedObject(obj map[string]interface{}) bool {
+	kind, _ := obj["kind"].(string)
+	return kind != "Status"
+}
+
+// diffObjects 比较两个对象并返回 "path: old -> new" 形式的差异,Secret 的内容会被屏蔽
+func diffObjects(before, after map[string]interface{}, secret bool) []string {
+	var lines []string
+	diffValue("", before, after, secret, &lines)
+	sort.Strings(lines)
+	if len(lines) > auditMaxDiffLines {
+		more := len(lines) - auditMaxDiffLines
+		lines = append(lines[:auditMaxDiffLines], fmt.Sprintf("... %d more", more))
+	}
+	return lines
+}
+
+// isSecretField Secret 的数据以及 last-applied-configuration 注解中都可能包含敏感内容
+func isSecretField(path string) bool {
+	return path == "data" || strings.HasPrefix(path, "data.") ||
+		path == "stringData" || strings.HasPrefix(path, "stringData.") ||
+		path == "metadata.annotations.kubectl.kubernetes.io/last-applied-configuration"
+}
+
+func diffValue(path string, before, after interface{}, secret bool, lines *[]string) {
+	if auditIgnoredFields[path] {
+		return
+	}
+	switch b := before.(type) {
+	case map[string]interface{}:
+		if a, ok := after.(map[string]interface{}); ok {
+			keys := map[string]bool{}
+			for k := range b {
+				keys[k] = true
+			}
+			for k := range a {
+				keys[k] = true
+			}
+			for k := range keys {
+				diffValue(joinAuditPath(path, k), b[k], a[k], secret, lines)
+			}
+			return
+		}
+	case []interface{}:
+		if a, ok := after.([]interface{}); ok {
+			l := len(b)
+			if len(a) > l {
+				l = len(a)
+			}
+			for i := 0; i < l; i++ {
+				var bv, av interface{}
+				if i < len(b) {
+					bv = b[i]
+				}
+				if i < len(a) {
+					av = a[i]
+				}
+				diffValue(fmt.Sprintf("%s[%d]", path, i), bv, av, secret, lines)
+			}
+			return
+		}
+	}
+	bs, as := auditValue(before), auditValue(after)
+	if bs == as {
+		return
+	}
+	if secret && isSecretField(path) {
+		bs, as = auditMaskedValue, auditMaskedValue
+		if before == nil {
+			bs = "<none>"
+		}
+		if after == nil {
+			as = "<none>"
+		}
+	}
+	*lines = append(*lines, fmt.Sprintf("%s: %s -> %s", path, bs, as))
+}
+
+func joinAuditPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func auditValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// recordApplyResult 记录 apply 接口中实际提交到集群的对象
+func recordApplyResult(operator, cluster string, r ApplyResult) {
+	if r.statusCode == 0 {
+		return
+	}
+	var detail string
+	if r.before != nil && r.after != nil {
+		detail = strings.Join(diffObjects(r.before, r.after, r.Resource == "secrets"), "\n")
+	}
+	gv := strings.Split(r.ApiVersion, "/")
+	path := resourcePath{
+		group:    r.group,
+		version:  gv[len(gv)-1],
+		resource: r.Resource,
+	}
+	saveAuditLog(operator, "apply", cluster, r.Namespace, r.Name, path, r.statusCode, detail)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResourcePath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected resourcePath
+		gvr      string
+	}{
+		{"/api/v1/namespaces/default/pods/web", resourcePath{version: "v1", namespace: "default", resource: "pods", name: "web"}, "v1/pods"},
+		{"/apis/apps/v1/namespaces/default/deployments/web/scale", resourcePath{group: "apps", version: "v1", namespace: "default", resource: "deployments", name: "web", subresource: "scale"}, "apps/v1/deployments/scale"},
+		{"/api/v1/namespaces/kube-system", resourcePath{version: "v1", resource: "namespaces", name: "kube-system"}, "v1/namespaces"},
+		{"/api/v1/namespaces/kube-system/finalize", resourcePath{version: "v1", resource: "namespaces", name: "kube-system", subresource: "finalize"}, "v1/namespaces/finalize"},
+		{"/apis/rbac.authorization.k8s.io/v1/clusterroles", resourcePath{group: "rbac.authorization.k8s.io", version: "v1", resource: "clusterroles"}, "rbac.authorization.k8s.io/v1/clusterroles"},
+	}
+	for _, c := range cases {
+		r := parseResourcePath(c.path)
+		if r != c.expected {
+			t.Errorf("%s: expected %+v, got %+v", c.path, c.expected, r)
+		}
+		if r.gvr() != c.gvr {
+			t.Errorf("%s: expected gvr %s, got %s", c.path, c.gvr, r.gvr())
+		}
+	}
+}
+
+func TestDiffObjects(t *testing.T) {
+	before := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "resourceVersion": "1"},
+		"spec": map[string]interface{}{
+			"replicas":   float64(1),
+			"containers": []interface{}{map[string]interface{}{"image": "nginx:1.20"}},
+		},
+	}
+	after := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "resourceVersion": "2"},
+		"spec": map[string]interface{}{
+			"replicas":   float64(3),
+			"containers": []interface{}{map[string]interface{}{"image": "nginx:1.21"}},
+		},
+	}
+	expected := []string{
+		`spec.containers[0].image: "nginx:1.20" -> "nginx:1.21"`,
+		`spec.replicas: 1 -> 3`,
+	}
+	if lines := diffObjects(before, after, false); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+
+	secretBefore := map[string]interface{}{"data": map[string]interface{}{"password": "YWRtaW4="}}
+	secretAfter := map[string]interface{}{"data": map[string]interface{}{"password": "cm9vdA==", "token": "dG9rZW4="}}
+	expected = []string{
+		`data.password: ****** -> ******`,
+		`data.token: <none> -> ******`,
+	}
+	if lines := diffObjects(secretBefore, secretAfter, true); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %v, got %v", expected, lines)
+	}
+}
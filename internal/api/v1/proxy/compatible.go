@@ -0,0 +1,322 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/discovery"
+)
+
+// 集群 api 资源的缓存时间
+const apiResolverCacheTime = 10 * time.Minute
+
+// apiResolver 根据集群实际提供的 group/version 将请求的资源路径解析到集群支持的最佳版本
+type apiResolver struct {
+	// group -> versions, 优先版本排在最前
+	versions map[string][]string
+	// group/version -> resources
+	resources map[string]map[string]bool
+	expireAt  time.Time
+}
+
+func newApiResolver(client discovery.DiscoveryInterface) (*apiResolver, error) {
+	groups, resourceLists, err := client.ServerGroupsAndResources()
+	if err != nil && len(resourceLists) == 0 {
+		return nil, err
+	}
+	r := &apiResolver{
+		versions:  map[string][]string{},
+		resources: map[string]map[string]bool{},
+		expireAt:  time.Now().Add(apiResolverCacheTime),
+	}
+	for i := range groups {
+		g := groups[i]
+		versions := []string{g.PreferredVersion.Version}
+		for j := range g.Versions {
+			if g.Versions[j].Version != g.PreferredVersion.Version {
+				versions = append(versions, g.Versions[j].Version)
+			}
+		}
+		r.versions[g.Name] = versions
+	}
+	for i := range resourceLists {
+		rs := map[string]bool{}
+		for j := range resourceLists[i].APIResources {
+			rs[resourceLists[i].APIResources[j].Name] = true
+		}
+		r.resources[resourceLists[i].GroupVersion] = rs
+	}
+	return r, nil
+}
+
+func (r *apiResolver) serves(group, version, resource string) bool {
+	return r.resources[group+"/"+version][resource]
+}
+
+// resolve 返回改写后的路径以及版本转换信息,集群支持请求的版本时返回 nil
+func (r *apiResolver) resolve(path string) (string, *versionResolution) {
+	ss := strings.Split(path, "/")
+	// "" "apis" group version resource...
+	if len(ss) < 5 || ss[1] != "apis" {
+		return path, nil
+	}
+	group, version := ss[2], ss[3]
+	resource := ss[4]
+	if resource == "namespaces" {
+		if len(ss) < 7 {
+			return path, nil
+		}
+		resource = ss[6]
+	}
+	if r.serves(group, version, resource) {
+		return path, nil
+	}
+	for _, v := range r.versions[group] {
+		if v != version && r.serves(group, v, resource) {
+			ss[3] = v
+			return strings.Join(ss, "/"), &versionResolution{
+				group:       group,
+				resource:    resource,
+				fromVersion: version,
+				toVersion:   v,
+			}
+		}
+	}
+	return path, nil
+}
+
+// 刷新失败后使用旧数据的时间,期间不再请求 apiserver
+const apiResolverRetryInterval = 30 * time.Second
+
+// apiResolverCache 按集群缓存 apiResolver,每个集群单独加锁,一个集群的 discovery 请求不会阻塞其他集群
+type apiResolverCache struct {
+	entries map[string]*apiResolverEntry
+	lock    sync.Mutex
+}
+
+type apiResolverEntry struct {
+	lock     sync.Mutex
+	resolver *apiResolver
+}
+
+var apiResolvers = apiResolverCache{entries: map[string]*apiResolverEntry{}}
+
+// Get 返回集群的 apiResolver,刷新失败时继续使用上次成功获取的数据
+func (c *apiResolverCache) Get(clusterId string, client discovery.DiscoveryInterface) (*apiResolver, error) {
+	c.lock.Lock()
+	e, ok := c.entries[clusterId]
+	if !ok {
+		e = &apiResolverEntry{}
+		c.entries[clusterId] = e
+	}
+	c.lock.Unlock()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.resolver != nil && e.resolver.expireAt.After(time.Now()) {
+		return e.resolver, nil
+	}
+	r, err := newApiResolver(client)
+	if err != nil {
+		if e.resolver == nil {
+			return nil, err
+		}
+		log.Printf("refresh api resources of cluster %s failed, use the cached data: %s", clusterId, err.Error())
+		e.resolver.expireAt = time.Now().Add(apiResolverRetryInterval)
+		return e.resolver, nil
+	}
+	e.resolver = r
+	return r, nil
+}
+
+func (c *apiResolverCache) forget(clusterId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, clusterId)
+}
+
+// ForgetCluster 集群被删除或更新连接信息后清除缓存的 api 资源
+func ForgetCluster(clusterId string) {
+	apiResolvers.forget(clusterId)
+}
+
+// versionResolution 记录请求版本(fromVersion)与集群实际使用版本(toVersion)之间的转换
+type versionResolution struct {
+	group       string
+	resource    string
+	fromVersion string
+	toVersion   string
+}
+
+type objectConverter func(obj map[string]interface{})
+
+type conversionKey struct {
+	groupResource string
+	from          string
+	to            string
+}
+
+var objectConverters = map[conversionKey]objectConverter{
+	{groupResource: "networking.k8s.io/ingresses", from: "v1beta1", to: "v1"}: convertIngressToV1,
+	{groupResource: "networking.k8s.io/ingresses", from: "v1", to: "v1beta1"}: convertIngressToV1beta1,
+}
+
+func (v *versionResolution) convert(obj map[string]interface{}, from, to string) {
+	if obj == nil {
+		return
+	}
+	if c, ok := objectConverters[conversionKey{groupResource: v.group + "/" + v.resource, from: from, to: to}]; ok {
+		c(obj)
+	}
+	if _, ok := obj["apiVersion"]; ok {
+		obj["apiVersion"] = v.group + "/" + to
+	}
+}
+
+// convertItems 将集群版本的对象转换为请求的版本
+func (v *versionResolution) convertItems(items []interface{}) {
+	for i := range items {
+		if obj, ok := items[i].(map[string]interface{}); ok {
+			v.convert(obj, v.toVersion, v.fromVersion)
+		}
+	}
+}
+
+// convertResponse 将集群返回的对象或列表转换为请求的版本
+func (v *versionResolution) convertResponse(data []byte) []byte {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	if kind, _ := obj["kind"].(string); kind == "Status" {
+		return data
+	}
+	if items, ok := obj["items"].([]interface{}); ok {
+		v.convertItems(items)
+		obj["apiVersion"] = v.group + "/" + v.fromVersion
+	} else {
+		v.convert(obj, v.toVersion, v.fromVersion)
+	}
+	result, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return result
+}
+
+// convertRequest 将请求体中的对象转换为集群使用的版本
+func (v *versionResolution) convertRequest(data []byte) []byte {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return data
+	}
+	v.convert(obj, v.fromVersion, v.toVersion)
+	result, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return result
+}
+
+func convertIngressToV1(obj map[string]interface{}) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if backend, ok := spec["backend"].(map[string]interface{}); ok {
+		spec["defaultBackend"] = ingressBackendToV1(backend)
+		delete(spec, "backend")
+	}
+	forEachIngressPath(spec, func(path map[string]interface{}) {
+		if backend, ok := path["backend"].(map[string]interface{}); ok {
+			path["backend"] = ingressBackendToV1(backend)
+		}
+		if _, ok := path["pathType"]; !ok {
+			path["pathType"] = "ImplementationSpecific"
+		}
+	})
+}
+
+func convertIngressToV1beta1(obj map[string]interface{}) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if backend, ok := spec["defaultBackend"].(map[string]interface{}); ok {
+		spec["backend"] = ingressBackendToV1beta1(backend)
+		delete(spec, "defaultBackend")
+	}
+	forEachIngressPath(spec, func(path map[string]interface{}) {
+		if backend, ok := path["backend"].(map[string]interface{}); ok {
+			path["backend"] = ingressBackendToV1beta1(backend)
+		}
+	})
+}
+
+func forEachIngressPath(spec map[string]interface{}, fn func(path map[string]interface{})) {
+	rules, _ := spec["rules"].([]interface{})
+	for i := range rules {
+		rule, ok := rules[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ruleHttp, ok := rule["http"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _ := ruleHttp["paths"].([]interface{})
+		for j := range paths {
+			if path, ok := paths[j].(map[string]interface{}); ok {
+				fn(path)
+			}
+		}
+	}
+}
+
+func ingressBackendToV1(backend map[string]interface{}) map[string]interface{} {
+	serviceName, ok := backend["serviceName"]
+	if !ok {
+		return backend
+	}
+	port := map[string]interface{}{}
+	switch p := backend["servicePort"].(type) {
+	case string:
+		port["name"] = p
+	case float64:
+		port["number"] = p
+	}
+	result := map[string]interface{}{
+		"service": map[string]interface{}{
+			"name": serviceName,
+			"port": port,
+		},
+	}
+	if resource, ok := backend["resource"]; ok {
+		result["resource"] = resource
+	}
+	return result
+}
+
+func ingressBackendToV1beta1(backend map[string]interface{}) map[string]interface{} {
+	service, ok := backend["service"].(map[string]interface{})
+	if !ok {
+		return backend
+	}
+	result := map[string]interface{}{
+		"serviceName": service["name"],
+	}
+	if port, ok := service["port"].(map[string]interface{}); ok {
+		if number, ok := port["number"]; ok {
+			result["servicePort"] = number
+		} else if name, ok := port["name"]; ok {
+			result["servicePort"] = name
+		}
+	}
+	if resource, ok := backend["resource"]; ok {
+		result["resource"] = resource
+	}
+	return result
+}
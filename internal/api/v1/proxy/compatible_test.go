@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+func newFakeResolver(t *testing.T, resources []*metav1.APIResourceList) *apiResolver {
+	client := &fakediscovery.FakeDiscovery{Fake: &kubetesting.Fake{Resources: resources}}
+	r, err := newApiResolver(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestApiResolverResolve(t *testing.T) {
+	r := newFakeResolver(t, []*metav1.APIResourceList{
+		{GroupVersion: "batch/v1beta1", APIResources: []metav1.APIResource{{Name: "cronjobs", Namespaced: true}}},
+		{GroupVersion: "batch/v1", APIResources: []metav1.APIResource{{Name: "jobs", Namespaced: true}}},
+		{GroupVersion: "networking.k8s.io/v1beta1", APIResources: []metav1.APIResource{{Name: "ingresses", Namespaced: true}}},
+		{GroupVersion: "policy/v1", APIResources: []metav1.APIResource{{Name: "poddisruptionbudgets", Namespaced: true}}},
+	})
+	cases := []struct {
+		path     string
+		expected string
+		resolved bool
+	}{
+		{"/apis/batch/v1/cronjobs", "/apis/batch/v1beta1/cronjobs", true},
+		{"/apis/batch/v1/namespaces/default/cronjobs/backup", "/apis/batch/v1beta1/namespaces/default/cronjobs/backup", true},
+		{"/apis/batch/v1/jobs", "/apis/batch/v1/jobs", false},
+		{"/apis/networking.k8s.io/v1/ingresses", "/apis/networking.k8s.io/v1beta1/ingresses", true},
+		{"/apis/policy/v1/poddisruptionbudgets", "/apis/policy/v1/poddisruptionbudgets", false},
+		{"/api/v1/pods", "/api/v1/pods", false},
+	}
+	for _, c := range cases {
+		path, resolution := r.resolve(c.path)
+		if path != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.path, c.expected, path)
+		}
+		if (resolution != nil) != c.resolved {
+			t.Errorf("%s: expected resolved %v", c.path, c.resolved)
+		}
+	}
+}
+
+func TestIngressResponseConversion(t *testing.T) {
+	v := &versionResolution{group: "networking.k8s.io", resource: "ingresses", fromVersion: "v1", toVersion: "v1beta1"}
+	raw := `{"kind":"IngressList","apiVersion":"networking.k8s.io/v1beta1","items":[{"metadata":{"name":"web"},"spec":{"backend":{"serviceName":"default","servicePort":80},"rules":[{"http":{"paths":[{"path":"/","backend":{"serviceName":"web","servicePort":"http"}}]}}]}}]}`
+	var list map[string]interface{}
+	if err := json.Unmarshal(v.convertResponse([]byte(raw)), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list["apiVersion"] != "networking.k8s.io/v1" {
+		t.Errorf("expected list apiVersion networking.k8s.io/v1, got %v", list["apiVersion"])
+	}
+	spec := list["items"].([]interface{})[0].(map[string]interface{})["spec"].(map[string]interface{})
+	defaultBackend := spec["defaultBackend"].(map[string]interface{})["service"].(map[string]interface{})
+	if defaultBackend["name"] != "default" || defaultBackend["port"].(map[string]interface{})["number"] != float64(80) {
+		t.Errorf("unexpected default backend %v", defaultBackend)
+	}
+	path := spec["rules"].([]interface{})[0].(map[string]interface{})["http"].(map[string]interface{})["paths"].([]interface{})[0].(map[string]interface{})
+	if path["pathType"] != "ImplementationSpecific" {
+		t.Errorf("expected default pathType, got %v", path["pathType"])
+	}
+	if path["backend"].(map[string]interface{})["service"].(map[string]interface{})["port"].(map[string]interface{})["name"] != "http" {
+		t.Errorf("unexpected path backend %v", path["backend"])
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(v.convertRequest([]byte(`{"apiVersion":"networking.k8s.io/v1","kind":"Ingress","spec":{"defaultBackend":{"service":{"name":"web","port":{"number":8080}}}}}`)), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj["apiVersion"] != "networking.k8s.io/v1beta1" {
+		t.Errorf("expected request apiVersion networking.k8s.io/v1beta1, got %v", obj["apiVersion"])
+	}
+	backend := obj["spec"].(map[string]interface{})["backend"].(map[string]interface{})
+	if backend["serviceName"] != "web" || backend["servicePort"] != float64(8080) {
+		t.Errorf("unexpected backend %v", backend)
+	}
+}
+
+// stubDiscovery 可以阻塞或返回错误的 discovery 客户端
+type stubDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	block chan struct{}
+	err   error
+}
+
+func (s *stubDiscovery) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	if s.block != nil {
+		<-s.block
+	}
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	return s.FakeDiscovery.ServerGroupsAndResources()
+}
+
+func newStubDiscovery() *stubDiscovery {
+	return &stubDiscovery{FakeDiscovery: &fakediscovery.FakeDiscovery{Fake: &kubetesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "pods"}}},
+	}}}}
+}
+
+func TestApiResolverCacheIsolatesClusters(t *testing.T) {
+	cache := apiResolverCache{entries: map[string]*apiResolverEntry{}}
+	slow := newStubDiscovery()
+	slow.block = make(chan struct{})
+	defer close(slow.block)
+	go func() { _, _ = cache.Get("slow", slow) }()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.Get("fast", newStubDiscovery())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow cluster blocks other clusters")
+	}
+}
+
+func TestApiResolverCacheKeepsLastGood(t *testing.T) {
+	cache := apiResolverCache{entries: map[string]*apiResolverEntry{}}
+	d := newStubDiscovery()
+	good, err := cache.Get("c1", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good.expireAt = time.Now().Add(-time.Second)
+	d.err = errors.New("connection refused")
+	r, err := cache.Get("c1", d)
+	if err != nil || r != good {
+		t.Fatalf("expected the cached resolver, got %v %v", r, err)
+	}
+	if !r.expireAt.After(time.Now()) {
+		t.Error("failed refresh should be retried later")
+	}
+	cache.forget("c1")
+	if _, err := cache.Get("c1", d); err == nil {
+		t.Error("forgotten cluster should not use the cached resolver")
+	}
+}
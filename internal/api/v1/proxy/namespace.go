@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	goContext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// 同时请求的 namespace 数量上限
+	multiNamespaceConcurrency = 10
+	// 单个 namespace 请求的超时时间
+	multiNamespaceTimeout = 30 * time.Second
+)
+
+type NamespaceResourceContainer struct {
+	metav1.TypeMeta  `json:",inline"`
+	metav1.ListMeta  `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
+	Items            []interface{}     `json:"items"`
+	Namespaces       []string          `json:"namespaces"`
+	FailedNamespaces []FailedNamespace `json:"failedNamespaces,omitempty"`
+}
+
+// FailedNamespace 记录多 namespace 查询时失败的 namespace 及原因
+type FailedNamespace struct {
+	Namespace  string `json:"namespace"`
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
+// MultiNamespacePage 在分页结果之外返回查询失败的 namespace
+type MultiNamespacePage struct {
+	pkgV1.Page
+	FailedNamespaces []FailedNamespace `json:"failedNamespaces,omitempty"`
+}
+
+type namespaceResult struct {
+	container *NamespaceResourceContainer
+	failed    *FailedNamespace
+}
+
+// fetchMultiNamespaceResource 以有限的并发逐个 namespace 查询资源并按 namespace 顺序合并结果
+// 部分 namespace 失败时返回其余 namespace 的结果以及失败列表,全部失败时返回错误
+func fetchMultiNamespaceResource(ctx goContext.Context, client *http.Client, namespaces []string, apiUrl url.URL, concurrency int) (*NamespaceResourceContainer, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]namespaceResult, len(namespaces))
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for i := range namespaces {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[index] = namespaceResult{failed: &FailedNamespace{Namespace: namespaces[index], Message: ctx.Err().Error()}}
+				return
+			}
+			results[index] = fetchNamespaceResource(ctx, client, namespaces[index], apiUrl)
+		}(i)
+	}
+	wg.Wait()
+
+	mergedContainer := NamespaceResourceContainer{Items: make([]interface{}, 0)}
+	var failedMessages []string
+	for i := range results {
+		if results[i].failed != nil {
+			mergedContainer.FailedNamespaces = append(mergedContainer.FailedNamespaces, *results[i].failed)
+			failedMessages = append(failedMessages, results[i].failed.Message)
+			continue
+		}
+		nc := results[i].container
+		mergedContainer.TypeMeta = nc.TypeMeta
+		mergedContainer.ListMeta = nc.ListMeta
+		mergedContainer.Namespaces = append(mergedContainer.Namespaces, namespaces[i])
+		mergedContainer.Items = append(mergedContainer.Items, nc.Items...)
+	}
+	if len(namespaces) > 0 && len(mergedContainer.FailedNamespaces) == len(namespaces) {
+		// 所有 namespace 的失败原因一致时透传上游的状态码与返回内容
+		first := mergedContainer.FailedNamespaces[0]
+		sameCode := first.StatusCode != 0
+		for i := range mergedContainer.FailedNamespaces {
+			if mergedContainer.FailedNamespaces[i].StatusCode != first.StatusCode {
+				sameCode = false
+				break
+			}
+		}
+		if sameCode {
+			return nil, &upstreamError{StatusCode: first.StatusCode, Body: []byte(first.Message)}
+		}
+		return nil, errors.New(strings.Join(failedMessages, ""))
+	}
+	return &mergedContainer, nil
+}
+
+func fetchNamespaceResource(ctx goContext.Context, client *http.Client, namespace string, apiUrl url.URL) namespaceResult {
+	failed := func(code int, message string) namespaceResult {
+		return namespaceResult{failed: &FailedNamespace{Namespace: namespace, StatusCode: code, Message: message}}
+	}
+	reqCtx, cancel := goContext.WithTimeout(ctx, multiNamespaceTimeout)
+	defer cancel()
+	newUrl := apiUrl
+	newUrl.Path = addUrlNamespace(apiUrl.Path, namespace)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, newUrl.String(), nil)
+	if err != nil {
+		return failed(0, err.Error())
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return failed(0, err.Error())
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return failed(resp.StatusCode, err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return failed(resp.StatusCode, string(body))
+	}
+	var nc NamespaceResourceContainer
+	if err := json.Unmarshal(body, &nc); err != nil {
+		return failed(resp.StatusCode, fmt.Sprintf("can not decode response of namespace %s: %s", namespace, err.Error()))
+	}
+	return namespaceResult{container: &nc}
+}
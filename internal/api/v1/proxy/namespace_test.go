@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	goContext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeApiServer struct {
+	forbidden map[string]bool
+	delay     time.Duration
+	inflight  int32
+	maxFlight int32
+}
+
+func (f *fakeApiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	current := atomic.AddInt32(&f.inflight, 1)
+	defer atomic.AddInt32(&f.inflight, -1)
+	for {
+		max := atomic.LoadInt32(&f.maxFlight)
+		if current <= max || atomic.CompareAndSwapInt32(&f.maxFlight, max, current) {
+			break
+		}
+	}
+	select {
+	case <-time.After(f.delay):
+	case <-r.Context().Done():
+		return
+	}
+	// /api/v1/namespaces/{ns}/pods
+	ss := strings.Split(r.URL.Path, "/")
+	ns := ss[4]
+	if f.forbidden[ns] {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprintf(w, `{"kind":"Status","reason":"Forbidden","message":"pods is forbidden in %s"}`, ns)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":       "PodList",
+		"apiVersion": "v1",
+		"items": []interface{}{
+			map[string]interface{}{"metadata": map[string]interface{}{"name": "pod-" + ns, "namespace": ns}},
+		},
+	})
+}
+
+func newFakeApiServer(t *testing.T, f *fakeApiServer) (*httptest.Server, url.URL) {
+	s := httptest.NewServer(f)
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL + "/api/v1/pods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, *u
+}
+
+func TestFetchMultiNamespaceResourceOrder(t *testing.T) {
+	s, u := newFakeApiServer(t, &fakeApiServer{})
+	namespaces := []string{"ns-c", "ns-a", "ns-b", "ns-d"}
+	result, err := fetchMultiNamespaceResource(goContext.Background(), s.Client(), namespaces, u, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != len(namespaces) {
+		t.Fatalf("expected %d items, got %d", len(namespaces), len(result.Items))
+	}
+	for i := range namespaces {
+		name := result.Items[i].(map[string]interface{})["metadata"].(map[string]interface{})["name"]
+		if name != "pod-"+namespaces[i] {
+			t.Errorf("item %d: expected pod-%s, got %v", i, namespaces[i], name)
+		}
+	}
+	if result.Kind != "PodList" {
+		t.Errorf("expected kind PodList, got %s", result.Kind)
+	}
+}
+
+func TestFetchMultiNamespaceResourcePartialFailure(t *testing.T) {
+	s, u := newFakeApiServer(t, &fakeApiServer{forbidden: map[string]bool{"ns-b": true}})
+	result, err := fetchMultiNamespaceResource(goContext.Background(), s.Client(), []string{"ns-a", "ns-b", "ns-c"}, u, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != 2 {
+		t.Errorf("expected 2 items, got %d", len(result.Items))
+	}
+	if len(result.FailedNamespaces) != 1 {
+		t.Fatalf("expected 1 failed namespace, got %d", len(result.FailedNamespaces))
+	}
+	failed := result.FailedNamespaces[0]
+	if failed.Namespace != "ns-b" || failed.StatusCode != http.StatusForbidden {
+		t.Errorf("unexpected failed namespace %+v", failed)
+	}
+}
+
+func TestFetchMultiNamespaceResourceAllFailed(t *testing.T) {
+	s, u := newFakeApiServer(t, &fakeApiServer{forbidden: map[string]bool{"ns-a": true}})
+	_, err := fetchMultiNamespaceResource(goContext.Background(), s.Client(), []string{"ns-a"}, u, 1)
+	if err == nil {
+		t.Fatal("expected error when all namespaces failed")
+	}
+	if !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("expected forbidden message, got %s", err.Error())
+	}
+	var ue *upstreamError
+	if !errors.As(err, &ue) || ue.StatusCode != http.StatusForbidden {
+		t.Errorf("expected upstream status %d to be preserved, got %v", http.StatusForbidden, err)
+	}
+}
+
+func TestFetchMultiNamespaceResourceConcurrency(t *testing.T) {
+	f := &fakeApiServer{delay: 20 * time.Millisecond}
+	s, u := newFakeApiServer(t, f)
+	var namespaces []string
+	for i := 0; i < 12; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("ns-%d", i))
+	}
+	result, err := fetchMultiNamespaceResource(goContext.Background(), s.Client(), namespaces, u, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Items) != len(namespaces) {
+		t.Errorf("expected %d items, got %d", len(namespaces), len(result.Items))
+	}
+	if max := atomic.LoadInt32(&f.maxFlight); max > 3 {
+		t.Errorf("expected at most 3 concurrent requests, got %d", max)
+	}
+}
+
+func TestFetchMultiNamespaceResourceCanceled(t *testing.T) {
+	s, u := newFakeApiServer(t, &fakeApiServer{delay: time.Second})
+	ctx, cancel := goContext.WithTimeout(goContext.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := fetchMultiNamespaceResource(ctx, s.Client(), []string{"ns-a", "ns-b", "ns-c"}, u, 1)
+	if err == nil {
+		t.Fatal("expected error when request is canceled")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("fan-out did not stop after cancel")
+	}
+}
@@ -1,50 +1,43 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
 	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
-	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 )
 
 type Handler struct {
-	clusterService        cluster.Service
-	clusterBindingService clusterbinding.Service
+	clusterService cluster.Service
 }
 
 func NewHandler() *Handler {
 	return &Handler{
-		clusterService:        cluster.NewService(),
-		clusterBindingService: clusterbinding.NewService(),
+		clusterService: cluster.NewService(),
 	}
 }
 
-type NamespaceResourceContainer struct {
-	metav1.TypeMeta `json:",inline"`
-	metav1.ListMeta `json:"metadata,omitempty" protobuf:"bytes,1,opt,name=metadata"`
-	Items           []interface{} `json:"items"`
-	Namespaces      []string      `json:"namespaces"`
-}
-
 func (h *Handler) KubernetesAPIProxy() iris.Handler {
 	return func(ctx *context.Context) {
 		// 解析参数
@@ -56,6 +49,14 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 		if ctx.URLParamExists("search") {
 			search, _ = ctx.URLParamBool("search")
 		}
+		matchers, err := parseQuery(ctx.URLParam("query"))
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		// limit/continue 分页只适用于单一 namespace 的查询
+		continuePaging := ctx.URLParamExists("limit") || ctx.URLParamExists("continue")
 
 		requestMethod := ctx.Request().Method
 		// 获取当亲集群
@@ -65,6 +66,9 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
 			return
 		}
+		if !commons.CheckClusterAccess(ctx, c, isMutatingRequest(requestMethod, proxyPath)) {
+			return
+		}
 		// 获取session
 		u := ctx.Values().Get("profile")
 		profile := u.(session.UserProfile)
@@ -78,13 +82,20 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 		// 生成httpClient
 		httpClient := http.Client{Transport: ts}
 		k := kubernetes.NewKubernetes(c)
-		clusterVersionMinor, err := k.VersionMinor()
+		client, err := k.Client()
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
 			return
 		}
-		compatibleClusterVersion(clusterVersionMinor, &proxyPath)
+		// 将请求的资源版本解析为集群实际支持的版本
+		// 获取失败时不改写路径,由 apiserver 返回错误
+		var resolution *versionResolution
+		if resolver, err := apiResolvers.Get(c.UUID, client.Discovery()); err != nil {
+			log.Printf("get api resources of cluster %s failed: %s", name, err.Error())
+		} else {
+			proxyPath, resolution = resolver.resolve(proxyPath)
+		}
 
 		//判断是否已经包含了namespace的查询
 		hasNsFilter := hasNamespaceFilter(proxyPath)
@@ -123,6 +134,12 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 		}
 		apiUrl.RawQuery = ctx.Request().URL.RawQuery
 		if http.MethodGet == requestMethod && namespace == "" && namespaced && !canVisitAll {
+			// 多 namespace 的结果需要合并后返回,无法持续输出
+			if isStreamingRequest(requestMethod, apiUrl.Query()) {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", "watch/follow requests must specify a namespace")
+				return
+			}
 			// 调用多namespace 逻辑
 			allowedNamespaces, err := k.GetUserNamespaceNames(profile.Name)
 			if err != nil {
@@ -130,12 +147,25 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 				ctx.Values().Set("message", err)
 				return
 			}
-			resp, err := fetchMultiNamespaceResource(&httpClient, allowedNamespaces, *apiUrl)
+			query := apiUrl.Query()
+			query.Del("limit")
+			query.Del("continue")
+			apiUrl.RawQuery = query.Encode()
+			resp, err := fetchMultiNamespaceResource(ctx.Request().Context(), &httpClient, allowedNamespaces, *apiUrl, multiNamespaceConcurrency)
 			if err != nil {
+				var ue *upstreamError
+				if errors.As(err, &ue) {
+					writeUpstreamError(ctx, ue.StatusCode, ue.Body)
+					return
+				}
 				ctx.StatusCode(iris.StatusInternalServerError)
-				ctx.Values().Set("message", err)
+				ctx.Values().Set("message", err.Error())
 				return
 			}
+			if resolution != nil {
+				resolution.convertItems(resp.Items)
+				resp.APIVersion = resolution.group + "/" + resolution.fromVersion
+			}
 			klo := K8sListObj{
 				Kind:       resp.Kind,
 				ApiVersion: resp.APIVersion,
@@ -143,37 +173,77 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 				Items:      resp.Items,
 			}
 
-			p, err := pagerAndSearch(ctx, klo, keywords)
+			p, err := pagerAndSearch(ctx, klo, keywords, matchers)
 			if err != nil {
 				ctx.StatusCode(iris.StatusInternalServerError)
 				ctx.Values().Set("message", err)
 				return
 			}
-			_, _ = ctx.JSON(p)
+			_, _ = ctx.JSON(MultiNamespacePage{Page: *p, FailedNamespaces: resp.FailedNamespaces})
 			return
 		}
 		if http.MethodGet == requestMethod && namespaced && namespace != "" && !hasNsFilter {
 			apiUrl.Path = addUrlNamespace(apiUrl.Path, namespace)
 		}
 
-		req, err := http.NewRequest(ctx.Request().Method, apiUrl.String(), ctx.Request().Body)
+		var body io.Reader = ctx.Request().Body
+		var audit *proxyAudit
+		if isMutatingRequest(requestMethod, proxyPath) {
+			data, err := ctx.GetBody()
+			if err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			if resolution != nil && (requestMethod == http.MethodPost || requestMethod == http.MethodPut) {
+				data = resolution.convertRequest(data)
+			}
+			body = bytes.NewReader(data)
+			// 记录变更操作,dryRun 请求不会修改集群
+			if !isDryRun(apiUrl.Query()) {
+				audit = newProxyAudit(profile.Name, name, requestMethod, parseResourcePath(apiUrl.Path), data)
+				audit.fetchBefore(ctx.Request().Context(), &httpClient, *apiUrl)
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx.Request().Context(), ctx.Request().Method, apiUrl.String(), body)
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
 			return
 		}
-		if ctx.Method() == "PATCH" {
-			req.Header.Set("Content-Type", "application/merge-patch+json")
-		}
+		req.Header.Set("Content-Type", requestContentType(ctx.Method(), ctx.GetHeader("Content-Type")))
 		resp, err := httpClient.Do(req)
 		if err != nil {
+			if audit != nil {
+				audit.record(iris.StatusInternalServerError, nil)
+			}
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
 			return
 		}
+		defer resp.Body.Close()
+		// watch/follow 以及分块返回的请求直接流式转发
+		if resp.StatusCode < http.StatusBadRequest && !search {
+			if isStreamingRequest(req.Method, apiUrl.Query()) || (req.Method == http.MethodGet && isStreamingResponse(resp)) {
+				release, ok := commons.AcquireStream(ctx, name)
+				if !ok {
+					return
+				}
+				defer release()
+				_ = streamResponse(ctx, resp)
+				return
+			}
+		}
 		rawResp, _ := ioutil.ReadAll(resp.Body)
-		if resp.StatusCode == http.StatusForbidden {
-			resp.StatusCode = http.StatusInternalServerError
+		if audit != nil {
+			audit.record(resp.StatusCode, rawResp)
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			writeUpstreamError(ctx, resp.StatusCode, rawResp)
+			return
+		}
+		if resolution != nil {
+			rawResp = resolution.convertResponse(rawResp)
 		}
 		if req.Method == http.MethodGet && search {
 			var listObj K8sListObj
@@ -182,7 +252,11 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 				ctx.Values().Set("message", err)
 				return
 			}
-			p, err := pagerAndSearch(ctx, listObj, keywords)
+			if continuePaging {
+				_, _ = ctx.JSON(continuePager(listObj, keywords, matchers))
+				return
+			}
+			p, err := pagerAndSearch(ctx, listObj, keywords, matchers)
 			if err != nil {
 				ctx.StatusCode(iris.StatusInternalServerError)
 				ctx.Values().Set("message", err.Error())
@@ -192,23 +266,20 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 			return
 		}
 		ctx.StatusCode(resp.StatusCode)
-		ctx.Values().Set("message", string(rawResp))
 		_, _ = ctx.Write(rawResp)
 	}
 }
 
 var timeTemplate = "2006-01-02T15:04:05Z"
 
-func pagerAndSearch(ctx *context.Context, listObj K8sListObj, keywords string) (*pkgV1.Page, error) {
+func pagerAndSearch(ctx *context.Context, listObj K8sListObj, keywords string, matchers []fieldMatcher) (*pkgV1.Page, error) {
 	num, err1 := ctx.Values().GetInt("pageNum")
 	size, err2 := ctx.Values().GetInt("pageSize")
 	var p pkgV1.Page
 	if listObj.Kind != "NodeList" {
 		listObj.Sort()
 	}
-	if keywords != "" {
-		listObj.Items = fieldFilter(listObj.Items, withNamespaceAndNameMatcher(keywords))
-	}
+	listObj.Items = searchFilter(listObj.Items, keywords, matchers)
 	if err1 == nil && err2 == nil {
 		tt, items, err := pageFilter(num, size, listObj.Items)
 		if err != nil {
@@ -224,6 +295,43 @@ func pagerAndSearch(ctx *context.Context, listObj K8sListObj, keywords string) (
 	return &p, nil
 }
 
+// 无法得知总数时 total 的值
+const unknownTotal = -1
+
+// continuePager 使用 k8s 原生的 limit/continue 分页,只在当前页内做搜索过滤
+// total 为当前页及之后各页的对象数量,由 remainingItemCount 计算;
+// 带有搜索条件或 apiserver 没有返回 remainingItemCount 时无法得知,total 为 -1
+func continuePager(listObj K8sListObj, keywords string, matchers []fieldMatcher) *pkgV1.Page {
+	var p pkgV1.Page
+	total := len(listObj.Items)
+	if m, ok := listObj.Metadata.(map[string]interface{}); ok {
+		if c, ok := m["continue"].(string); ok {
+			p.Continue = c
+		}
+		if remaining, ok := m["remainingItemCount"].(float64); ok {
+			total += int(remaining)
+		} else if p.Continue != "" {
+			total = unknownTotal
+		}
+	}
+	if keywords != "" || len(matchers) > 0 {
+		total = unknownTotal
+	}
+	p.Total = total
+	p.Items = searchFilter(listObj.Items, keywords, matchers)
+	return &p
+}
+
+func searchFilter(items []interface{}, keywords string, matchers []fieldMatcher) []interface{} {
+	if keywords != "" {
+		items = fieldFilter(items, withNamespaceAndNameMatcher(keywords))
+	}
+	if len(matchers) > 0 {
+		items = fieldFilter(items, allMatcher(matchers))
+	}
+	return items
+}
+
 func getTime(obj interface{}) time.Time {
 	//判断是否存在lasttime
 	o := obj.(map[string]interface{})
@@ -298,16 +406,6 @@ type keywordsMatcher struct {
 	keywords string
 }
 
-func compatibleClusterVersion(minor int, path *string) {
-	p := *path
-	if minor <= 18 {
-		if strings.Contains(p, "networking.k8s.io/v1") && strings.Contains(p, "ingresses") {
-			p = strings.Replace(p, "networking.k8s.io/v1", "networking.k8s.io/v1beta1", -1)
-		}
-	}
-	*path = p
-}
-
 func hasNamespaceFilter(path string) bool {
 	ss := strings.Split(path, "/")
 	for i := range ss {
@@ -362,84 +460,41 @@ func pageFilter(num, size int, data []interface{}) (int, []interface{}, error) {
 	return total, result, nil
 }
 
-func fetchMultiNamespaceResource(client *http.Client, namespaces []string, apiUrl url.URL) (*NamespaceResourceContainer, error) {
-	wg := &sync.WaitGroup{}
-	var mergedContainer NamespaceResourceContainer
-	var responses []*http.Response
-	var es []error
-	for i := range namespaces {
-		wg.Add(1)
-		ns := namespaces[i]
-		go func() {
-			newUrl := apiUrl
-			newUrl.Path = addUrlNamespace(apiUrl.Path, ns)
-			resp, err := client.Get(newUrl.String())
-			if err != nil {
-				es = append(es, err)
-				wg.Done()
-				return
-			}
-			responses = append(responses, resp)
-			wg.Done()
-		}()
-
-	}
-	wg.Wait()
-	var forbidden int
-	var forbiddenMessage []string
-	for i := range responses {
-		r := responses[i]
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			return nil, err
-		}
-		if r.StatusCode != http.StatusOK {
-			if r.StatusCode == http.StatusForbidden {
-				forbidden++
-				forbiddenMessage = append(forbiddenMessage, string(body))
-				continue
-			} else {
-				return nil, errors.New(string(body))
-			}
-		}
-		var nc NamespaceResourceContainer
-		if err := json.Unmarshal(body, &nc); err != nil {
-			return nil, err
-		}
-		mergedContainer.TypeMeta = nc.TypeMeta
-		mergedContainer.ListMeta = nc.ListMeta
-		mergedContainer.Items = append(mergedContainer.Items, nc.Items...)
-	}
-	if len(namespaces) == 1 && forbidden == 1 {
-		return nil, errors.New(strings.Join(forbiddenMessage, ""))
+func (h *Handler) generateTLSTransport(c *v1Cluster.Cluster, profile session.UserProfile) (http.RoundTripper, error) {
+	kubeConf, err := h.generateRestConfig(c, profile)
+	if err != nil {
+		return nil, err
 	}
-	return &mergedContainer, nil
+	return rest.TransportFor(kubeConf)
 }
 
-func (h *Handler) generateTLSTransport(c *v1Cluster.Cluster, profile session.UserProfile) (http.RoundTripper, error) {
-	if profile.IsAdministrator {
-		c := kubernetes.NewKubernetes(c)
-		adminConfig, err := c.Config()
-		if err != nil {
-			return nil, err
-		}
-		return rest.TransportFor(adminConfig)
+// generateRestConfig 生成以当前用户身份访问集群的配置,管理员使用集群的管理员凭据
+func (h *Handler) generateRestConfig(c *v1Cluster.Cluster, profile session.UserProfile) (*rest.Config, error) {
+	return commons.UserRestConfig(c, profile)
+}
 
-	}
+var patchContentTypes = []string{
+	string(types.JSONPatchType),
+	string(types.MergePatchType),
+	string(types.StrategicMergePatchType),
+	string(types.ApplyPatchType),
+}
 
-	binding, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{})
-	if err != nil {
-		return nil, err
+// requestContentType 透传客户端的 Content-Type,PATCH 请求未指定合法类型时默认使用 merge patch
+func requestContentType(method string, contentType string) string {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	if method != http.MethodPatch {
+		if mediaType == "" {
+			return "application/json"
+		}
+		return contentType
 	}
-	kubeConf := &rest.Config{
-		Host: c.Spec.Connect.Forward.ApiServer,
-		TLSClientConfig: rest.TLSClientConfig{
-			Insecure: true,
-			CertData: binding.Certificate,
-			KeyData:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey}),
-		},
+	for i := range patchContentTypes {
+		if mediaType == patchContentTypes[i] {
+			return mediaType
+		}
 	}
-	return rest.TransportFor(kubeConf)
+	return string(types.MergePatchType)
 }
 
 func ensureProxyPathValid(path string) string {
@@ -468,5 +523,7 @@ func addUrlNamespace(path string, ns string) string {
 func Install(parent iris.Party) {
 	handler := NewHandler()
 	sp := parent.Party("/proxy")
+	sp.Use(commons.RateLimitHandler())
 	sp.Any("/:name/k8s/{p:path}", handler.KubernetesAPIProxy())
+	sp.Post("/:name/apply", handler.ApplyResources())
 }
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// 查询语句由空格分隔的若干条件组成,所有条件同时满足才算匹配:
+//
+//	label:app=web            标签选择器(支持 =, !=, in, notin, exists 语法,不能包含空格)
+//	owner:ReplicaSet/web-x   ownerReferences 中的 kind/name,也可只写 name
+//	status.phase=Running     按 json 字段路径等值匹配
+//	spec.nodeName!=node1     按 json 字段路径不等匹配
+//	metadata.name~web        按 json 字段路径包含匹配
+//	web                      其他关键字与 keywords 参数的匹配规则一致
+func parseQuery(query string) ([]fieldMatcher, error) {
+	var ms []fieldMatcher
+	for _, term := range strings.Fields(query) {
+		m, err := parseQueryTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func parseQueryTerm(term string) (fieldMatcher, error) {
+	switch {
+	case strings.HasPrefix(term, "label:"):
+		selector, err := labels.Parse(strings.TrimPrefix(term, "label:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid label query %s: %s", term, err.Error())
+		}
+		return &labelMatcher{selector: selector}, nil
+	case strings.HasPrefix(term, "owner:"):
+		owner := strings.TrimPrefix(term, "owner:")
+		m := &ownerMatcher{name: owner}
+		if i := strings.Index(owner, "/"); i >= 0 {
+			m.kind, m.name = owner[:i], owner[i+1:]
+		}
+		if m.name == "" {
+			return nil, fmt.Errorf("invalid owner query %s", term)
+		}
+		return m, nil
+	}
+	for _, op := range []string{"!=", "=", "~"} {
+		if i := strings.Index(term, op); i > 0 {
+			return &pathMatcher{
+				path:     strings.Split(term[:i], "."),
+				operator: op,
+				value:    term[i+len(op):],
+			}, nil
+		}
+	}
+	return withNamespaceAndNameMatcher(term), nil
+}
+
+type labelMatcher struct {
+	selector labels.Selector
+}
+
+func (l labelMatcher) Match(item interface{}) bool {
+	ls := map[string]string{}
+	if raw, ok := lookupPath(item, []string{"metadata", "labels"}).(map[string]interface{}); ok {
+		for k, v := range raw {
+			if s, ok := v.(string); ok {
+				ls[k] = s
+			}
+		}
+	}
+	return l.selector.Matches(labels.Set(ls))
+}
+
+type ownerMatcher struct {
+	kind string
+	name string
+}
+
+func (o ownerMatcher) Match(item interface{}) bool {
+	refs, ok := lookupPath(item, []string{"metadata", "ownerReferences"}).([]interface{})
+	if !ok {
+		return false
+	}
+	for i := range refs {
+		ref, ok := refs[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if o.kind != "" && !strings.EqualFold(fmt.Sprint(ref["kind"]), o.kind) {
+			continue
+		}
+		if fmt.Sprint(ref["name"]) == o.name {
+			return true
+		}
+	}
+	return false
+}
+
+type pathMatcher struct {
+	path     []string
+	operator string
+	value    string
+}
+
+func (p pathMatcher) Match(item interface{}) bool {
+	v := lookupPath(item, p.path)
+	actual := ""
+	if v != nil {
+		actual = fmt.Sprint(v)
+	}
+	switch p.operator {
+	case "=":
+		return actual == p.value
+	case "!=":
+		return actual != p.value
+	case "~":
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(p.value))
+	}
+	return false
+}
+
+func lookupPath(item interface{}, path []string) interface{} {
+	current := item
+	for i := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[path[i]]
+	}
+	return current
+}
+
+// allMatcher 所有子条件都满足时才匹配
+type allMatcher []fieldMatcher
+
+func (a allMatcher) Match(item interface{}) bool {
+	for i := range a {
+		if !a[i].Match(item) {
+			return false
+		}
+	}
+	return true
+}
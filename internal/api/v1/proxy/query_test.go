@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func testPod(name, namespace, phase string, labels map[string]interface{}, owner string) map[string]interface{} {
+	metadata := map[string]interface{}{"name": name, "namespace": namespace, "labels": labels}
+	if owner != "" {
+		metadata["ownerReferences"] = []interface{}{
+			map[string]interface{}{"kind": "ReplicaSet", "name": owner},
+		}
+	}
+	return map[string]interface{}{
+		"metadata": metadata,
+		"status":   map[string]interface{}{"phase": phase},
+	}
+}
+
+func testPods() []interface{} {
+	return []interface{}{
+		testPod("web-1", "default", "Running", map[string]interface{}{"app": "web", "tier": "frontend"}, "web-x"),
+		testPod("web-2", "default", "Pending", map[string]interface{}{"app": "web"}, "web-x"),
+		testPod("db-1", "data", "Running", map[string]interface{}{"app": "db"}, ""),
+	}
+}
+
+func names(items []interface{}) []string {
+	var ns []string
+	for i := range items {
+		ns = append(ns, lookupPath(items[i], []string{"metadata", "name"}).(string))
+	}
+	return ns
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"web-1", "web-2", "db-1"}},
+		{"label:app=web", []string{"web-1", "web-2"}},
+		{"label:app!=web", []string{"db-1"}},
+		{"label:tier", []string{"web-1"}},
+		{"owner:ReplicaSet/web-x", []string{"web-1", "web-2"}},
+		{"owner:replicaset/web-x", []string{"web-1", "web-2"}},
+		{"owner:Deployment/web-x", nil},
+		{"owner:web-x", []string{"web-1", "web-2"}},
+		{"status.phase=Running", []string{"web-1", "db-1"}},
+		{"status.phase!=Running", []string{"web-2"}},
+		{"metadata.name~WEB", []string{"web-1", "web-2"}},
+		{"spec.nodeName=", []string{"web-1", "web-2", "db-1"}},
+		{"label:app=web status.phase=Running", []string{"web-1"}},
+		{"data", []string{"db-1"}},
+	}
+	for _, tt := range tests {
+		matchers, err := parseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("parseQuery(%q) failed: %s", tt.query, err)
+		}
+		got := names(searchFilter(testPods(), "", matchers))
+		if len(got) != len(tt.want) {
+			t.Errorf("query %q matched %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("query %q matched %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	for _, query := range []string{"label:app=(", "owner:", "owner:ReplicaSet/"} {
+		if _, err := parseQuery(query); err == nil {
+			t.Errorf("parseQuery(%q) should fail", query)
+		}
+	}
+}
+
+func TestContinuePager(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		keywords string
+		query    string
+		total    int
+		items    int
+		next     string
+	}{
+		{"last page", map[string]interface{}{}, "", "", 3, 3, ""},
+		{"with remaining", map[string]interface{}{"continue": "c1", "remainingItemCount": float64(7)}, "", "", 10, 3, "c1"},
+		{"remaining unknown", map[string]interface{}{"continue": "c1"}, "", "", unknownTotal, 3, "c1"},
+		{"filtered by keywords", map[string]interface{}{"continue": "c1", "remainingItemCount": float64(7)}, "web", "", unknownTotal, 2, "c1"},
+		{"filtered by query", map[string]interface{}{}, "", "status.phase=Running", unknownTotal, 2, ""},
+	}
+	for _, tt := range tests {
+		matchers, err := parseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := continuePager(K8sListObj{Metadata: tt.metadata, Items: testPods()}, tt.keywords, matchers)
+		if p.Total != tt.total || len(p.Items.([]interface{})) != tt.items || p.Continue != tt.next {
+			t.Errorf("%s: got total %d, %d items, continue %q", tt.name, p.Total, len(p.Items.([]interface{})), p.Continue)
+		}
+	}
+}
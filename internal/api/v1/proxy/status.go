@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/json"
+
+	"github.com/KubeOperator/kubepi/pkg/i18n"
+	"github.com/kataras/iris/v12/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// upstreamError 保存 api server 返回的错误状态码与原始内容
+type upstreamError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *upstreamError) Error() string {
+	return string(e.Body)
+}
+
+var statusReasonMessages = map[metav1.StatusReason]string{
+	metav1.StatusReasonForbidden:     "kubernetes forbidden: %s",
+	metav1.StatusReasonNotFound:      "kubernetes not found: %s",
+	metav1.StatusReasonAlreadyExists: "kubernetes already exists: %s",
+	metav1.StatusReasonConflict:      "kubernetes conflict: %s",
+}
+
+// writeUpstreamError 原样返回 api server 的状态码与 Status 对象,
+// 并在 localizedMessage 字段中附带翻译后的提示信息
+func writeUpstreamError(ctx *context.Context, statusCode int, body []byte) {
+	ctx.StatusCode(statusCode)
+	var status metav1.Status
+	var raw map[string]interface{}
+	if json.Unmarshal(body, &status) != nil || status.Kind != "Status" || json.Unmarshal(body, &raw) != nil {
+		ctx.Values().Set("message", string(body))
+		_, _ = ctx.Write(body)
+		return
+	}
+	raw["localizedMessage"] = translateStatus(ctx.Values().GetString("language"), &status)
+	_, _ = ctx.JSON(raw)
+}
+
+func translateStatus(lang string, status *metav1.Status) string {
+	key, ok := statusReasonMessages[status.Reason]
+	if !ok {
+		return status.Message
+	}
+	msg, err := i18n.Translate(lang, key, []string{status.Message})
+	if err != nil {
+		return status.Message
+	}
+	return msg
+}
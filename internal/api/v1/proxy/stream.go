@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+const streamBufferSize = 32 * 1024
+
+// isStreamingRequest 判断是否为 watch/follow 等需要长连接持续输出的请求
+func isStreamingRequest(method string, query url.Values) bool {
+	if method != http.MethodGet {
+		return false
+	}
+	for _, key := range []string{"watch", "follow"} {
+		v := strings.ToLower(query.Get(key))
+		if v == "true" || v == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// isStreamingResponse 判断上游响应是否为分块的流式响应
+func isStreamingResponse(resp *http.Response) bool {
+	for i := range resp.TransferEncoding {
+		if resp.TransferEncoding[i] == "chunked" {
+			return true
+		}
+	}
+	return resp.ContentLength < 0
+}
+
+// streamResponse 将上游响应按块转发给客户端,每块写入后立即 flush
+// 客户端断开时 request context 被取消,上游读取随之返回
+func streamResponse(ctx *context.Context, resp *http.Response) error {
+	header := ctx.ResponseWriter().Header()
+	for _, key := range []string{"Content-Type", "Cache-Control"} {
+		if v := resp.Header.Get(key); v != "" {
+			header.Set(key, v)
+		}
+	}
+	header.Set("X-Accel-Buffering", "no")
+	ctx.StatusCode(resp.StatusCode)
+	ctx.ResponseWriter().Flush()
+
+	done := ctx.Request().Context().Done()
+	buf := make([]byte, streamBufferSize)
+	for {
+		select {
+		case <-done:
+			return ctx.Request().Context().Err()
+		default:
+		}
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := ctx.ResponseWriter().Write(buf[:n]); werr != nil {
+				return werr
+			}
+			ctx.ResponseWriter().Flush()
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	goContext "context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestIsStreamingRequest(t *testing.T) {
+	tests := []struct {
+		method string
+		query  string
+		want   bool
+	}{
+		{http.MethodGet, "watch=true", true},
+		{http.MethodGet, "watch=1", true},
+		{http.MethodGet, "follow=TRUE", true},
+		{http.MethodGet, "watch=false", false},
+		{http.MethodGet, "limit=10", false},
+		{http.MethodPost, "watch=true", false},
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		if got := isStreamingRequest(tt.method, query); got != tt.want {
+			t.Errorf("isStreamingRequest(%s, %s) = %v, want %v", tt.method, tt.query, got, tt.want)
+		}
+	}
+}
+
+// flushRecorder 记录每次 flush 时已写入的内容
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.Body.String())
+	f.ResponseRecorder.Flush()
+}
+
+func TestStreamResponse(t *testing.T) {
+	pr, pw := io.Pipe()
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       pr,
+	}
+	go func() {
+		_, _ = pw.Write([]byte(`{"type":"ADDED"}`))
+		_, _ = pw.Write([]byte(`{"type":"DELETED"}`))
+		_ = pw.Close()
+	}()
+
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	ctx := context.NewContext(iris.New())
+	ctx.BeginRequest(w, httptest.NewRequest(http.MethodGet, "/pods?watch=true", nil))
+	if err := streamResponse(ctx, resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != `{"type":"ADDED"}{"type":"DELETED"}` {
+		t.Errorf("unexpected body %s", w.Body.String())
+	}
+	// 每个事件写入后都立即 flush
+	if len(w.flushed) < 3 || w.flushed[1] != `{"type":"ADDED"}` {
+		t.Errorf("events are not flushed separately: %v", w.flushed)
+	}
+}
+
+func TestStreamResponseCanceled(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("data"))}
+	reqCtx, cancel := goContext.WithCancel(goContext.Background())
+	cancel()
+	ctx := context.NewContext(iris.New())
+	ctx.BeginRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/pods?watch=true", nil).WithContext(reqCtx))
+	if err := streamResponse(ctx, resp); err == nil {
+		t.Error("expected error after the client disconnected")
+	}
+}
@@ -0,0 +1,239 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/terminal"
+	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
+	pkgTerminal "github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/asdine/storm/v3"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// 每小时清理一次过期的录像
+const recordingCleanInterval = time.Hour
+
+type Handler struct {
+	terminalService terminal.Service
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		terminalService: terminal.NewService(),
+	}
+}
+
+// SearchRecordings 按用户、集群、namespace、pod 和容器查询终端录像
+func (h *Handler) SearchRecordings() iris.Handler {
+	return func(ctx *context.Context) {
+		pageNum, _ := ctx.Values().GetInt(pkgV1.PageNum)
+		pageSize, _ := ctx.Values().GetInt(pkgV1.PageSize)
+		var conditions commons.SearchConditions
+		if err := ctx.ReadJSON(&conditions); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		recordings, total, err := h.terminalService.SearchRecordings(pageNum, pageSize, ownerConditions(ctx, conditions.Conditions), common.DBOptions{})
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", pkgV1.Page{Items: recordings, Total: total})
+	}
+}
+
+// SearchCommands 查询终端会话中执行过的命令
+func (h *Handler) SearchCommands() iris.Handler {
+	return func(ctx *context.Context) {
+		pageNum, _ := ctx.Values().GetInt(pkgV1.PageNum)
+		pageSize, _ := ctx.Values().GetInt(pkgV1.PageSize)
+		var conditions commons.SearchConditions
+		if err := ctx.ReadJSON(&conditions); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		commands, total, err := h.terminalService.SearchCommands(pageNum, pageSize, ownerConditions(ctx, conditions.Conditions), common.DBOptions{})
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", pkgV1.Page{Items: commands, Total: total})
+	}
+}
+
+// ownerConditions 非管理员只能查询自己的录像和命令
+func ownerConditions(ctx *context.Context, conditions common.Conditions) common.Conditions {
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if profile.IsAdministrator {
+		return conditions
+	}
+	result := common.Conditions{}
+	for k := range conditions {
+		result[k] = conditions[k]
+	}
+	result["__owner"] = common.Condition{Field: "user", Operator: "eq", Value: profile.Name}
+	return result
+}
+
+// getRecording 获取录像,非管理员访问其他用户的录像时视为不存在
+func (h *Handler) getRecording(ctx *context.Context) (*v1Terminal.Recording, bool) {
+	name := ctx.Params().GetString("name")
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	recording, err := h.terminalService.GetRecording(name, common.DBOptions{})
+	if err != nil || (!profile.IsAdministrator && recording.User != profile.Name) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.Values().Set("message", fmt.Sprintf("recording %s not found", name))
+		return nil, false
+	}
+	return recording, true
+}
+
+func (h *Handler) GetRecording() iris.Handler {
+	return func(ctx *context.Context) {
+		recording, ok := h.getRecording(ctx)
+		if !ok {
+			return
+		}
+		ctx.Values().Set("data", recording)
+	}
+}
+
+// sendRecording attachment 为 false 时直接返回录像内容,供 asciinema player 回放
+func (h *Handler) sendRecording(attachment bool) iris.Handler {
+	return func(ctx *context.Context) {
+		recording, ok := h.getRecording(ctx)
+		if !ok {
+			return
+		}
+		name := recording.Name
+		if _, err := os.Stat(recording.Path); err != nil {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", fmt.Sprintf("recording file of %s not found", name))
+			return
+		}
+		var err error
+		if attachment {
+			err = ctx.SendFile(recording.Path, recording.Name+".cast")
+		} else {
+			ctx.ContentType("application/x-asciicast")
+			err = ctx.ServeFile(recording.Path)
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+		}
+	}
+}
+
+// DownloadRecording 下载 asciicast v2 格式的录像文件
+func (h *Handler) DownloadRecording() iris.Handler {
+	return h.sendRecording(true)
+}
+
+// PlayRecording 返回录像内容用于在线回放
+func (h *Handler) PlayRecording() iris.Handler {
+	return h.sendRecording(false)
+}
+
+// checkAdmin 只有管理员可以管理终端会话
+func checkAdmin(ctx *context.Context) bool {
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if !profile.IsAdministrator {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.Values().Set("message", []string{"permission %s required", "admin"})
+		return false
+	}
+	return true
+}
+
+// ListSessions 列出所有打开的终端会话
+func (h *Handler) ListSessions() iris.Handler {
+	return func(ctx *context.Context) {
+		if !checkAdmin(ctx) {
+			return
+		}
+		ctx.Values().Set("data", pkgTerminal.TerminalSessions.List())
+	}
+}
+
+// TerminateSession 强制关闭终端会话
+func (h *Handler) TerminateSession() iris.Handler {
+	return func(ctx *context.Context) {
+		if !checkAdmin(ctx) {
+			return
+		}
+		id := ctx.Params().GetString("id")
+		if pkgTerminal.TerminalSessions.Get(id).Id == "" {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", fmt.Sprintf("terminal session %s not found", id))
+			return
+		}
+		pkgTerminal.TerminalSessions.Close(id, 2, "the session has been terminated by the administrator")
+		ctx.Values().Set("data", id)
+	}
+}
+
+var recordingCleanerOnce sync.Once
+
+// StartRecordingCleaner 定期删除超过保留天数的录像文件和记录
+func StartRecordingCleaner(terminalService terminal.Service) {
+	conf := server.Config().Spec.Terminal.Recording
+	if conf.RetentionDays <= 0 {
+		return
+	}
+	recordingCleanerOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(recordingCleanInterval)
+			defer ticker.Stop()
+			for {
+				cleanRecordings(terminalService, time.Now().AddDate(0, 0, -conf.RetentionDays))
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+func cleanRecordings(terminalService terminal.Service, before time.Time) {
+	recordings, err := terminalService.ListRecordingsBefore(before, common.DBOptions{})
+	if err != nil {
+		server.Logger().Errorf("list expired terminal recordings failed: %s", err.Error())
+		return
+	}
+	for i := range recordings {
+		if err := os.Remove(recordings[i].Path); err != nil && !os.IsNotExist(err) {
+			server.Logger().Errorf("remove terminal recording %s failed: %s", recordings[i].Path, err.Error())
+			continue
+		}
+		if err := terminalService.DeleteRecording(recordings[i].Name, common.DBOptions{}); err != nil {
+			server.Logger().Errorf("delete terminal recording %s failed: %s", recordings[i].Name, err.Error())
+		}
+	}
+}
+
+func Install(parent iris.Party) {
+	handler := NewHandler()
+	StartRecordingCleaner(handler.terminalService)
+	pkgTerminal.StartSessionReaper()
+	sp := parent.Party("/terminals")
+	sp.Post("/recordings/search", handler.SearchRecordings())
+	sp.Get("/recordings/:name", handler.GetRecording())
+	sp.Get("/recordings/:name/download", handler.DownloadRecording())
+	sp.Get("/recordings/:name/play", handler.PlayRecording())
+	sp.Post("/commands/search", handler.SearchCommands())
+	sp.Get("/sessions", handler.ListSessions())
+	sp.Delete("/sessions/:id", handler.TerminateSession())
+}
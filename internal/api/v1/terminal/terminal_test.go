@@ -0,0 +1,102 @@
+package terminal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/terminal"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type fakeTerminalService struct {
+	terminal.Service
+	recordings map[string]*v1Terminal.Recording
+	conditions common.Conditions
+}
+
+func (f *fakeTerminalService) GetRecording(name string, _ common.DBOptions) (*v1Terminal.Recording, error) {
+	if r, ok := f.recordings[name]; ok {
+		return r, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *fakeTerminalService) SearchRecordings(_, _ int, conditions common.Conditions, _ common.DBOptions) ([]v1Terminal.Recording, int, error) {
+	f.conditions = conditions
+	return nil, 0, nil
+}
+
+func newRecordingTestApp(t *testing.T, profile session.UserProfile) (http.Handler, *fakeTerminalService) {
+	path := filepath.Join(t.TempDir(), "r1.cast")
+	if err := os.WriteFile(path, []byte(`{"version":2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	service := &fakeTerminalService{recordings: map[string]*v1Terminal.Recording{
+		"r1": {Metadata: v1.Metadata{Name: "r1"}, User: "alice", Path: path},
+	}}
+	h := &Handler{terminalService: service}
+	app := iris.New()
+	app.Use(func(ctx *context.Context) {
+		ctx.Values().Set("profile", profile)
+		ctx.Next()
+	})
+	app.Post("/recordings/search", h.SearchRecordings())
+	app.Get("/recordings/:name", h.GetRecording())
+	app.Get("/recordings/:name/download", h.DownloadRecording())
+	app.Get("/recordings/:name/play", h.PlayRecording())
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app, service
+}
+
+func TestRecordingAccess(t *testing.T) {
+	tests := []struct {
+		profile session.UserProfile
+		code    int
+	}{
+		{session.UserProfile{Name: "alice"}, http.StatusOK},
+		{session.UserProfile{Name: "bob"}, http.StatusNotFound},
+		{session.UserProfile{Name: "admin", IsAdministrator: true}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		app, _ := newRecordingTestApp(t, tt.profile)
+		for _, path := range []string{"/recordings/r1", "/recordings/r1/download", "/recordings/r1/play"} {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != tt.code {
+				t.Errorf("%s GET %s: got %d, want %d", tt.profile.Name, path, w.Code, tt.code)
+			}
+		}
+	}
+}
+
+func TestSearchRecordingsOnlyOwn(t *testing.T) {
+	body := `{"conditions":{"user":{"field":"user","operator":"eq","value":"alice"}}}`
+	app, service := newRecordingTestApp(t, session.UserProfile{Name: "bob"})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/recordings/search", bytes.NewBufferString(body)))
+	var owner bool
+	for _, c := range service.conditions {
+		if c.Field == "user" && c.Operator == "eq" && c.Value == "bob" {
+			owner = true
+		}
+	}
+	if !owner {
+		t.Errorf("search of a non-admin user is not limited to the own recordings: %v", service.conditions)
+	}
+
+	app, service = newRecordingTestApp(t, session.UserProfile{Name: "admin", IsAdministrator: true})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/recordings/search", bytes.NewBufferString(body)))
+	if len(service.conditions) != 1 {
+		t.Errorf("administrators should search all recordings: %v", service.conditions)
+	}
+}
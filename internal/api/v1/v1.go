@@ -22,6 +22,7 @@ import (
 	"github.com/KubeOperator/kubepi/internal/api/v1/role"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	"github.com/KubeOperator/kubepi/internal/api/v1/system"
+	"github.com/KubeOperator/kubepi/internal/api/v1/terminal"
 	"github.com/KubeOperator/kubepi/internal/api/v1/user"
 	"github.com/KubeOperator/kubepi/internal/api/v1/webkubectl"
 	"github.com/KubeOperator/kubepi/internal/api/v1/ws"
@@ -39,6 +40,7 @@ import (
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
 	"github.com/kataras/iris/v12/core/router"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var resourceWhiteList = WhiteList{"sessions", "proxy", "ws", "charts", "webkubectl", "apps", "mfa", "pod"}
@@ -239,7 +241,7 @@ func roleHandler() iris.Handler {
 			Name: u.Name,
 		}, common.DBOptions{})
 		if err != nil {
-			if !errors.As(err, &storm.ErrNotFound) {
+			if !errors.Is(err, storm.ErrNotFound) {
 				ctx.StatusCode(iris.StatusInternalServerError)
 				ctx.Values().Set("message", err.Error())
 				return
@@ -268,7 +270,27 @@ func roleHandler() iris.Handler {
 	}
 }
 
+// memberRoutes 中的集群子路由由 handler 检查集群成员身份,并以用户身份访问 kubernetes,
+// 是否允许操作由 kubernetes RBAC 决定,因此只需要集群的 get 权限
+var memberRoutes = []string{
+	"/kubepi/api/v1/clusters/:name/namespaces/:namespace/:kind/:workload/",
+	// 共享终端由 handler 检查会话的所有者和集群成员身份
+	"/kubepi/api/v1/clusters/:name/terminal/sessions/:session/",
+}
+
+func isMemberRoute(path string) bool {
+	for i := range memberRoutes {
+		if strings.HasPrefix(path, memberRoutes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 func getVerbByRoute(path, method string) string {
+	if isMemberRoute(path) {
+		return "get"
+	}
 	switch strings.ToLower(method) {
 	case "put":
 		return "update"
@@ -417,6 +439,20 @@ func WarpedJwtHandler() iris.Handler {
 	}
 }
 
+// metricsHandler 输出 prometheus 指标,指标中包含集群和用户名,只允许管理员访问
+func metricsHandler() iris.Handler {
+	h := iris.FromStd(promhttp.Handler())
+	return func(ctx *context.Context) {
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		if !profile.IsAdministrator {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", "only administrators can access metrics")
+			return
+		}
+		h(ctx)
+	}
+}
+
 func AddV1Route(app iris.Party) {
 
 	v1Party := app.Party("/v1")
@@ -434,6 +470,7 @@ func AddV1Route(app iris.Party) {
 	authParty.Use(resourceNameInvalidHandler())
 	authParty.Use(logHandler())
 	authParty.Get("/", apiResourceHandler(authParty))
+	authParty.Get("/metrics", metricsHandler())
 	user.Install(authParty)
 	cluster.Install(authParty)
 	role.Install(authParty)
@@ -441,8 +478,9 @@ func AddV1Route(app iris.Party) {
 	proxy.Install(authParty)
 	ws.Install(authParty)
 	chart.Install(authParty)
-	webkubectl.Install(authParty, v1Party)
+	webkubectl.Install(authParty)
 	ldap.Install(authParty)
 	imagerepo.Install(authParty)
 	file.Install(authParty)
+	terminal.Install(authParty)
 }
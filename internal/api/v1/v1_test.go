@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Role "github.com/KubeOperator/kubepi/internal/model/v1/role"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// newRoleTestApp 使用内置 Common User 角色的权限规则检查请求
+func newRoleTestApp(t *testing.T, register func(party iris.Party)) http.Handler {
+	app := iris.New()
+	party := app.Party("/kubepi/api/v1")
+	party.Use(func(ctx *context.Context) {
+		ctx.Values().Set("profile", session.UserProfile{Name: "member"})
+		ctx.Values().Set("roles", []v1Role.Role{{
+			Rules: []v1Role.PolicyRule{{Resource: []string{"clusters"}, Verbs: []string{"get", "list"}}},
+		}})
+		ctx.Next()
+	})
+	party.Use(resourceExtractHandler())
+	party.Use(roleAccessHandler())
+	register(party)
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestRoleAccessCommonUser(t *testing.T) {
+	ok := func(ctx *context.Context) { ctx.StatusCode(iris.StatusOK) }
+	app := newRoleTestApp(t, func(party iris.Party) {
+		party.Post("/clusters/:name/namespaces/:namespace/:kind/:workload/restart", ok)
+		party.Put("/clusters/:name/namespaces/:namespace/:kind/:workload/scale", ok)
+		party.Post("/clusters/:name/terminal/sessions/:session/invites", ok)
+		party.Delete("/clusters/:name/terminal/sessions/:session/invites/:user", ok)
+		party.Post("/clusters/:name/terminal/sessions/:session/join", ok)
+		party.Get("/clusters/:name", ok)
+		party.Put("/clusters/:name", ok)
+		party.Delete("/clusters/:name", ok)
+	})
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodPost, "/kubepi/api/v1/clusters/c1/namespaces/default/deployments/web/restart", http.StatusOK},
+		{http.MethodPut, "/kubepi/api/v1/clusters/c1/namespaces/default/deployments/web/scale", http.StatusOK},
+		{http.MethodPost, "/kubepi/api/v1/clusters/c1/terminal/sessions/s1/invites", http.StatusOK},
+		{http.MethodDelete, "/kubepi/api/v1/clusters/c1/terminal/sessions/s1/invites/bob", http.StatusOK},
+		{http.MethodPost, "/kubepi/api/v1/clusters/c1/terminal/sessions/s1/join", http.StatusOK},
+		{http.MethodGet, "/kubepi/api/v1/clusters/c1", http.StatusOK},
+		{http.MethodPut, "/kubepi/api/v1/clusters/c1", http.StatusForbidden},
+		{http.MethodDelete, "/kubepi/api/v1/clusters/c1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+	}
+}
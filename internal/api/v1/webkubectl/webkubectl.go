@@ -3,12 +3,13 @@ package webkubectl
 import (
 	"encoding/pem"
 	"fmt"
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
 	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
-	"github.com/google/uuid"
+	pkgWebkubectl "github.com/KubeOperator/kubepi/pkg/webkubectl"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
 	"k8s.io/client-go/tools/clientcmd"
@@ -18,47 +19,12 @@ import (
 type Handler struct {
 	clusterBindingService clusterbinding.Service
 	clusterService        cluster.Service
-	sessionCache          *TerminalSessions
 }
 
 func NewHandler() *Handler {
 	return &Handler{
 		clusterBindingService: clusterbinding.NewService(),
 		clusterService:        cluster.NewService(),
-		sessionCache:          NewTerminalSessions(),
-	}
-}
-
-func (h *Handler) GetConfigFile() iris.Handler {
-	return func(ctx *context.Context) {
-		sessionId := ctx.URLParam("token")
-		requireLen := len(uuid.New().String())
-		if len(sessionId) != requireLen {
-			ctx.StatusCode(iris.StatusBadRequest)
-			ctx.Values().Set("message", fmt.Sprintf("sessionId length must be %d", requireLen))
-			return
-		}
-		sess := h.sessionCache.Get(sessionId)
-		if sess != nil {
-			h.sessionCache.Delete(sessionId)
-		} else {
-			ctx.StatusCode(iris.StatusInternalServerError)
-			ctx.Values().Set("message", fmt.Sprintf("can not find sessionId: %s in memory", sessionId))
-			return
-		}
-
-		ctx.Header("Content-Type", "application/download")
-		ctx.Header("Content-Disposition", "attachment;filename=config")
-		ctx.Header("Content-Transfer-Encoding", "binary")
-
-		cc := toCmdConfig(sess)
-		bs, err := clientcmd.Write(*cc)
-		if err != nil {
-			ctx.StatusCode(iris.StatusInternalServerError)
-			ctx.Values().Set("message", "can not generate config file")
-			return
-		}
-		_, _ = ctx.Write(bs)
 	}
 }
 
@@ -99,6 +65,9 @@ func (h *Handler) CreateSession() iris.Handler {
 			ctx.Values().Set("message", err.Error())
 			return
 		}
+		if !commons.CheckClusterAccess(ctx, c, true) {
+			return
+		}
 		k := kubernetes.NewKubernetes(c)
 		cfg, err := k.Config()
 		if err != nil {
@@ -118,14 +87,18 @@ func (h *Handler) CreateSession() iris.Handler {
 		}
 		sess.config = cfg
 		sess.User = profile.Name
-		sessionId := uuid.New().String()
-		h.sessionCache.Put(sessionId, &sess)
-		ctx.Values().Set("data", &SessionResponse{Token: sessionId})
+		bs, err := clientcmd.Write(*toCmdConfig(&sess))
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", "can not generate config file")
+			return
+		}
+		token := pkgWebkubectl.Sessions.Put(pkgWebkubectl.Session{User: sess.User, Cluster: sess.Cluster, Config: bs})
+		ctx.Values().Set("data", &SessionResponse{Token: token})
 	}
 }
 
-func Install(authParent, noAuthParty iris.Party) {
+func Install(authParent iris.Party) {
 	handler := NewHandler()
 	authParent.Post("/webkubectl/session", handler.CreateSession())
-	noAuthParty.Get("/webkubectl/session", handler.GetConfigFile())
 }
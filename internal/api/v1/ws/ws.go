@@ -1,6 +1,10 @@
 package ws
 
 import (
+	"errors"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/server"
 	"github.com/KubeOperator/kubepi/pkg/logging"
 	"github.com/KubeOperator/kubepi/pkg/terminal"
 	"github.com/kataras/iris/v12"
@@ -17,4 +21,28 @@ func Install(parent iris.Party) {
 	wsParty.Any("/logging/sockjs/{p:path}", func(ctx *context.Context) {
 		l.ServeHTTP(ctx.ResponseWriter(), ctx.Request())
 	})
+	// 原生 WebSocket 连接,使用 v4.channel.k8s.io 协议的二进制帧
+	wsParty.Get("/terminal/websocket/{id}", func(ctx *context.Context) {
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		err := terminal.ServeWebSocket(ctx.ResponseWriter(), ctx.Request(), ctx.Params().Get("id"), profile.Name)
+		handleWebSocketError(ctx, err, terminal.ErrSessionNotFound)
+	})
+	wsParty.Get("/logging/websocket/{id}", func(ctx *context.Context) {
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		err := logging.ServeWebSocket(ctx.ResponseWriter(), ctx.Request(), ctx.Params().Get("id"), profile.Name)
+		handleWebSocketError(ctx, err, logging.ErrSessionNotFound)
+	})
+}
+
+// handleWebSocketError 会话不存在时返回 404,连接升级后的错误只记录日志
+func handleWebSocketError(ctx *context.Context, err error, notFound error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, notFound) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.Values().Set("message", err.Error())
+		return
+	}
+	server.Logger().Errorf("websocket session %s failed: %s", ctx.Params().Get("id"), err.Error())
 }
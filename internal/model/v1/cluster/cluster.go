@@ -1,6 +1,8 @@
 package cluster
 
 import (
+	"time"
+
 	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
 )
 
@@ -18,6 +20,50 @@ type Spec struct {
 	Connect        Connect        `json:"connect" storm:"inline"`
 	Authentication Authentication `json:"authentication" storm:"inline"`
 	Local          bool           `json:"local"`
+	AccessMode     AccessMode     `json:"accessMode"`
+	Prometheus     Prometheus     `json:"prometheus"`
+}
+
+const (
+	PrometheusAuthNone   = ""
+	PrometheusAuthBasic  = "basic"
+	PrometheusAuthBearer = "bearer"
+)
+
+// Prometheus 集群对应的 Prometheus 地址,ServiceProxy 开启时通过集群 apiserver 的 service proxy 访问,
+// 此时使用集群的凭据,认证配置只在直接访问 URL 时生效
+type Prometheus struct {
+	Enable             bool                   `json:"enable"`
+	URL                string                 `json:"url"`
+	AuthMode           string                 `json:"authMode"`
+	Username           string                 `json:"username"`
+	Password           string                 `json:"password"`
+	BearerToken        string                 `json:"bearerToken"`
+	InsecureSkipVerify bool                   `json:"insecureSkipVerify"`
+	ServiceProxy       PrometheusServiceProxy `json:"serviceProxy"`
+}
+
+type PrometheusServiceProxy struct {
+	Enable    bool   `json:"enable"`
+	Namespace string `json:"namespace"`
+	Service   string `json:"service"`
+	Port      string `json:"port"`
+	Scheme    string `json:"scheme"`
+}
+
+const (
+	AccessModeNormal      = ""
+	AccessModeReadOnly    = "readonly"
+	AccessModeMaintenance = "maintenance"
+)
+
+// AccessMode 集群的只读或维护模式,StartTime/EndTime 为空时立即生效且不会自动结束
+type AccessMode struct {
+	Mode      string    `json:"mode"`
+	Reason    string    `json:"reason"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Operator  string    `json:"operator"`
 }
 
 type Connect struct {
@@ -49,7 +95,44 @@ type Certificate struct {
 }
 
 type Status struct {
-	Version string `json:"version"`
-	Phase   string `json:"phase"`
+	Version       string         `json:"version"`
+	Phase         string         `json:"phase"`
+	Message       string         `json:"message"`
+	Health        HealthStatus   `json:"health"`
+	HealthHistory []HealthRecord `json:"healthHistory"`
+}
+
+// HealthStatus 后台巡检得到的集群最新健康状态
+type HealthStatus struct {
+	Healthy           bool              `json:"healthy"`
+	Ready             bool              `json:"ready"`
+	Version           string            `json:"version"`
+	TotalNodeNum      int               `json:"totalNodeNum"`
+	ReadyNodeNum      int               `json:"readyNodeNum"`
+	CPUAllocatable    float64           `json:"cpuAllocatable"`
+	CPURequested      float64           `json:"cpuRequested"`
+	MemoryAllocatable float64           `json:"memoryAllocatable"`
+	MemoryRequested   float64           `json:"memoryRequested"`
+	MetricsAvailable  bool              `json:"metricsAvailable"`
+	CPUUsage          float64           `json:"cpuUsage"`
+	MemoryUsage       float64           `json:"memoryUsage"`
+	Components        []ComponentStatus `json:"components"`
+	Message           string            `json:"message"`
+	ProbeTime         time.Time         `json:"probeTime"`
+}
+
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
 	Message string `json:"message"`
 }
+
+// HealthRecord 健康状态的历史记录
+type HealthRecord struct {
+	Healthy      bool      `json:"healthy"`
+	Ready        bool      `json:"ready"`
+	ReadyNodeNum int       `json:"readyNodeNum"`
+	TotalNodeNum int       `json:"totalNodeNum"`
+	Message      string    `json:"message"`
+	ProbeTime    time.Time `json:"probeTime"`
+}
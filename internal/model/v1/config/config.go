@@ -8,11 +8,16 @@ type Config struct {
 	Spec Spec `json:"spec"`
 }
 type Spec struct {
-	Server  ServerConfig  `json:"server"`
-	DB      DBConfig      `json:"db"`
-	Session SessionConfig `json:"session"`
-	Logger  LoggerConfig  `json:"logger"`
-	AppId   string        `json:"appId"`
+	Server     ServerConfig     `json:"server"`
+	DB         DBConfig         `json:"db"`
+	Session    SessionConfig    `json:"session"`
+	Logger     LoggerConfig     `json:"logger"`
+	AppId      string           `json:"appId"`
+	RateLimit  RateLimitConfig  `json:"rateLimit"`
+	Monitor    MonitorConfig    `json:"monitor"`
+	Terminal   TerminalConfig   `json:"terminal"`
+	Kubeconfig KubeconfigConfig `json:"kubeconfig"`
+	WebKubectl WebKubectlConfig `json:"webkubectl"`
 }
 
 type ServerConfig struct {
@@ -42,3 +47,94 @@ type DBConfig struct {
 type SessionConfig struct {
 	Expires int `json:"expires"`
 }
+
+type RateLimitConfig struct {
+	Enable               bool    `json:"enable"`
+	UserQPS              float64 `json:"userQps"`
+	UserBurst            int     `json:"userBurst"`
+	ClusterQPS           float64 `json:"clusterQps"`
+	ClusterBurst         int     `json:"clusterBurst"`
+	MaxStreamsPerUser    int     `json:"maxStreamsPerUser"`
+	MaxStreamsPerCluster int     `json:"maxStreamsPerCluster"`
+}
+
+type MonitorConfig struct {
+	Enable bool `json:"enable"`
+	// 巡检间隔和单个集群的超时时间,单位秒
+	Interval     int `json:"interval"`
+	Timeout      int `json:"timeout"`
+	HistoryLimit int `json:"historyLimit"`
+}
+
+type TerminalConfig struct {
+	Recording RecordingConfig     `json:"recording"`
+	Audit     CommandAuditConfig  `json:"audit"`
+	NodeShell NodeShellConfig     `json:"nodeShell"`
+	Debug     DebugConfig         `json:"debug"`
+	Limit     TerminalLimitConfig `json:"limit"`
+}
+
+type RecordingConfig struct {
+	Enable bool `json:"enable"`
+	// 录像文件的保存目录
+	Path string `json:"path"`
+	// 是否同时记录用户的输入
+	RecordStdin bool `json:"recordStdin"`
+	// 录像保留天数,0 表示永久保留
+	RetentionDays int `json:"retentionDays"`
+}
+
+type CommandAuditConfig struct {
+	Enable bool `json:"enable"`
+	// 禁止执行的命令,每一项为匹配整行命令的正则表达式,匹配时阻断会话
+	DenyList []string `json:"denyList"`
+}
+
+type NodeShellConfig struct {
+	// 节点终端 pod 使用的镜像,需要包含 nsenter
+	Image     string `json:"image"`
+	Namespace string `json:"namespace"`
+	// 等待 pod 启动的超时时间,单位秒
+	StartTimeout int `json:"startTimeout"`
+	// pod 的最长存活时间,超时后 pod 被终止,单位秒
+	MaxDuration int `json:"maxDuration"`
+}
+
+type DebugConfig struct {
+	// 临时调试容器默认使用的镜像
+	Image string `json:"image"`
+	// 非管理员可以指定的其他镜像,管理员可以使用任意镜像
+	AllowedImages []string `json:"allowedImages"`
+	// 等待调试容器启动的超时时间,单位秒
+	StartTimeout int `json:"startTimeout"`
+}
+
+type TerminalLimitConfig struct {
+	// 空闲超时时间,单位秒,0 表示使用默认的 5 分钟
+	IdleTimeout int `json:"idleTimeout"`
+	// 会话最长持续时间,单位秒,0 表示不限制
+	MaxDuration int `json:"maxDuration"`
+	// 每个用户和每个集群同时打开的终端数量,0 表示不限制
+	MaxPerUser    int `json:"maxPerUser"`
+	MaxPerCluster int `json:"maxPerCluster"`
+	// 按角色覆盖全局设置,用户有多个角色时取最宽松的设置
+	Roles map[string]TerminalRoleLimit `json:"roles"`
+}
+
+// TerminalRoleLimit 角色的终端限制,IdleTimeout 为 0 时使用全局设置,其余为 0 时表示不限制
+type TerminalRoleLimit struct {
+	IdleTimeout int `json:"idleTimeout"`
+	MaxDuration int `json:"maxDuration"`
+	MaxPerUser  int `json:"maxPerUser"`
+}
+
+type KubeconfigConfig struct {
+	// 下载的 kubeconfig 中证书的默认有效期和最长有效期,单位秒,最短为 600 秒
+	DefaultExpiration int `json:"defaultExpiration"`
+	MaxExpiration     int `json:"maxExpiration"`
+}
+
+type WebKubectlConfig struct {
+	// 无法以 nobody 用户在独立的 namespace 中启动 shell 时(非 root 运行或非 linux 系统),是否允许直接以服务进程的用户启动
+	AllowUnsandboxed bool `json:"allowUnsandboxed"`
+}
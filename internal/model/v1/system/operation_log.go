@@ -9,4 +9,10 @@ type OperationLog struct {
 	Operation           string `json:"operation"`
 	OperationDomain     string `json:"operationDomain"`
 	SpecificInformation string `json:"specificInformation"`
+	Cluster             string `json:"cluster"`
+	Namespace           string `json:"namespace"`
+	Resource            string `json:"resource"`
+	ResourceName        string `json:"resourceName"`
+	StatusCode          int    `json:"statusCode"`
+	Detail              string `json:"detail"`
 }
@@ -0,0 +1,23 @@
+package terminal
+
+import (
+	"time"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+)
+
+// Command 终端会话中执行的一条命令,由用户输入还原得到
+type Command struct {
+	v1.BaseModel `storm:"inline"`
+	v1.Metadata  `storm:"inline"`
+	SessionID    string `json:"sessionId" storm:"index"`
+	User         string `json:"user" storm:"index"`
+	Cluster      string `json:"cluster" storm:"index"`
+	Namespace    string `json:"namespace"`
+	Pod          string `json:"pod"`
+	Container    string `json:"container"`
+	Command      string `json:"command"`
+	// 命令匹配黑名单,会话被阻断
+	Blocked bool      `json:"blocked"`
+	Time    time.Time `json:"time"`
+}
@@ -0,0 +1,25 @@
+package terminal
+
+import (
+	"time"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+)
+
+// Recording 一次终端会话的录像,录像内容以 asciicast v2 格式保存在 Path 指向的文件中
+type Recording struct {
+	v1.BaseModel `storm:"inline"`
+	v1.Metadata  `storm:"inline"`
+	SessionID    string    `json:"sessionId" storm:"index"`
+	User         string    `json:"user" storm:"index"`
+	Cluster      string    `json:"cluster" storm:"index"`
+	Namespace    string    `json:"namespace"`
+	Pod          string    `json:"pod"`
+	Container    string    `json:"container"`
+	Shell        string    `json:"shell"`
+	RecordStdin  bool      `json:"recordStdin"`
+	StartTime    time.Time `json:"startTime"`
+	EndTime      time.Time `json:"endTime"`
+	Size         int64     `json:"size"`
+	Path         string    `json:"-"`
+}
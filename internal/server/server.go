@@ -4,8 +4,6 @@ import (
 	"embed"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"path"
 	"strings"
@@ -22,6 +20,8 @@ import (
 	"github.com/KubeOperator/kubepi/migrate"
 	"github.com/KubeOperator/kubepi/pkg/file"
 	"github.com/KubeOperator/kubepi/pkg/i18n"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/KubeOperator/kubepi/pkg/webkubectl"
 	"github.com/asdine/storm/v3"
 	"github.com/coreos/etcd/pkg/fileutil"
 	"github.com/kataras/iris/v12"
@@ -38,7 +38,6 @@ var SessionMgr *sessions.Sessions
 var EmbedWebKubePi embed.FS
 var EmbedWebDashboard embed.FS
 var EmbedWebTerminal embed.FS
-var WebkubectlEntrypoint string
 
 type Option func(server *KubePiServer)
 
@@ -94,6 +93,12 @@ func (e *KubePiServer) setUpConfig() {
 	if err != nil {
 		panic(err)
 	}
+	// 命令黑名单不合法时命令审计和阻断都无法生效,拒绝启动
+	if e.config.Spec.Terminal.Audit.Enable {
+		if err := terminal.ValidateDenyList(e.config.Spec.Terminal.Audit.DenyList); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func (e *KubePiServer) setUpLogger() {
@@ -164,9 +169,14 @@ func (e *KubePiServer) setResultHandler() {
 		}
 		isProxyPath := func() bool {
 			p := ctx.GetCurrentRoute().Path()
+			// prometheus 指标直接输出文本格式
+			if p == "/kubepi/api/v1/metrics" {
+				return true
+			}
 			ss := strings.Split(p, "/")
-			if len(ss) > 0 {
-				if ss[0] == "webkubectl" {
+			// web kubectl 的路由为 /kubepi/webkubectl/...
+			if len(ss) > 2 {
+				if ss[2] == "webkubectl" {
 					return true
 				}
 			}
@@ -245,40 +255,22 @@ func (e *KubePiServer) setUpErrHandler() {
 func (e *KubePiServer) runMigrations() {
 	migrate.RunMigrate(e.db, e.logger)
 }
-func (e *KubePiServer) setWebkubectlProxy() {
-	handler := func(ctx *context.Context) {
-		p := ctx.Params().Get("p")
-		if strings.Contains(p, "root") {
-			ctx.Request().URL.Path = strings.ReplaceAll(ctx.Request().URL.Path, "root", "")
-			ctx.Request().RequestURI = strings.ReplaceAll(ctx.Request().RequestURI, "root", "")
-		}
-		u, _ := url.Parse("http://localhost:8080")
-		proxy := httputil.NewSingleHostReverseProxy(u)
-		proxy.ModifyResponse = func(resp *http.Response) error {
-			if resp.StatusCode == iris.StatusMovedPermanently {
-				// 重定向重写
-				if resp.Header.Get("Location") == "/kubepi/webkubectl/" {
-					resp.Header.Set("Location", "/kubepi/webkubectl/root")
-				}
-			}
-			return nil
-		}
-		proxy.ServeHTTP(ctx.ResponseWriter(), ctx.Request())
-	}
-	e.rootRoute.Any("/webkubectl/{p:path}", handler)
-	e.rootRoute.Any("webkubectl", handler)
-}
-
-func (e *KubePiServer) setUpTtyEntrypoint() {
-	f, err := os.OpenFile("init-kube.sh", os.O_CREATE|os.O_RDWR, 0755)
-	if err != nil {
+func (e *KubePiServer) setUpWebkubectl() {
+	webkubectl.AllowUnsandboxed = e.config.Spec.WebKubectl.AllowUnsandboxed
+	if err := webkubectl.CleanSandboxes(); err != nil {
 		e.logger.Error(err)
-		return
 	}
-	if _, err := f.WriteString(WebkubectlEntrypoint); err != nil {
-		e.logger.Error(err)
-		return
+	handler := func(ctx *context.Context) {
+		// 页面地址为 /kubepi/webkubectl/root,页面中的相对路径以 root 为前缀
+		p := strings.TrimPrefix(ctx.Params().Get("p"), "root")
+		webkubectl.Serve(ctx.ResponseWriter(), ctx.Request(), p)
 	}
+	e.rootRoute.Any("/webkubectl/{p:path}", handler)
+	e.rootRoute.Any("webkubectl", func(ctx *context.Context) {
+		u := *ctx.Request().URL
+		u.Path = path.Join(ctx.Request().URL.Path, "root")
+		ctx.Redirect(u.String(), iris.StatusMovedPermanently)
+	})
 }
 
 func (e *KubePiServer) bootstrap() *KubePiServer {
@@ -289,15 +281,26 @@ func (e *KubePiServer) bootstrap() *KubePiServer {
 	e.setUpSession()
 	e.setResultHandler()
 	e.setUpErrHandler()
-	e.setWebkubectlProxy()
+	e.setUpWebkubectl()
 	e.runMigrations()
-	e.setUpTtyEntrypoint()
-	e.startTty()
 	return e
 }
 
 var es *KubePiServer
 
+var startupTasks []func()
+
+// RegisterStartupTask 注册服务初始化完成后启动的后台任务
+func RegisterStartupTask(task func()) {
+	startupTasks = append(startupTasks, task)
+}
+
+func (e *KubePiServer) runStartupTasks() {
+	for i := range startupTasks {
+		startupTasks[i]()
+	}
+}
+
 func DB() *storm.DB {
 	return es.db
 }
@@ -312,6 +315,7 @@ func Logger() *logrus.Logger {
 
 func Listen(route func(party iris.Party), options ...Option) error {
 	es = NewKubePiSerer(options...)
+	es.runStartupTasks()
 	route(es.rootRoute)
 	return es.app.Run(iris.Addr(fmt.Sprintf("%s:%d", es.config.Spec.Server.Bind.Host, es.config.Spec.Server.Bind.Port)))
 }
@@ -340,6 +344,54 @@ func getDefaultConfig() *v1Config.Config {
 				Expires: 72,
 			},
 			Logger: v1Config.LoggerConfig{Level: "debug"},
+			RateLimit: v1Config.RateLimitConfig{
+				Enable:            true,
+				UserQPS:           30,
+				UserBurst:         60,
+				ClusterQPS:        200,
+				ClusterBurst:      400,
+				MaxStreamsPerUser: 30,
+			},
+			Monitor: v1Config.MonitorConfig{
+				Enable:       true,
+				Interval:     60,
+				Timeout:      10,
+				HistoryLimit: 60,
+			},
+			Terminal: v1Config.TerminalConfig{
+				Recording: v1Config.RecordingConfig{
+					Enable:        true,
+					Path:          "/var/lib/kubepi/recordings",
+					RecordStdin:   false,
+					RetentionDays: 30,
+				},
+				Audit: v1Config.CommandAuditConfig{
+					Enable: true,
+				},
+				NodeShell: v1Config.NodeShellConfig{
+					Image:        "alpine:3.13",
+					Namespace:    "kube-system",
+					StartTimeout: 60,
+					MaxDuration:  7200,
+				},
+				Debug: v1Config.DebugConfig{
+					Image:        "busybox:1.33",
+					StartTimeout: 60,
+				},
+				Limit: v1Config.TerminalLimitConfig{
+					IdleTimeout:   300,
+					MaxDuration:   0,
+					MaxPerUser:    10,
+					MaxPerCluster: 100,
+				},
+			},
+			Kubeconfig: v1Config.KubeconfigConfig{
+				DefaultExpiration: 28800,
+				MaxExpiration:     86400,
+			},
+			WebKubectl: v1Config.WebKubectlConfig{
+				AllowUnsandboxed: false,
+			},
 		},
 	}
 }
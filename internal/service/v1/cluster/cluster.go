@@ -18,6 +18,7 @@ type Service interface {
 	List(options common.DBOptions) ([]v1Cluster.Cluster, error)
 	Delete(name string, options common.DBOptions) error
 	Search(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Cluster.Cluster, int, error)
+	UpdateStatus(name string, status v1Cluster.Status, options common.DBOptions) error
 }
 
 func NewService() Service {
@@ -42,6 +43,16 @@ func (c *cluster) Update(name string, cluster *v1Cluster.Cluster, options common
 	return db.Update(cluster)
 }
 
+// UpdateStatus 只更新集群的状态字段,避免覆盖并发修改的其他字段
+func (c *cluster) UpdateStatus(name string, status v1Cluster.Status, options common.DBOptions) error {
+	db := c.GetDB(options)
+	r, err := c.Get(name, options)
+	if err != nil {
+		return err
+	}
+	return db.UpdateField(&v1Cluster.Cluster{Metadata: r.Metadata}, "Status", status)
+}
+
 func (c *cluster) Create(cluster *v1Cluster.Cluster, options common.DBOptions) error {
 	db := c.GetDB(options)
 	cluster.UUID = uuid.New().String()
@@ -57,6 +57,8 @@ func (s *service) SearchOperationLogs(num, size int, conditions common.Condition
 			ms = append(ms, q.Or(
 				costomStorm.Like("Operator", conditions[k].Value),
 				costomStorm.Like("Operation", conditions[k].Value),
+				costomStorm.Like("Cluster", conditions[k].Value),
+				costomStorm.Like("ResourceName", conditions[k].Value),
 				costomStorm.Like("Detail", conditions[k].Value),
 			))
 		} else {
@@ -0,0 +1,36 @@
+package terminal
+
+import (
+	"time"
+
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/google/uuid"
+)
+
+func (s *service) CreateCommand(command *v1Terminal.Command, options common.DBOptions) error {
+	db := s.GetDB(options)
+	command.UUID = uuid.New().String()
+	command.Name = command.UUID
+	command.CreateAt = time.Now()
+	command.UpdateAt = time.Now()
+	return db.Save(command)
+}
+
+func (s *service) SearchCommands(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Terminal.Command, int, error) {
+	db := s.GetDB(options)
+	ms := searchMatchers(conditions, "User", "Cluster", "Namespace", "Pod", "Command")
+	query := db.Select(ms...).OrderBy("CreateAt").Reverse()
+	count, err := query.Count(&v1Terminal.Command{})
+	if err != nil {
+		return nil, 0, err
+	}
+	if size != 0 {
+		query.Limit(size).Skip((num - 1) * size)
+	}
+	commands := make([]v1Terminal.Command, 0)
+	if err := query.Find(&commands); err != nil {
+		return nil, 0, err
+	}
+	return commands, count, nil
+}
@@ -0,0 +1,132 @@
+package terminal
+
+import (
+	"errors"
+	"time"
+
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	costomStorm "github.com/KubeOperator/kubepi/pkg/storm"
+	"github.com/KubeOperator/kubepi/pkg/util/lang"
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	common.DBService
+	CreateRecording(recording *v1Terminal.Recording, options common.DBOptions) error
+	FinishRecording(name string, endTime time.Time, size int64, options common.DBOptions) error
+	GetRecording(name string, options common.DBOptions) (*v1Terminal.Recording, error)
+	SearchRecordings(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Terminal.Recording, int, error)
+	ListRecordingsBefore(t time.Time, options common.DBOptions) ([]v1Terminal.Recording, error)
+	DeleteRecording(name string, options common.DBOptions) error
+	CreateCommand(command *v1Terminal.Command, options common.DBOptions) error
+	SearchCommands(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Terminal.Command, int, error)
+}
+
+func NewService() Service {
+	return &service{}
+}
+
+type service struct {
+	common.DefaultDBService
+}
+
+func (s *service) CreateRecording(recording *v1Terminal.Recording, options common.DBOptions) error {
+	db := s.GetDB(options)
+	recording.UUID = uuid.New().String()
+	recording.CreateAt = time.Now()
+	recording.UpdateAt = time.Now()
+	return db.Save(recording)
+}
+
+// FinishRecording 会话结束时记录结束时间和录像大小
+func (s *service) FinishRecording(name string, endTime time.Time, size int64, options common.DBOptions) error {
+	db := s.GetDB(options)
+	r, err := s.GetRecording(name, options)
+	if err != nil {
+		return err
+	}
+	return db.Update(&v1Terminal.Recording{
+		BaseModel: r.BaseModel,
+		Metadata:  r.Metadata,
+		EndTime:   endTime,
+		Size:      size,
+	})
+}
+
+func (s *service) GetRecording(name string, options common.DBOptions) (*v1Terminal.Recording, error) {
+	db := s.GetDB(options)
+	var recording v1Terminal.Recording
+	if err := db.One("Name", name, &recording); err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+func (s *service) SearchRecordings(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Terminal.Recording, int, error) {
+	db := s.GetDB(options)
+	ms := searchMatchers(conditions, "User", "Cluster", "Namespace", "Pod", "Container")
+	query := db.Select(ms...).OrderBy("CreateAt").Reverse()
+	count, err := query.Count(&v1Terminal.Recording{})
+	if err != nil {
+		return nil, 0, err
+	}
+	if size != 0 {
+		query.Limit(size).Skip((num - 1) * size)
+	}
+	recordings := make([]v1Terminal.Recording, 0)
+	if err := query.Find(&recordings); err != nil {
+		return nil, 0, err
+	}
+	return recordings, count, nil
+}
+
+// searchMatchers quick 条件在 quickFields 中模糊匹配
+func searchMatchers(conditions common.Conditions, quickFields ...string) []q.Matcher {
+	var ms []q.Matcher
+	for k := range conditions {
+		if conditions[k].Field == "quick" {
+			var quick []q.Matcher
+			for i := range quickFields {
+				quick = append(quick, costomStorm.Like(quickFields[i], conditions[k].Value))
+			}
+			ms = append(ms, q.Or(quick...))
+		} else {
+			field := lang.FirstToUpper(conditions[k].Field)
+			value := conditions[k].Value
+
+			switch conditions[k].Operator {
+			case "eq":
+				ms = append(ms, q.Eq(field, value))
+			case "ne":
+				ms = append(ms, q.Not(q.Eq(field, value)))
+			case "like":
+				ms = append(ms, costomStorm.Like(field, value))
+			case "not like":
+				ms = append(ms, q.Not(costomStorm.Like(field, value)))
+			}
+		}
+	}
+	return ms
+}
+
+// ListRecordingsBefore 返回在 t 之前开始的录像,用于清理过期录像
+func (s *service) ListRecordingsBefore(t time.Time, options common.DBOptions) ([]v1Terminal.Recording, error) {
+	db := s.GetDB(options)
+	recordings := make([]v1Terminal.Recording, 0)
+	if err := db.Select(q.Lt("StartTime", t)).Find(&recordings); err != nil && !errors.Is(err, storm.ErrNotFound) {
+		return nil, err
+	}
+	return recordings, nil
+}
+
+func (s *service) DeleteRecording(name string, options common.DBOptions) error {
+	db := s.GetDB(options)
+	recording, err := s.GetRecording(name, options)
+	if err != nil {
+		return err
+	}
+	return db.DeleteStruct(recording)
+}
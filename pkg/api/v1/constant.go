@@ -6,6 +6,7 @@ const (
 )
 
 type Page struct {
-	Total int         `json:"total"`
-	Items interface{} `json:"items"`
+	Total    int         `json:"total"`
+	Items    interface{} `json:"items"`
+	Continue string      `json:"continue,omitempty"`
 }
@@ -15,4 +15,11 @@ var zhCNMapping = TextMapping{
 	"username already exists":               "用户名已存在",
 	"email already exists":                  "邮箱已存在",
 	"unable to complete authorization":      "无法完成授权，请检查用户名是否符合规范: /^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$/",
+	"kubernetes forbidden: %s":              "权限不足,Kubernetes 拒绝了此操作: %s",
+	"kubernetes not found: %s":              "资源不存在: %s",
+	"kubernetes already exists: %s":         "资源已存在: %s",
+	"kubernetes conflict: %s":               "资源已被修改,请刷新后重试: %s",
+	"rate limited, retry after %s seconds":  "请求过于频繁,请在 %s 秒后重试",
+	"cluster %s is under maintenance: %s":   "集群 %s 正在维护中: %s",
+	"cluster %s is read only: %s":           "集群 %s 处于只读模式: %s",
 }
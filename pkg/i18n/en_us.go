@@ -15,4 +15,11 @@ var enUSMapping = TextMapping{
 	"username already exists":               "username already exists",
 	"email already exists":                  "email already exists",
 	"unable to complete authorization":      "Unable to complete authorization, please check whether the user name is valid:  /^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$/",
+	"kubernetes forbidden: %s":              "permission denied by kubernetes: %s",
+	"kubernetes not found: %s":              "resource not found: %s",
+	"kubernetes already exists: %s":         "resource already exists: %s",
+	"kubernetes conflict: %s":               "resource has been modified, please refresh and try again: %s",
+	"rate limited, retry after %s seconds":  "too many requests, please retry after %s seconds",
+	"cluster %s is under maintenance: %s":   "the cluster %s is under maintenance: %s",
+	"cluster %s is read only: %s":           "the cluster %s is read only: %s",
 }
@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"regexp"
@@ -36,6 +37,7 @@ type Interface interface {
 	Client() (*kubernetes.Clientset, error)
 	HasPermission(attributes v1.ResourceAttributes) (PermissionCheckResult, error)
 	CreateCommonUser(commonName string) ([]byte, error)
+	CreateTemporaryUser(commonName string, expiration time.Duration) ([]byte, []byte, error)
 	CreateDefaultClusterRoles() error
 	GetUserNamespaceNames(username string, options ...interface{}) ([]string, error)
 	CanVisitAllNamespace(username string) (bool, error)
@@ -384,7 +386,45 @@ func (k *Kubernetes) CreateCommonUser(commonName string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return k.signClientCertificate(commonName, cert, nil)
+}
+
+// CreateTemporaryUser 使用新生成的私钥申请有效期为 expiration 的客户端证书,返回证书和私钥,
+// 需要 Kubernetes 1.22 及以上版本
+func (k *Kubernetes) CreateTemporaryUser(commonName string, expiration time.Duration) ([]byte, []byte, error) {
+	minor, err := k.VersionMinor()
+	if err != nil {
+		return nil, nil, err
+	}
+	if minor < 22 {
+		return nil, nil, errors.New("short-lived certificates require kubernetes 1.22 or later")
+	}
+	key, err := certificate.GeneratePrivateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	request, err := certificate.CreateClientCertificateRequest(commonName, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	seconds := int32(expiration / time.Second)
+	cert, err := k.signClientCertificate(commonName, request, &seconds)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 未开启 CSRDuration 的集群会忽略 expirationSeconds,此时不返回证书
+	c, err := certificate.ParseX509Certificate(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.NotAfter.After(time.Now().Add(expiration + 5*time.Minute)) {
+		return nil, nil, errors.New("the cluster does not honor the requested certificate expiration")
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: key}), nil
+}
 
+// signClientCertificate 提交并审批证书申请,expirationSeconds 为空时使用集群默认的有效期
+func (k *Kubernetes) signClientCertificate(commonName string, cert []byte, expirationSeconds *int32) ([]byte, error) {
 	client, err := k.Client()
 	if err != nil {
 		return nil, err
@@ -402,7 +442,8 @@ func (k *Kubernetes) CreateCommonUser(commonName string) ([]byte, error) {
 	if minor > 18 {
 		csr := certv1.CertificateSigningRequest{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: fmt.Sprintf("%s-%s-%d", commonName, "kubepi", time.Now().Unix()),
+				// 同一用户可能同时申请多个证书,由 apiserver 生成不重复的名称
+				GenerateName: fmt.Sprintf("%s-%s-", commonName, "kubepi"),
 			},
 			Spec: certv1.CertificateSigningRequestSpec{
 				SignerName: "kubernetes.io/kube-apiserver-client",
@@ -413,12 +454,17 @@ func (k *Kubernetes) CreateCommonUser(commonName string) ([]byte, error) {
 				Usages: []certv1.KeyUsage{
 					"client auth",
 				},
+				ExpirationSeconds: expirationSeconds,
 			},
 		}
 		createResp, err := client.CertificatesV1().CertificateSigningRequests().Create(context.TODO(), &csr, metav1.CreateOptions{})
 		if err != nil {
 			return nil, err
 		}
+		// 证书只在签发时需要,读取后删除证书申请
+		defer func() {
+			_ = client.CertificatesV1().CertificateSigningRequests().Delete(context.TODO(), createResp.Name, metav1.DeleteOptions{})
+		}()
 		// 审批证书
 		createResp.Status.Conditions = append(createResp.Status.Conditions, certv1.CertificateSigningRequestCondition{
 			Reason:         "Approved by KubePi",
@@ -449,7 +495,8 @@ func (k *Kubernetes) CreateCommonUser(commonName string) ([]byte, error) {
 		name := "kubernetes.io/kube-apiserver-client"
 		csr := certv1beta1.CertificateSigningRequest{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: fmt.Sprintf("%s-%s-%d", commonName, "kubepi", time.Now().Unix()),
+				// 同一用户可能同时申请多个证书,由 apiserver 生成不重复的名称
+				GenerateName: fmt.Sprintf("%s-%s-", commonName, "kubepi"),
 			},
 			Spec: certv1beta1.CertificateSigningRequestSpec{
 				SignerName: &name,
@@ -460,12 +507,17 @@ func (k *Kubernetes) CreateCommonUser(commonName string) ([]byte, error) {
 				Usages: []certv1beta1.KeyUsage{
 					"client auth",
 				},
+				ExpirationSeconds: expirationSeconds,
 			},
 		}
 		createResp, err := client.CertificatesV1beta1().CertificateSigningRequests().Create(context.TODO(), &csr, metav1.CreateOptions{})
 		if err != nil {
 			return nil, err
 		}
+		// 证书只在签发时需要,读取后删除证书申请
+		defer func() {
+			_ = client.CertificatesV1beta1().CertificateSigningRequests().Delete(context.TODO(), createResp.Name, metav1.DeleteOptions{})
+		}()
 		// 审批证书
 		createResp.Status.Conditions = append(createResp.Status.Conditions, certv1beta1.CertificateSigningRequestCondition{
 			Reason:         "Approved by KubePi",
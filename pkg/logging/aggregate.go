@@ -0,0 +1,270 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/igm/sockjs-go.v2/sockjs"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// 同时读取的日志流上限,超出时忽略新的容器
+const maxAggregatedStreams = 50
+
+// pod 名称使用的 ANSI 颜色
+var podColors = []int{31, 32, 33, 34, 35, 36}
+
+// AggregateOptions 多个 pod 的日志筛选条件
+type AggregateOptions struct {
+	Namespace string
+	// 标签选择器,为空时匹配 namespace 下的所有 pod
+	Selector string
+	// 为空时读取 pod 的所有容器
+	Container string
+	TailLines int64
+	Follow    bool
+}
+
+// aggregator 同时读取匹配的所有 pod 和容器的日志,每行日志以 pod/container 为前缀
+// follow 时监听 pod 变化,读取新创建的 pod,pod 被删除时停止读取
+type aggregator struct {
+	client  kubernetes.Interface
+	opts    AggregateOptions
+	session sockjs.Session
+	ctx     context.Context
+	start   time.Time
+
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	// 正在读取的日志流,key 为 pod/container
+	active map[string]*logStream
+	// 已经读取过的容器 id,容器重启后 id 变化时重新读取
+	streamed map[string]string
+	// 因超过数量限制未读取的容器 id,每个容器只提示一次
+	skipped map[string]string
+	wg      sync.WaitGroup
+}
+
+type logStream struct {
+	key       string
+	pod       string
+	container string
+	cancel    context.CancelFunc
+}
+
+func WaitForAggregatedStream(k8sClient kubernetes.Interface, opts AggregateOptions, sessionId string) {
+	select {
+	case <-LogSessions.Get(sessionId).Bound:
+		close(LogSessions.Get(sessionId).Bound)
+		err := startAggregateProcess(k8sClient, opts, LogSessions.Get(sessionId))
+		if err != nil {
+			LogSessions.Close(sessionId, err.Error(), 2)
+			return
+		}
+		LogSessions.Close(sessionId, "Process exited", 1)
+	case <-time.After(sessionBindTimeout):
+		LogSessions.Close(sessionId, "session bind timeout", 2)
+	}
+}
+
+func startAggregateProcess(k8sClient kubernetes.Interface, opts AggregateOptions, session LogSession) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := &aggregator{
+		client:   k8sClient,
+		opts:     opts,
+		session:  session.sockJSSession,
+		ctx:      ctx,
+		start:    time.Now(),
+		active:   map[string]*logStream{},
+		streamed: map[string]string{},
+		skipped:  map[string]string{},
+	}
+	if !opts.Follow {
+		pods, err := k8sClient.CoreV1().Pods(opts.Namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector})
+		if err != nil {
+			return err
+		}
+		for i := range pods.Items {
+			a.sync(&pods.Items[i])
+		}
+		a.wg.Wait()
+		return nil
+	}
+	// 连接断开时停止读取
+	go a.waitForDisconnect(cancel)
+	factory := informers.NewSharedInformerFactoryWithOptions(k8sClient, 0,
+		informers.WithNamespace(opts.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = opts.Selector
+		}))
+	informer := factory.Core().V1().Pods().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*v1.Pod); ok {
+				a.sync(pod)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if pod, ok := obj.(*v1.Pod); ok {
+				a.sync(pod)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				a.remove(pod)
+			}
+		},
+	})
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	a.wg.Wait()
+	return nil
+}
+
+func (a *aggregator) waitForDisconnect(cancel context.CancelFunc) {
+	defer cancel()
+	if d, ok := a.session.(interface{ Done() <-chan struct{} }); ok {
+		<-d.Done()
+		return
+	}
+	for {
+		if _, err := a.session.Recv(); err != nil {
+			return
+		}
+	}
+}
+
+// sync 开始读取 pod 中已启动且未读取过的容器
+func (a *aggregator) sync(pod *v1.Pod) {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if a.opts.Container != "" && status.Name != a.opts.Container {
+			continue
+		}
+		if status.ContainerID == "" || (status.State.Running == nil && status.State.Terminated == nil) {
+			continue
+		}
+		key := pod.Name + "/" + status.Name
+		a.lock.Lock()
+		if _, ok := a.active[key]; ok || a.streamed[key] == status.ContainerID {
+			a.lock.Unlock()
+			continue
+		}
+		if len(a.active) >= maxAggregatedStreams {
+			notified := a.skipped[key] == status.ContainerID
+			a.skipped[key] = status.ContainerID
+			a.lock.Unlock()
+			if notified {
+				continue
+			}
+			a.writeLine(pod.Name, status.Name, fmt.Sprintf("too many log streams, at most %d containers are followed", maxAggregatedStreams))
+			continue
+		}
+		// 开始后创建的 pod 和重启后的容器读取全部日志
+		all := a.opts.Follow && (a.streamed[key] != "" || pod.CreationTimestamp.After(a.start))
+		ctx, cancel := context.WithCancel(a.ctx)
+		s := &logStream{key: key, pod: pod.Name, container: status.Name, cancel: cancel}
+		a.active[key] = s
+		a.streamed[key] = status.ContainerID
+		a.lock.Unlock()
+		a.wg.Add(1)
+		go a.stream(ctx, s, all)
+	}
+}
+
+// remove pod 被删除时停止读取该 pod 的所有容器
+func (a *aggregator) remove(pod *v1.Pod) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	prefix := pod.Name + "/"
+	for key, s := range a.active {
+		if strings.HasPrefix(key, prefix) {
+			s.cancel()
+			delete(a.active, key)
+		}
+	}
+	for key := range a.streamed {
+		if strings.HasPrefix(key, prefix) {
+			delete(a.streamed, key)
+		}
+	}
+	for key := range a.skipped {
+		if strings.HasPrefix(key, prefix) {
+			delete(a.skipped, key)
+		}
+	}
+}
+
+func (a *aggregator) stream(ctx context.Context, s *logStream, all bool) {
+	defer a.wg.Done()
+	defer func() {
+		s.cancel()
+		a.lock.Lock()
+		// 同名的 pod 重建后可能已经开始了新的日志流
+		if a.active[s.key] == s {
+			delete(a.active, s.key)
+		}
+		a.lock.Unlock()
+	}()
+	pod, container := s.pod, s.container
+	opts := &v1.PodLogOptions{
+		Container: container,
+		Follow:    a.opts.Follow,
+	}
+	if !all {
+		opts.TailLines = &a.opts.TailLines
+	}
+	reader, err := a.client.CoreV1().Pods(a.opts.Namespace).GetLogs(pod, opts).Stream(ctx)
+	if err != nil {
+		a.writeLine(pod, container, err.Error())
+		return
+	}
+	defer reader.Close()
+	r := bufio.NewReader(reader)
+	for {
+		line, err := r.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			a.writeLine(pod, container, strings.TrimRight(line, "\r\n"))
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				a.writeLine(pod, container, err.Error())
+			}
+			return
+		}
+	}
+}
+
+// writeLine 为每行日志加上 pod/container 前缀,不同 pod 使用不同的颜色
+func (a *aggregator) writeLine(pod, container, line string) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(pod))
+	color := podColors[h.Sum32()%uint32(len(podColors))]
+	prefixed := fmt.Sprintf("\x1b[%dm%s\x1b[0m \x1b[2m%s\x1b[0m %s", color, pod, container, line)
+	a.writeLock.Lock()
+	defer a.writeLock.Unlock()
+	var err error
+	if w, ok := a.session.(io.Writer); ok {
+		_, err = w.Write([]byte(prefixed + "\n"))
+	} else {
+		err = a.session.Send(prefixed + "\r\n")
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
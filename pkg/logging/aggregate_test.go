@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeSession struct {
+	lock   sync.Mutex
+	lines  []string
+	closed chan struct{}
+}
+
+func (f *fakeSession) ID() string { return "fake" }
+
+func (f *fakeSession) Recv() (string, error) {
+	<-f.closed
+	return "", errSessionClosed
+}
+
+func (f *fakeSession) Send(data string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.lines = append(f.lines, data)
+	return nil
+}
+
+func (f *fakeSession) Close(uint32, string) error { return nil }
+
+func (f *fakeSession) output() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return strings.Join(f.lines, "")
+}
+
+var errSessionClosed = errors.New("session closed")
+
+func testPod(name string, containerID string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels, CreationTimestamp: metav1.Now()},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:        "app",
+			ContainerID: containerID,
+			State:       v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+		}}},
+	}
+}
+
+func TestAggregateLogs(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		testPod("web-1", "docker://1", map[string]string{"app": "web"}),
+		testPod("web-2", "docker://2", map[string]string{"app": "web"}),
+		testPod("db-1", "docker://3", map[string]string{"app": "db"}),
+	)
+	session := &fakeSession{closed: make(chan struct{})}
+	err := startAggregateProcess(client, AggregateOptions{Namespace: "default", Selector: "app=web", TailLines: 10}, LogSession{sockJSSession: session})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := session.output()
+	for _, pod := range []string{"web-1", "web-2"} {
+		if !strings.Contains(output, pod+"\x1b[0m \x1b[2mapp\x1b[0m fake logs") {
+			t.Errorf("logs of %s should be prefixed, got %q", pod, output)
+		}
+	}
+	if strings.Contains(output, "db-1") {
+		t.Error("pods not matching the selector should be ignored")
+	}
+}
+
+func TestAggregateFollow(t *testing.T) {
+	client := fake.NewSimpleClientset(testPod("web-1", "docker://1", map[string]string{"app": "web"}))
+	session := &fakeSession{closed: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- startAggregateProcess(client, AggregateOptions{Namespace: "default", Selector: "app=web", Follow: true}, LogSession{sockJSSession: session})
+	}()
+	waitFor(t, func() bool { return strings.Contains(session.output(), "web-1") })
+
+	// 新创建的 pod 也会被读取
+	if _, err := client.CoreV1().Pods("default").Create(context.TODO(), testPod("web-2", "docker://2", map[string]string{"app": "web"}), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return strings.Contains(session.output(), "web-2") })
+	if n := strings.Count(session.output(), "web-1"); n != 1 {
+		t.Errorf("the same container should be read once, got %d", n)
+	}
+
+	close(session.closed)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("streaming should stop after the session is closed")
+	}
+}
+
+func TestAggregateTooManyStreams(t *testing.T) {
+	session := &fakeSession{closed: make(chan struct{})}
+	a := &aggregator{
+		session:  session,
+		ctx:      context.Background(),
+		active:   map[string]*logStream{},
+		streamed: map[string]string{},
+		skipped:  map[string]string{},
+	}
+	for i := 0; i < maxAggregatedStreams; i++ {
+		a.active[strconv.Itoa(i)] = &logStream{}
+	}
+	// pod 状态频繁更新时只提示一次
+	pod := testPod("web-1", "docker://1", nil)
+	for i := 0; i < 3; i++ {
+		a.sync(pod)
+	}
+	if n := strings.Count(session.output(), "too many log streams"); n != 1 {
+		t.Errorf("the notice should be written once, got %d", n)
+	}
+	// 容器重启后再次提示
+	pod.Status.ContainerStatuses[0].ContainerID = "docker://2"
+	a.sync(pod)
+	if n := strings.Count(session.output(), "too many log streams"); n != 2 {
+		t.Errorf("the notice should be written again after restart, got %d", n)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
@@ -5,11 +5,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/igm/sockjs-go.v2/sockjs"
 	v1 "k8s.io/api/core/v1"
@@ -26,10 +28,15 @@ func GenLoggingSessionId() (string, error) {
 	return string(id), nil
 }
 
+// 等待客户端绑定会话的超时时间
+const sessionBindTimeout = time.Minute
+
 type LogSession struct {
 	Id            string
 	Bound         chan error
 	sockJSSession sockjs.Session
+	// 会话所有者,使用 WebSocket 连接时检查
+	User string
 }
 
 type SessionMap struct {
@@ -55,9 +62,11 @@ func (sm *SessionMap) Close(sessionId, reason string, status uint32) {
 	}
 	sm.Lock.Lock()
 	defer sm.Lock.Unlock()
-	err := sm.Sessions[sessionId].sockJSSession.Close(status, reason)
-	if err != nil {
-		log.Println(err)
+	if sm.Sessions[sessionId].sockJSSession != nil {
+		err := sm.Sessions[sessionId].sockJSSession.Close(status, reason)
+		if err != nil {
+			log.Println(err)
+		}
 	}
 	delete(sm.Sessions, sessionId)
 }
@@ -83,10 +92,9 @@ func CreateLoggingHandler(path string) http.Handler {
 func logHandler(session sockjs.Session) {
 
 	var (
-		buf        string
-		err        error
-		msg        LogMessage
-		logSession LogSession
+		buf string
+		err error
+		msg LogMessage
 	)
 	if buf, err = session.Recv(); err != nil {
 		log.Printf("handleLogSession: can't Recv: %v", err)
@@ -96,13 +104,24 @@ func logHandler(session sockjs.Session) {
 		log.Printf("handleLogSession: can't UnMarshal (%v): %s", err, buf)
 		return
 	}
-	if logSession = LogSessions.Get(msg.SessionID); logSession.Id == "" {
-		log.Printf("handleLogSession: can't find session '%s'", msg.SessionID)
-		return
+	if err = bindSession(msg.SessionID, "", session); err != nil {
+		log.Printf("handleLogSession: %v", err)
+	}
+}
+
+// bindSession 将连接绑定到日志会话,user 不为空时检查会话是否属于该用户
+func bindSession(sessionId string, user string, session sockjs.Session) error {
+	LogSessions.Lock.Lock()
+	logSession, ok := LogSessions.Sessions[sessionId]
+	if !ok || logSession.sockJSSession != nil || (user != "" && logSession.User != "" && logSession.User != user) {
+		LogSessions.Lock.Unlock()
+		return fmt.Errorf("can't find session '%s'", sessionId)
 	}
 	logSession.sockJSSession = session
-	LogSessions.Set(msg.SessionID, logSession)
+	LogSessions.Sessions[sessionId] = logSession
+	LogSessions.Lock.Unlock()
 	logSession.Bound <- nil
+	return nil
 }
 
 func WaitForLoggingStream(k8sClient kubernetes.Interface, namespace string, pod string, container string, tailLines int, follow bool, sessionId string) {
@@ -115,6 +134,8 @@ func WaitForLoggingStream(k8sClient kubernetes.Interface, namespace string, pod
 			return
 		}
 		LogSessions.Close(sessionId, "Process exited", 1)
+	case <-time.After(sessionBindTimeout):
+		LogSessions.Close(sessionId, "session bind timeout", 2)
 	}
 }
 
@@ -131,6 +152,11 @@ func startLogProcess(k8sClient kubernetes.Interface, namespace string, pod strin
 	}
 
 	ss := session.sockJSSession
+	// WebSocket 连接直接发送原始日志
+	if w, ok := ss.(io.Writer); ok {
+		_, err := io.Copy(w, reader)
+		return err
+	}
 	for {
 		buf := make([]byte, 2048)
 		numBytes, err := reader.Read(buf)
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/KubeOperator/kubepi/pkg/wschannel"
+)
+
+// ErrSessionNotFound 会话不存在或不属于当前用户
+var ErrSessionNotFound = errors.New("log session not found")
+
+// webSocketSession 将 WebSocket 连接适配为 sockjs.Session,日志以原始字节写入 StdoutChannel
+type webSocketSession struct {
+	id   string
+	conn *wschannel.Conn
+}
+
+func (w *webSocketSession) ID() string {
+	return w.id
+}
+
+// Recv 日志连接不接收输入,只在连接关闭时返回
+func (w *webSocketSession) Recv() (string, error) {
+	for {
+		if _, _, err := w.conn.ReadFrame(); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (w *webSocketSession) Send(data string) error {
+	return w.conn.WriteFrame(wschannel.StdoutChannel, []byte(data))
+}
+
+func (w *webSocketSession) Write(p []byte) (int, error) {
+	if err := w.conn.WriteFrame(wschannel.StdoutChannel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close status 为 1 时表示日志正常结束
+func (w *webSocketSession) Close(status uint32, reason string) error {
+	var err error
+	if status != 1 {
+		err = errors.New(reason)
+	}
+	_ = w.conn.WriteStatus(err)
+	return w.conn.Close()
+}
+
+// Done 连接关闭时返回
+func (w *webSocketSession) Done() <-chan struct{} {
+	return w.conn.Done()
+}
+
+func canBind(sessionId string, user string) bool {
+	LogSessions.Lock.Lock()
+	defer LogSessions.Lock.Unlock()
+	s, ok := LogSessions.Sessions[sessionId]
+	return ok && s.sockJSSession == nil && (s.User == "" || s.User == user)
+}
+
+// ServeWebSocket 使用 WebSocket 连接日志会话,连接关闭后返回
+// 会话不存在时不升级连接并返回 ErrSessionNotFound
+func ServeWebSocket(w http.ResponseWriter, r *http.Request, sessionId string, user string) error {
+	if !canBind(sessionId, user) {
+		return ErrSessionNotFound
+	}
+	conn, err := wschannel.Upgrade(w, r)
+	if err != nil {
+		return err
+	}
+	session := &webSocketSession{id: sessionId, conn: conn}
+	if err := bindSession(sessionId, user, session); err != nil {
+		_ = session.Close(2, err.Error())
+		return err
+	}
+	// 读取客户端的关闭帧,连接断开时结束
+	go func() {
+		_, _ = session.Recv()
+	}()
+	<-conn.Done()
+	return nil
+}
@@ -0,0 +1,290 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	coreV1 "k8s.io/api/core/v1"
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricsApiPath = "/apis/metrics.k8s.io/v1beta1"
+
+	SortByCPU    = "cpu"
+	SortByMemory = "memory"
+)
+
+// ErrMetricsUnavailable 集群未安装 metrics-server 或 metrics api 暂时不可用
+var ErrMetricsUnavailable = errors.New("metrics api is not available")
+
+// Usage CPU 单位为核,内存单位为字节
+type Usage struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.CPU += o.CPU
+	u.Memory += o.Memory
+}
+
+func usageOf(list coreV1.ResourceList) Usage {
+	return Usage{
+		CPU:    list.Cpu().AsApproximateFloat64(),
+		Memory: list.Memory().AsApproximateFloat64(),
+	}
+}
+
+type NodeUsage struct {
+	Name        string    `json:"name"`
+	Usage       Usage     `json:"usage"`
+	Allocatable Usage     `json:"allocatable"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type ContainerUsage struct {
+	Name  string `json:"name"`
+	Usage Usage  `json:"usage"`
+}
+
+type PodUsage struct {
+	Namespace    string           `json:"namespace"`
+	Name         string           `json:"name"`
+	WorkloadKind string           `json:"workloadKind,omitempty"`
+	WorkloadName string           `json:"workloadName,omitempty"`
+	Usage        Usage            `json:"usage"`
+	Containers   []ContainerUsage `json:"containers"`
+	Timestamp    time.Time        `json:"timestamp"`
+}
+
+// GroupUsage 按 namespace 或工作负载汇总的用量
+type GroupUsage struct {
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	PodNum    int    `json:"podNum"`
+	Usage     Usage  `json:"usage"`
+}
+
+type Summary struct {
+	NodeNum     int   `json:"nodeNum"`
+	Usage       Usage `json:"usage"`
+	Allocatable Usage `json:"allocatable"`
+}
+
+// metrics.k8s.io/v1beta1 返回结构中用到的字段
+type nodeMetricsList struct {
+	Items []struct {
+		Metadata  metav1.ObjectMeta   `json:"metadata"`
+		Timestamp metav1.Time         `json:"timestamp"`
+		Usage     coreV1.ResourceList `json:"usage"`
+	} `json:"items"`
+}
+
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Timestamp  metav1.Time       `json:"timestamp"`
+		Containers []struct {
+			Name  string              `json:"name"`
+			Usage coreV1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+type Client struct {
+	client kubernetes.Interface
+}
+
+func NewClient(client kubernetes.Interface) *Client {
+	return &Client{client: client}
+}
+
+func (c *Client) get(ctx context.Context, path string, into interface{}) error {
+	data, err := c.client.Discovery().RESTClient().Get().AbsPath(metricsApiPath, path).Do(ctx).Raw()
+	if err != nil {
+		if k8sError.IsNotFound(err) || k8sError.IsServiceUnavailable(err) {
+			return ErrMetricsUnavailable
+		}
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+// NodeUsages 返回每个节点的实际用量以及可分配资源
+func (c *Client) NodeUsages(ctx context.Context) ([]NodeUsage, error) {
+	var list nodeMetricsList
+	if err := c.get(ctx, "nodes", &list); err != nil {
+		return nil, err
+	}
+	nodes, err := c.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	allocatable := map[string]Usage{}
+	for i := range nodes.Items {
+		allocatable[nodes.Items[i].Name] = usageOf(nodes.Items[i].Status.Allocatable)
+	}
+	result := make([]NodeUsage, 0, len(list.Items))
+	for i := range list.Items {
+		item := list.Items[i]
+		result = append(result, NodeUsage{
+			Name:        item.Metadata.Name,
+			Usage:       usageOf(item.Usage),
+			Allocatable: allocatable[item.Metadata.Name],
+			Timestamp:   item.Timestamp.Time,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// PodUsages 返回 namespace 下每个 pod 的实际用量,namespace 为空时返回所有 namespace
+func (c *Client) PodUsages(ctx context.Context, namespace string) ([]PodUsage, error) {
+	path := "pods"
+	if namespace != "" {
+		path = "namespaces/" + namespace + "/pods"
+	}
+	var list podMetricsList
+	if err := c.get(ctx, path, &list); err != nil {
+		return nil, err
+	}
+	result := make([]PodUsage, 0, len(list.Items))
+	for i := range list.Items {
+		item := list.Items[i]
+		pod := PodUsage{
+			Namespace: item.Metadata.Namespace,
+			Name:      item.Metadata.Name,
+			Timestamp: item.Timestamp.Time,
+		}
+		for j := range item.Containers {
+			u := usageOf(item.Containers[j].Usage)
+			pod.Usage.add(u)
+			pod.Containers = append(pod.Containers, ContainerUsage{Name: item.Containers[j].Name, Usage: u})
+		}
+		result = append(result, pod)
+	}
+	return result, nil
+}
+
+// ResolveWorkloads 根据 ownerReferences 找到 pod 所属的工作负载,ReplicaSet 和 Job 继续向上查找 Deployment 和 CronJob
+func (c *Client) ResolveWorkloads(ctx context.Context, namespace string, pods []PodUsage) error {
+	podList, err := c.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	rsList, err := c.client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	jobList, err := c.client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	parents := map[string]metav1.OwnerReference{}
+	for i := range rsList.Items {
+		if owner := metav1.GetControllerOf(&rsList.Items[i]); owner != nil {
+			parents["ReplicaSet/"+rsList.Items[i].Namespace+"/"+rsList.Items[i].Name] = *owner
+		}
+	}
+	for i := range jobList.Items {
+		if owner := metav1.GetControllerOf(&jobList.Items[i]); owner != nil {
+			parents["Job/"+jobList.Items[i].Namespace+"/"+jobList.Items[i].Name] = *owner
+		}
+	}
+	owners := map[string]metav1.OwnerReference{}
+	for i := range podList.Items {
+		owner := metav1.GetControllerOf(&podList.Items[i])
+		if owner == nil {
+			continue
+		}
+		if parent, ok := parents[owner.Kind+"/"+podList.Items[i].Namespace+"/"+owner.Name]; ok {
+			owner = &parent
+		}
+		owners[podList.Items[i].Namespace+"/"+podList.Items[i].Name] = *owner
+	}
+	for i := range pods {
+		if owner, ok := owners[pods[i].Namespace+"/"+pods[i].Name]; ok {
+			pods[i].WorkloadKind = owner.Kind
+			pods[i].WorkloadName = owner.Name
+		} else {
+			pods[i].WorkloadKind = "Pod"
+			pods[i].WorkloadName = pods[i].Name
+		}
+	}
+	return nil
+}
+
+// Summarize 汇总所有节点的用量
+func Summarize(nodes []NodeUsage) Summary {
+	s := Summary{NodeNum: len(nodes)}
+	for i := range nodes {
+		s.Usage.add(nodes[i].Usage)
+		s.Allocatable.add(nodes[i].Allocatable)
+	}
+	return s
+}
+
+// GroupByNamespace 按 namespace 汇总 pod 用量
+func GroupByNamespace(pods []PodUsage) []GroupUsage {
+	return group(pods, func(p PodUsage) GroupUsage {
+		return GroupUsage{Name: p.Namespace}
+	})
+}
+
+// GroupByWorkload 按工作负载汇总 pod 用量,需要先调用 ResolveWorkloads
+func GroupByWorkload(pods []PodUsage) []GroupUsage {
+	return group(pods, func(p PodUsage) GroupUsage {
+		return GroupUsage{Namespace: p.Namespace, Kind: p.WorkloadKind, Name: p.WorkloadName}
+	})
+}
+
+func group(pods []PodUsage, keyFunc func(p PodUsage) GroupUsage) []GroupUsage {
+	index := map[GroupUsage]int{}
+	result := make([]GroupUsage, 0)
+	for i := range pods {
+		key := keyFunc(pods[i])
+		j, ok := index[key]
+		if !ok {
+			j = len(result)
+			index[key] = j
+			result = append(result, key)
+		}
+		result[j].PodNum++
+		result[j].Usage.add(pods[i].Usage)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// TopPods 按 CPU 或内存用量倒序返回前 n 个 pod
+func TopPods(pods []PodUsage, n int, sortBy string) []PodUsage {
+	sorted := make([]PodUsage, len(pods))
+	copy(sorted, pods)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sortBy == SortByMemory {
+			return sorted[i].Usage.Memory > sorted[j].Usage.Memory
+		}
+		return sorted[i].Usage.CPU > sorted[j].Usage.CPU
+	})
+	if n > 0 && len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
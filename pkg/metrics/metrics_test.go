@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var fakeResponses = map[string]string{
+	"/apis/metrics.k8s.io/v1beta1/nodes": `{"kind":"NodeMetricsList","apiVersion":"metrics.k8s.io/v1beta1","items":[
+		{"metadata":{"name":"node-b"},"usage":{"cpu":"500m","memory":"1Gi"}},
+		{"metadata":{"name":"node-a"},"usage":{"cpu":"1","memory":"2Gi"}}]}`,
+	"/api/v1/nodes": `{"kind":"NodeList","apiVersion":"v1","items":[
+		{"metadata":{"name":"node-a"},"status":{"allocatable":{"cpu":"4","memory":"8Gi"}}},
+		{"metadata":{"name":"node-b"},"status":{"allocatable":{"cpu":"2","memory":"4Gi"}}}]}`,
+	"/apis/metrics.k8s.io/v1beta1/namespaces/default/pods": `{"kind":"PodMetricsList","apiVersion":"metrics.k8s.io/v1beta1","items":[
+		{"metadata":{"name":"web-7d4b9-abcde","namespace":"default"},"containers":[{"name":"web","usage":{"cpu":"200m","memory":"100Mi"}},{"name":"sidecar","usage":{"cpu":"50m","memory":"20Mi"}}]},
+		{"metadata":{"name":"web-7d4b9-fghij","namespace":"default"},"containers":[{"name":"web","usage":{"cpu":"100m","memory":"300Mi"}}]},
+		{"metadata":{"name":"debug","namespace":"default"},"containers":[{"name":"debug","usage":{"cpu":"10m","memory":"10Mi"}}]}]}`,
+	"/api/v1/namespaces/default/pods": `{"kind":"PodList","apiVersion":"v1","items":[
+		{"metadata":{"name":"web-7d4b9-abcde","namespace":"default","ownerReferences":[{"apiVersion":"apps/v1","kind":"ReplicaSet","name":"web-7d4b9","uid":"1","controller":true}]}},
+		{"metadata":{"name":"web-7d4b9-fghij","namespace":"default","ownerReferences":[{"apiVersion":"apps/v1","kind":"ReplicaSet","name":"web-7d4b9","uid":"1","controller":true}]}},
+		{"metadata":{"name":"debug","namespace":"default"}}]}`,
+	"/apis/apps/v1/namespaces/default/replicasets": `{"kind":"ReplicaSetList","apiVersion":"apps/v1","items":[
+		{"metadata":{"name":"web-7d4b9","namespace":"default","ownerReferences":[{"apiVersion":"apps/v1","kind":"Deployment","name":"web","uid":"2","controller":true}]}}]}`,
+	"/apis/batch/v1/namespaces/default/jobs": `{"kind":"JobList","apiVersion":"batch/v1","items":[]}`,
+}
+
+func newFakeClient(t *testing.T, metricsInstalled bool) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := fakeResponses[r.URL.Path]
+		if !ok || (!metricsInstalled && strings.HasPrefix(r.URL.Path, metricsApiPath)) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(client)
+}
+
+func TestNodeUsages(t *testing.T) {
+	c := newFakeClient(t, true)
+	nodes, err := c.NodeUsages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Name != "node-a" {
+		t.Fatalf("unexpected nodes %+v", nodes)
+	}
+	if nodes[0].Usage.CPU != 1 || nodes[0].Allocatable.CPU != 4 {
+		t.Errorf("unexpected usage of node-a %+v", nodes[0])
+	}
+	s := Summarize(nodes)
+	if s.Usage.CPU != 1.5 || s.Allocatable.CPU != 6 || s.Usage.Memory != 3*1024*1024*1024 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+}
+
+func TestPodUsages(t *testing.T) {
+	c := newFakeClient(t, true)
+	pods, err := c.PodUsages(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResolveWorkloads(context.Background(), "default", pods); err != nil {
+		t.Fatal(err)
+	}
+	workloads := GroupByWorkload(pods)
+	if len(workloads) != 2 {
+		t.Fatalf("expected 2 workloads, got %+v", workloads)
+	}
+	if workloads[0].Kind != "Deployment" || workloads[0].Name != "web" || workloads[0].PodNum != 2 || workloads[0].Usage.CPU != 0.35 {
+		t.Errorf("unexpected deployment usage %+v", workloads[0])
+	}
+	if workloads[1].Kind != "Pod" || workloads[1].Name != "debug" {
+		t.Errorf("unexpected bare pod usage %+v", workloads[1])
+	}
+	namespaces := GroupByNamespace(pods)
+	if len(namespaces) != 1 || namespaces[0].PodNum != 3 {
+		t.Errorf("unexpected namespace usage %+v", namespaces)
+	}
+	top := TopPods(pods, 1, SortByMemory)
+	if len(top) != 1 || top[0].Name != "web-7d4b9-fghij" {
+		t.Errorf("unexpected top pods %+v", top)
+	}
+	top = TopPods(pods, 2, SortByCPU)
+	if len(top) != 2 || top[0].Name != "web-7d4b9-abcde" {
+		t.Errorf("unexpected top pods %+v", top)
+	}
+}
+
+func TestMetricsUnavailable(t *testing.T) {
+	c := newFakeClient(t, false)
+	if _, err := c.NodeUsages(context.Background()); err != ErrMetricsUnavailable {
+		t.Errorf("expected ErrMetricsUnavailable, got %v", err)
+	}
+	if _, err := c.PodUsages(context.Background(), ""); err != ErrMetricsUnavailable {
+		t.Errorf("expected ErrMetricsUnavailable, got %v", err)
+	}
+}
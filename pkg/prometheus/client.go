@@ -0,0 +1,99 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	promApi "github.com/prometheus/client_golang/api"
+	promV1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+type Point struct {
+	Time  int64   `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// Series 一条时间序列,Legend 中的 {{label}} 会被替换为对应的标签值
+type Series struct {
+	Legend string            `json:"legend"`
+	Labels map[string]string `json:"labels"`
+	Points []Point           `json:"points"`
+}
+
+type Client struct {
+	api promV1.API
+}
+
+// NewClient 创建 Prometheus 客户端,roundTripper 负责认证以及通过集群 service proxy 访问
+func NewClient(address string, roundTripper http.RoundTripper) (*Client, error) {
+	c, err := promApi.NewClient(promApi.Config{Address: address, RoundTripper: roundTripper})
+	if err != nil {
+		return nil, err
+	}
+	return &Client{api: promV1.NewAPI(c)}, nil
+}
+
+// QueryRange 依次执行查询并合并结果
+func (c *Client) QueryRange(ctx context.Context, queries []Query, start, end time.Time, step time.Duration) ([]Series, error) {
+	result := make([]Series, 0)
+	for i := range queries {
+		value, _, err := c.api.QueryRange(ctx, queries[i].Expr, promV1.Range{Start: start, End: end, Step: step})
+		if err != nil {
+			return nil, err
+		}
+		matrix, ok := value.(model.Matrix)
+		if !ok {
+			continue
+		}
+		for _, stream := range matrix {
+			s := Series{
+				Labels: map[string]string{},
+				Points: make([]Point, 0, len(stream.Values)),
+			}
+			for k, v := range stream.Metric {
+				s.Labels[string(k)] = string(v)
+			}
+			s.Legend = formatLegend(queries[i].Legend, s.Labels)
+			for _, p := range stream.Values {
+				s.Points = append(s.Points, Point{Time: p.Timestamp.Unix(), Value: float64(p.Value)})
+			}
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func formatLegend(legend string, labels map[string]string) string {
+	for k, v := range labels {
+		legend = strings.ReplaceAll(legend, "{{"+k+"}}", v)
+	}
+	return legend
+}
+
+// BasicAuthRoundTripper 为请求添加 basic 认证
+type BasicAuthRoundTripper struct {
+	Username string
+	Password string
+	Next     http.RoundTripper
+}
+
+func (rt *BasicAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(rt.Username, rt.Password)
+	return rt.Next.RoundTrip(req)
+}
+
+// BearerTokenRoundTripper 为请求添加 bearer token
+type BearerTokenRoundTripper struct {
+	Token string
+	Next  http.RoundTripper
+}
+
+func (rt *BearerTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+rt.Token)
+	return rt.Next.RoundTrip(req)
+}
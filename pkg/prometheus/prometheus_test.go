@@ -0,0 +1,65 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	qs, err := Render(TargetWorkload, MetricCPU, Params{Namespace: "default", Kind: "Deployment", Workload: "web.v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qs) != 1 || !strings.Contains(qs[0].Expr, `pod=~"web\\.v2-[a-z0-9]+-[a-z0-9]+"`) || !strings.Contains(qs[0].Expr, "[5m]") {
+		t.Errorf("unexpected query %+v", qs)
+	}
+	qs, err = Render(TargetPod, MetricNetwork, Params{Namespace: "default", Pod: `a"b`, Window: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qs) != 2 || !strings.Contains(qs[0].Expr, `pod="a\"b"`) {
+		t.Errorf("label values must be escaped, got %+v", qs)
+	}
+	if _, err := Render(TargetNode, MetricCPU, Params{}); err == nil {
+		t.Error("node is required")
+	}
+	if _, err := Render(TargetNode, "disk", Params{Node: "n1"}); err == nil {
+		t.Error("unknown metric should fail")
+	}
+	if _, err := Render(TargetWorkload, MetricCPU, Params{Namespace: "default", Kind: "Foo", Workload: "web"}); err == nil {
+		t.Error("unknown workload kind should fail")
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query_range" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"container":"web"},"values":[[1600000000,"0.5"],[1600000060,"0.25"]]}]}}`))
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, &BearerTokenRoundTripper{Token: "secret", Next: http.DefaultTransport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs, _ := Render(TargetPod, MetricCPU, Params{Namespace: "default", Pod: "web-0"})
+	series, err := c.QueryRange(context.Background(), qs, time.Unix(1600000000, 0), time.Unix(1600000060, 0), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || series[0].Legend != "web" || len(series[0].Points) != 2 || series[0].Points[1].Value != 0.25 {
+		t.Errorf("unexpected series %+v", series)
+	}
+}
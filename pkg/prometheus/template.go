@@ -0,0 +1,192 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	TargetNode      = "node"
+	TargetPod       = "pod"
+	TargetWorkload  = "workload"
+	TargetNamespace = "namespace"
+
+	MetricCPU      = "cpu"
+	MetricMemory   = "memory"
+	MetricNetwork  = "network"
+	MetricRestarts = "restarts"
+)
+
+// Query 一条 PromQL 以及在图表中显示的名称
+type Query struct {
+	Legend string `json:"legend"`
+	Expr   string `json:"expr"`
+}
+
+// Params 渲染 PromQL 模版的参数,渲染前会转义为合法的标签值
+type Params struct {
+	Node      string
+	Namespace string
+	Pod       string
+	// 工作负载类型及名称,用于生成匹配 pod 名称的正则
+	Kind     string
+	Workload string
+	// rate 的时间窗口,例如 5m
+	Window string
+}
+
+type queryTemplate struct {
+	legend string
+	expr   string
+}
+
+// 基于 cAdvisor 和 kube-state-metrics 指标的内置模版
+var templates = map[string]map[string][]queryTemplate{
+	TargetNode: {
+		MetricCPU: {
+			{legend: "cpu", expr: `sum(rate(container_cpu_usage_seconds_total{id="/",node="{{.Node}}"}[{{.Window}}]))`},
+		},
+		MetricMemory: {
+			{legend: "memory", expr: `sum(container_memory_working_set_bytes{id="/",node="{{.Node}}"})`},
+		},
+		MetricNetwork: {
+			{legend: "receive", expr: `sum(rate(container_network_receive_bytes_total{id="/",node="{{.Node}}"}[{{.Window}}]))`},
+			{legend: "transmit", expr: `sum(rate(container_network_transmit_bytes_total{id="/",node="{{.Node}}"}[{{.Window}}]))`},
+		},
+		MetricRestarts: {
+			{legend: "restarts", expr: `sum(increase(kube_pod_container_status_restarts_total[{{.Window}}]) * on(namespace, pod) group_left() max by(namespace, pod) (kube_pod_info{node="{{.Node}}"}))`},
+		},
+	},
+	TargetPod: {
+		MetricCPU: {
+			{legend: "{{container}}", expr: `sum by(container) (rate(container_cpu_usage_seconds_total{namespace="{{.Namespace}}",pod="{{.Pod}}",container!="",container!="POD"}[{{.Window}}]))`},
+		},
+		MetricMemory: {
+			{legend: "{{container}}", expr: `sum by(container) (container_memory_working_set_bytes{namespace="{{.Namespace}}",pod="{{.Pod}}",container!="",container!="POD"})`},
+		},
+		MetricNetwork: {
+			{legend: "receive", expr: `sum(rate(container_network_receive_bytes_total{namespace="{{.Namespace}}",pod="{{.Pod}}"}[{{.Window}}]))`},
+			{legend: "transmit", expr: `sum(rate(container_network_transmit_bytes_total{namespace="{{.Namespace}}",pod="{{.Pod}}"}[{{.Window}}]))`},
+		},
+		MetricRestarts: {
+			{legend: "{{container}}", expr: `sum by(container) (kube_pod_container_status_restarts_total{namespace="{{.Namespace}}",pod="{{.Pod}}"})`},
+		},
+	},
+	TargetWorkload: {
+		MetricCPU: {
+			{legend: "{{pod}}", expr: `sum by(pod) (rate(container_cpu_usage_seconds_total{namespace="{{.Namespace}}",pod=~"{{.Pod}}",container!="",container!="POD"}[{{.Window}}]))`},
+		},
+		MetricMemory: {
+			{legend: "{{pod}}", expr: `sum by(pod) (container_memory_working_set_bytes{namespace="{{.Namespace}}",pod=~"{{.Pod}}",container!="",container!="POD"})`},
+		},
+		MetricNetwork: {
+			{legend: "receive", expr: `sum(rate(container_network_receive_bytes_total{namespace="{{.Namespace}}",pod=~"{{.Pod}}"}[{{.Window}}]))`},
+			{legend: "transmit", expr: `sum(rate(container_network_transmit_bytes_total{namespace="{{.Namespace}}",pod=~"{{.Pod}}"}[{{.Window}}]))`},
+		},
+		MetricRestarts: {
+			{legend: "{{pod}}", expr: `sum by(pod) (kube_pod_container_status_restarts_total{namespace="{{.Namespace}}",pod=~"{{.Pod}}"})`},
+		},
+	},
+	TargetNamespace: {
+		MetricCPU: {
+			{legend: "cpu", expr: `sum(rate(container_cpu_usage_seconds_total{namespace="{{.Namespace}}",container!="",container!="POD"}[{{.Window}}]))`},
+		},
+		MetricMemory: {
+			{legend: "memory", expr: `sum(container_memory_working_set_bytes{namespace="{{.Namespace}}",container!="",container!="POD"})`},
+		},
+		MetricNetwork: {
+			{legend: "receive", expr: `sum(rate(container_network_receive_bytes_total{namespace="{{.Namespace}}"}[{{.Window}}]))`},
+			{legend: "transmit", expr: `sum(rate(container_network_transmit_bytes_total{namespace="{{.Namespace}}"}[{{.Window}}]))`},
+		},
+		MetricRestarts: {
+			{legend: "restarts", expr: `sum(increase(kube_pod_container_status_restarts_total{namespace="{{.Namespace}}"}[{{.Window}}]))`},
+		},
+	},
+}
+
+// workloadPodPatterns 各类工作负载生成的 pod 名称规则
+var workloadPodPatterns = map[string]string{
+	"Deployment":  `%s-[a-z0-9]+-[a-z0-9]+`,
+	"StatefulSet": `%s-[0-9]+`,
+	"DaemonSet":   `%s-[a-z0-9]+`,
+	"ReplicaSet":  `%s-[a-z0-9]+`,
+	"Job":         `%s-[a-z0-9]+`,
+	"CronJob":     `%s-[0-9]+-[a-z0-9]+`,
+}
+
+// Render 根据目标类型和指标生成 PromQL
+func Render(target, metric string, p Params) ([]Query, error) {
+	metrics, ok := templates[target]
+	if !ok {
+		return nil, fmt.Errorf("unsupported target %s", target)
+	}
+	tpls, ok := metrics[metric]
+	if !ok {
+		return nil, fmt.Errorf("unsupported metric %s", metric)
+	}
+	if err := p.validate(target); err != nil {
+		return nil, err
+	}
+	if p.Window == "" {
+		p.Window = "5m"
+	}
+	escaped := Params{
+		Node:      escapeLabelValue(p.Node),
+		Namespace: escapeLabelValue(p.Namespace),
+		Pod:       escapeLabelValue(p.Pod),
+		Window:    p.Window,
+	}
+	if target == TargetWorkload {
+		pattern, ok := workloadPodPatterns[p.Kind]
+		if !ok {
+			return nil, fmt.Errorf("unsupported workload kind %s", p.Kind)
+		}
+		escaped.Pod = escapeLabelValue(fmt.Sprintf(pattern, escapeRegex(p.Workload)))
+	}
+	result := make([]Query, 0, len(tpls))
+	for i := range tpls {
+		t, err := template.New(target + "-" + metric).Parse(tpls[i].expr)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, escaped); err != nil {
+			return nil, err
+		}
+		result = append(result, Query{Legend: tpls[i].legend, Expr: buf.String()})
+	}
+	return result, nil
+}
+
+func (p Params) validate(target string) error {
+	switch target {
+	case TargetNode:
+		if p.Node == "" {
+			return fmt.Errorf("node is required")
+		}
+	case TargetPod:
+		if p.Namespace == "" || p.Pod == "" {
+			return fmt.Errorf("namespace and pod are required")
+		}
+	case TargetWorkload:
+		if p.Namespace == "" || p.Workload == "" {
+			return fmt.Errorf("namespace and workload are required")
+		}
+	case TargetNamespace:
+		if p.Namespace == "" {
+			return fmt.Errorf("namespace is required")
+		}
+	}
+	return nil
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func escapeRegex(v string) string {
+	return strings.NewReplacer(`.`, `\.`, `+`, `\+`, `*`, `\*`, `?`, `\?`, `(`, `\(`, `)`, `\)`,
+		`[`, `\[`, `]`, `\]`, `{`, `\{`, `}`, `\}`, `|`, `\|`, `^`, `\^`, `$`, `\$`).Replace(v)
+}
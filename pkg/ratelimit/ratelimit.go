@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 令牌桶闲置超过该时间后被清理
+const limiterIdleTimeout = 10 * time.Minute
+
+// KeyedLimiter 为每个 key(用户、集群)维护独立的令牌桶
+type KeyedLimiter struct {
+	qps      rate.Limit
+	burst    int
+	limiters map[string]*keyedLimiter
+	// 闲置超过 idle 的令牌桶已经恢复满额,删除后重新创建不影响限流
+	idle      time.Duration
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+type keyedLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewKeyedLimiter(qps float64, burst int) *KeyedLimiter {
+	if burst <= 0 {
+		burst = int(math.Ceil(qps))
+	}
+	idle := limiterIdleTimeout
+	if qps > 0 {
+		if refill := time.Duration(float64(burst) / qps * float64(time.Second)); refill > idle {
+			idle = refill
+		}
+	}
+	return &KeyedLimiter{
+		qps:       rate.Limit(qps),
+		burst:     burst,
+		limiters:  map[string]*keyedLimiter{},
+		idle:      idle,
+		lastSweep: time.Now(),
+	}
+}
+
+func (k *KeyedLimiter) get(key string) *rate.Limiter {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	now := time.Now()
+	if now.Sub(k.lastSweep) >= k.idle {
+		k.sweep(now)
+	}
+	l, ok := k.limiters[key]
+	if !ok {
+		l = &keyedLimiter{limiter: rate.NewLimiter(k.qps, k.burst)}
+		k.limiters[key] = l
+	}
+	l.lastSeen = now
+	return l.limiter
+}
+
+// sweep 删除闲置的令牌桶,避免 key 越来越多时占用的内存不断增长
+func (k *KeyedLimiter) sweep(now time.Time) {
+	for key, l := range k.limiters {
+		if now.Sub(l.lastSeen) >= k.idle {
+			delete(k.limiters, key)
+		}
+	}
+	k.lastSweep = now
+}
+
+// Reserve 申请一个令牌,成功时返回 0,否则返回需要等待的时间且不消耗令牌
+func (k *KeyedLimiter) Reserve(key string) time.Duration {
+	if k == nil || k.qps <= 0 {
+		return 0
+	}
+	r := k.get(key).Reserve()
+	if !r.OK() {
+		return time.Second
+	}
+	delay := r.Delay()
+	if delay > 0 {
+		r.Cancel()
+	}
+	return delay
+}
+
+// Counter 限制每个 key 同时持有的数量,用于日志、终端、watch 等长连接
+type Counter struct {
+	max    int
+	counts map[string]int
+	lock   sync.Mutex
+}
+
+func NewCounter(max int) *Counter {
+	return &Counter{
+		max:    max,
+		counts: map[string]int{},
+	}
+}
+
+// Acquire 占用一个名额,超过上限时返回 false
+func (c *Counter) Acquire(key string) bool {
+	if c == nil || c.max <= 0 {
+		return true
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.counts[key] >= c.max {
+		return false
+	}
+	c.counts[key]++
+	return true
+}
+
+// Release 释放 Acquire 占用的名额
+func (c *Counter) Release(key string) {
+	if c == nil || c.max <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.counts[key] <= 1 {
+		delete(c.counts, key)
+		return
+	}
+	c.counts[key]--
+}
+
+// Count 返回 key 当前占用的数量
+func (c *Counter) Count(key string) int {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.counts[key]
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	l := NewKeyedLimiter(1, 2)
+	for i := 0; i < 2; i++ {
+		if d := l.Reserve("alice"); d != 0 {
+			t.Fatalf("request %d should not be throttled, got delay %s", i, d)
+		}
+	}
+	if d := l.Reserve("alice"); d <= 0 {
+		t.Fatal("third request should be throttled")
+	}
+	if d := l.Reserve("bob"); d != 0 {
+		t.Fatal("limiter must be independent per key")
+	}
+}
+
+func TestKeyedLimiterSweep(t *testing.T) {
+	l := NewKeyedLimiter(1, 2)
+	l.Reserve("alice")
+	l.Reserve("bob")
+	// 模拟 alice 闲置超时
+	l.limiters["alice"].lastSeen = time.Now().Add(-l.idle)
+	l.lastSweep = time.Now().Add(-l.idle)
+	l.Reserve("bob")
+	if _, ok := l.limiters["alice"]; ok {
+		t.Error("idle limiter should be removed")
+	}
+	if _, ok := l.limiters["bob"]; !ok {
+		t.Error("active limiter should be kept")
+	}
+	if NewKeyedLimiter(0.001, 10).idle <= limiterIdleTimeout {
+		t.Error("limiters should not be removed before they refill")
+	}
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter(2)
+	if !c.Acquire("alice") || !c.Acquire("alice") {
+		t.Fatal("first two acquires should succeed")
+	}
+	if c.Acquire("alice") {
+		t.Fatal("third acquire should fail")
+	}
+	c.Release("alice")
+	if !c.Acquire("alice") {
+		t.Fatal("acquire after release should succeed")
+	}
+	if c.Count("alice") != 2 {
+		t.Fatalf("expected count 2, got %d", c.Count("alice"))
+	}
+	if !NewCounter(0).Acquire("alice") {
+		t.Fatal("counter without limit should always acquire")
+	}
+}
@@ -0,0 +1,309 @@
+package terminal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	stateNormal = iota
+	// 收到 ESC
+	stateEscape
+	// 收到 ESC [,等待控制序列结束
+	stateCSI
+	// 收到 ESC O
+	stateSS3
+)
+
+// CommandParser 根据终端的输入还原用户执行的命令行,处理退格、方向键、常用的行编辑快捷键以及粘贴
+// Tab 补全等依赖 shell 输出的内容无法还原
+type CommandParser struct {
+	line    []rune
+	cursor  int
+	state   int
+	params  []byte
+	pending []byte
+	// 本次会话中执行过的命令,用于处理上下方向键
+	history []string
+	index   int
+	// 处于 bracketed paste 中
+	pasting bool
+}
+
+func NewCommandParser() *CommandParser {
+	return &CommandParser{}
+}
+
+func (c *CommandParser) insert(r rune) {
+	c.line = append(c.line, 0)
+	copy(c.line[c.cursor+1:], c.line[c.cursor:])
+	c.line[c.cursor] = r
+	c.cursor++
+}
+
+func (c *CommandParser) setLine(s string) {
+	c.line = []rune(s)
+	c.cursor = len(c.line)
+}
+
+// enter 结束当前行,返回去掉首尾空白后的命令
+func (c *CommandParser) enter() string {
+	command := strings.TrimSpace(string(c.line))
+	c.line = c.line[:0]
+	c.cursor = 0
+	if command != "" {
+		c.history = append(c.history, command)
+	}
+	c.index = len(c.history)
+	return command
+}
+
+func (c *CommandParser) deleteWord() {
+	i := c.cursor
+	for i > 0 && c.line[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && c.line[i-1] != ' ' {
+		i--
+	}
+	c.line = append(c.line[:i], c.line[c.cursor:]...)
+	c.cursor = i
+}
+
+func (c *CommandParser) historyMove(delta int) {
+	index := c.index + delta
+	if index < 0 || index > len(c.history) {
+		return
+	}
+	c.index = index
+	if index == len(c.history) {
+		c.setLine("")
+		return
+	}
+	c.setLine(c.history[index])
+}
+
+// control 处理控制序列,final 为序列的最后一个字符
+func (c *CommandParser) control(final byte) {
+	params := string(c.params)
+	switch final {
+	case 'A':
+		c.historyMove(-1)
+	case 'B':
+		c.historyMove(1)
+	case 'C':
+		if c.cursor < len(c.line) {
+			c.cursor++
+		}
+	case 'D':
+		if c.cursor > 0 {
+			c.cursor--
+		}
+	case 'H':
+		c.cursor = 0
+	case 'F':
+		c.cursor = len(c.line)
+	case '~':
+		switch params {
+		case "1", "7":
+			c.cursor = 0
+		case "4", "8":
+			c.cursor = len(c.line)
+		case "3":
+			if c.cursor < len(c.line) {
+				c.line = append(c.line[:c.cursor], c.line[c.cursor+1:]...)
+			}
+		case "200":
+			c.pasting = true
+		case "201":
+			c.pasting = false
+		}
+	}
+}
+
+// Feed 处理一段输入,返回其中完成的命令以及每条命令结束时对应的输入位置
+func (c *CommandParser) Feed(p []byte) ([]string, []int) {
+	var commands []string
+	var offsets []int
+	data := append(c.pending, p...)
+	base := len(c.pending)
+	c.pending = nil
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch c.state {
+		case stateEscape:
+			c.state = stateNormal
+			switch b {
+			case '[':
+				c.state = stateCSI
+				c.params = c.params[:0]
+			case 'O':
+				c.state = stateSS3
+			case 'b', 'f':
+				// alt+b/alt+f 按单词移动,无法准确还原,移动到行首或行尾
+				if b == 'b' {
+					c.cursor = 0
+				} else {
+					c.cursor = len(c.line)
+				}
+			}
+			i++
+			continue
+		case stateCSI:
+			if b >= 0x40 && b <= 0x7e {
+				c.state = stateNormal
+				c.control(b)
+			} else {
+				c.params = append(c.params, b)
+			}
+			i++
+			continue
+		case stateSS3:
+			c.state = stateNormal
+			c.control(b)
+			i++
+			continue
+		}
+		switch b {
+		case 0x1b:
+			c.state = stateEscape
+		case '\r', '\n':
+			// 粘贴的多行内容中的 \r\n 只算一次换行
+			if b == '\n' && i > 0 && data[i-1] == '\r' {
+				break
+			}
+			if command := c.enter(); command != "" {
+				commands = append(commands, command)
+				offsets = append(offsets, i-base)
+			}
+		case 0x7f, 0x08:
+			if c.cursor > 0 {
+				c.line = append(c.line[:c.cursor-1], c.line[c.cursor:]...)
+				c.cursor--
+			}
+		case 0x01:
+			c.cursor = 0
+		case 0x05:
+			c.cursor = len(c.line)
+		case 0x02:
+			if c.cursor > 0 {
+				c.cursor--
+			}
+		case 0x06:
+			if c.cursor < len(c.line) {
+				c.cursor++
+			}
+		case 0x03:
+			// ctrl+c 放弃当前行
+			c.line = c.line[:0]
+			c.cursor = 0
+			c.index = len(c.history)
+		case 0x15:
+			c.line = c.line[c.cursor:]
+			c.cursor = 0
+		case 0x0b:
+			c.line = c.line[:c.cursor]
+		case 0x17:
+			c.deleteWord()
+		case 0x10:
+			c.historyMove(-1)
+		case 0x0e:
+			c.historyMove(1)
+		case '\t':
+			if c.pasting {
+				c.insert(' ')
+			}
+		default:
+			if b < 0x20 {
+				break
+			}
+			if !utf8.FullRune(data[i:]) {
+				c.pending = append([]byte{}, data[i:]...)
+				return commands, offsets
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			c.insert(r)
+			i += size
+			continue
+		}
+		i++
+	}
+	return commands, offsets
+}
+
+// CommandAuditor 记录终端中执行的命令,命令匹配黑名单时阻断会话
+type CommandAuditor struct {
+	lock     sync.Mutex
+	parser   *CommandParser
+	denyList []*regexp.Regexp
+	// 每条命令执行时回调,blocked 表示命令被阻断
+	onCommand func(command string, blocked bool)
+	blocked   string
+}
+
+// ValidateDenyList 检查命令黑名单中的正则表达式是否合法
+func ValidateDenyList(denyList []string) error {
+	for i := range denyList {
+		if _, err := regexp.Compile(denyList[i]); err != nil {
+			return fmt.Errorf("invalid command deny list pattern %q: %s", denyList[i], err.Error())
+		}
+	}
+	return nil
+}
+
+// NewCommandAuditor denyList 中的每一项为匹配整行命令的正则表达式
+func NewCommandAuditor(denyList []string, onCommand func(command string, blocked bool)) (*CommandAuditor, error) {
+	a := &CommandAuditor{parser: NewCommandParser(), onCommand: onCommand}
+	for i := range denyList {
+		re, err := regexp.Compile(denyList[i])
+		if err != nil {
+			return nil, err
+		}
+		a.denyList = append(a.denyList, re)
+	}
+	return a, nil
+}
+
+func (a *CommandAuditor) denied(command string) bool {
+	for i := range a.denyList {
+		if a.denyList[i].MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit 处理一段输入,返回可以发送给进程的内容,命令被阻断时返回被阻断的命令
+// 被阻断的命令不会发送回车,而是以 ctrl+c 代替,之后的输入全部丢弃
+func (a *CommandAuditor) Audit(p []byte) ([]byte, string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.blocked != "" {
+		return nil, a.blocked
+	}
+	commands, offsets := a.parser.Feed(p)
+	for i := range commands {
+		if a.denied(commands[i]) {
+			a.blocked = commands[i]
+			if a.onCommand != nil {
+				a.onCommand(commands[i], true)
+			}
+			data := append(append([]byte{}, p[:offsets[i]]...), 0x03)
+			return data, a.blocked
+		}
+		if a.onCommand != nil {
+			a.onCommand(commands[i], false)
+		}
+	}
+	return p, ""
+}
+
+// Blocked 返回被阻断的命令,会话未被阻断时为空
+func (a *CommandAuditor) Blocked() string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.blocked
+}
@@ -0,0 +1,73 @@
+package terminal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandParser(t *testing.T) {
+	cases := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{"plain", []string{"ls -l\r"}, []string{"ls -l"}},
+		{"backspace", []string{"lss\x7f -a\r"}, []string{"ls -a"}},
+		{"cursor", []string{"echo world\x1b[D\x1b[D\x1b[D\x1b[D\x1b[Dhello \r"}, []string{"echo hello world"}},
+		{"ctrl", []string{"rm -rf /\x15pwd\r", "cat\x03id\r"}, []string{"pwd", "id"}},
+		{"history", []string{"whoami\r", "\x1b[A\r", "\x1bOA\x7f\x7f\x7f\x7f\x7f\x7fid\r"}, []string{"whoami", "whoami", "id"}},
+		{"paste", []string{"\x1b[200~cd /tmp\r\nls\r\n\x1b[201~"}, []string{"cd /tmp", "ls"}},
+		{"split", []string{"echo 你", "\xe5", "\xa5\xbd\r"}, []string{"echo 你好"}},
+		{"escape split", []string{"ab\x1b", "[D", "c\r"}, []string{"acb"}},
+		{"delete", []string{"abc\x01\x1b[3~\r"}, []string{"bc"}},
+	}
+	for _, c := range cases {
+		parser := NewCommandParser()
+		var got []string
+		for _, in := range c.input {
+			commands, _ := parser.Feed([]byte(in))
+			got = append(got, commands...)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCommandAuditor(t *testing.T) {
+	var audited []string
+	auditor, err := NewCommandAuditor([]string{`^rm\s+-rf\s+/`}, func(command string, blocked bool) {
+		if blocked {
+			command = "blocked: " + command
+		}
+		audited = append(audited, command)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, blocked := auditor.Audit([]byte("ls\r")); blocked != "" || string(data) != "ls\r" {
+		t.Fatalf("unexpected audit result %q %q", data, blocked)
+	}
+	data, blocked := auditor.Audit([]byte("rm -rf /\r"))
+	if blocked != "rm -rf /" || string(data) != "rm -rf /\x03" {
+		t.Fatalf("command should be blocked, got %q %q", data, blocked)
+	}
+	if data, _ := auditor.Audit([]byte("id\r")); data != nil {
+		t.Errorf("input after blocked should be dropped, got %q", data)
+	}
+	if !reflect.DeepEqual(audited, []string{"ls", "blocked: rm -rf /"}) {
+		t.Errorf("unexpected audited commands %q", audited)
+	}
+	if _, err := NewCommandAuditor([]string{"("}, nil); err == nil {
+		t.Error("invalid deny list should be rejected")
+	}
+}
+
+func TestValidateDenyList(t *testing.T) {
+	if err := ValidateDenyList([]string{`^rm\s+-rf`, `shutdown`}); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateDenyList([]string{`shutdown`, `(rm`}); err == nil {
+		t.Error("invalid pattern should be rejected")
+	}
+}
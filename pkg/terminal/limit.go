@@ -0,0 +1,152 @@
+package terminal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 检查会话是否超时的间隔
+const sessionReapInterval = 10 * time.Second
+
+// SessionLimit 同时打开的终端数量限制,0 表示不限制
+type SessionLimit struct {
+	MaxPerUser    int
+	MaxPerCluster int
+}
+
+// SessionInfo 管理员查看的会话信息
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	User         string    `json:"user"`
+	Cluster      string    `json:"cluster"`
+	Namespace    string    `json:"namespace"`
+	Pod          string    `json:"pod"`
+	Container    string    `json:"container"`
+	StartTime    time.Time `json:"startTime"`
+	LastActive   time.Time `json:"lastActive"`
+	ExpireAt     time.Time `json:"expireAt"`
+	Participants int       `json:"participants"`
+}
+
+func (t TerminalSession) idleTimeout() time.Duration {
+	if t.IdleTimeout > 0 {
+		return t.IdleTimeout
+	}
+	return SessionTerminalStoreTime * time.Minute
+}
+
+// expired 返回会话需要关闭的原因,未超时时为空
+func (t TerminalSession) expired(now time.Time) string {
+	if t.MaxDuration > 0 && now.After(t.StartTime.Add(t.MaxDuration)) {
+		return "the session has reached the maximum duration"
+	}
+	if now.After(t.TimeOut) {
+		return "the session has been idle for too long"
+	}
+	return ""
+}
+
+func (sm *SessionMap) checkLimit(user, cluster string, limit SessionLimit) error {
+	var userCount, clusterCount int
+	for _, s := range sm.Sessions {
+		if s.User == user {
+			userCount++
+		}
+		if s.Cluster == cluster {
+			clusterCount++
+		}
+	}
+	if limit.MaxPerUser > 0 && userCount >= limit.MaxPerUser {
+		return fmt.Errorf("too many terminals, each user can open at most %d terminals", limit.MaxPerUser)
+	}
+	if limit.MaxPerCluster > 0 && clusterCount >= limit.MaxPerCluster {
+		return fmt.Errorf("too many terminals, cluster %s can open at most %d terminals", cluster, limit.MaxPerCluster)
+	}
+	return nil
+}
+
+// CheckLimit 检查用户和集群打开的终端数量是否已达到上限
+func (sm *SessionMap) CheckLimit(user, cluster string, limit SessionLimit) error {
+	sm.Lock.RLock()
+	defer sm.Lock.RUnlock()
+	return sm.checkLimit(user, cluster, limit)
+}
+
+// Add 未达到上限时保存新的会话
+func (sm *SessionMap) Add(session TerminalSession, limit SessionLimit) error {
+	sm.Lock.Lock()
+	defer sm.Lock.Unlock()
+	if err := sm.checkLimit(session.User, session.Cluster, limit); err != nil {
+		return err
+	}
+	if session.StartTime.IsZero() {
+		session.StartTime = time.Now()
+	}
+	session.TimeOut = time.Now().Add(session.idleTimeout())
+	sm.Sessions[session.Id] = session
+	return nil
+}
+
+// List 返回所有打开的会话,按开始时间排序
+func (sm *SessionMap) List() []SessionInfo {
+	sm.Lock.RLock()
+	defer sm.Lock.RUnlock()
+	sessions := make([]SessionInfo, 0, len(sm.Sessions))
+	for _, s := range sm.Sessions {
+		info := SessionInfo{
+			ID:           s.Id,
+			User:         s.User,
+			Cluster:      s.Cluster,
+			Namespace:    s.Namespace,
+			Pod:          s.Pod,
+			Container:    s.Container,
+			StartTime:    s.StartTime,
+			LastActive:   s.TimeOut.Add(-s.idleTimeout()),
+			ExpireAt:     s.TimeOut,
+			Participants: 1,
+		}
+		if s.MaxDuration > 0 && s.StartTime.Add(s.MaxDuration).Before(info.ExpireAt) {
+			info.ExpireAt = s.StartTime.Add(s.MaxDuration)
+		}
+		if s.Shared != nil {
+			info.Participants = len(s.Shared.Participants())
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartTime.Before(sessions[j].StartTime)
+	})
+	return sessions
+}
+
+// Reap 关闭空闲超时或超过最长持续时间的会话
+func (sm *SessionMap) Reap(now time.Time) {
+	expired := map[string]string{}
+	sm.Lock.RLock()
+	for id, s := range sm.Sessions {
+		if reason := s.expired(now); reason != "" {
+			expired[id] = reason
+		}
+	}
+	sm.Lock.RUnlock()
+	for id, reason := range expired {
+		sm.Close(id, 2, reason)
+	}
+}
+
+var reaperOnce sync.Once
+
+// StartSessionReaper 定期关闭超时的会话
+func StartSessionReaper() {
+	reaperOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(sessionReapInterval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				TerminalSessions.Reap(now)
+			}
+		}()
+	})
+}
@@ -0,0 +1,41 @@
+package terminal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionLimitAndReap(t *testing.T) {
+	sm := &SessionMap{Sessions: make(map[string]TerminalSession)}
+	limit := SessionLimit{MaxPerUser: 2, MaxPerCluster: 3}
+	for _, s := range []TerminalSession{
+		{Id: "1", User: "alice", Cluster: "c1"},
+		{Id: "2", User: "alice", Cluster: "c1", IdleTimeout: time.Hour, MaxDuration: time.Minute},
+		{Id: "3", User: "bob", Cluster: "c1", IdleTimeout: time.Hour},
+	} {
+		if err := sm.Add(s, limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.Add(TerminalSession{Id: "4", User: "alice", Cluster: "c2"}, limit); err == nil {
+		t.Error("user limit should be enforced")
+	}
+	if err := sm.Add(TerminalSession{Id: "4", User: "carol", Cluster: "c1"}, limit); err == nil {
+		t.Error("cluster limit should be enforced")
+	}
+	sessions := sm.List()
+	if len(sessions) != 3 {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	for _, s := range sessions {
+		if s.ID == "2" && s.ExpireAt.After(s.StartTime.Add(time.Minute)) {
+			t.Errorf("session should expire at max duration, got %+v", s)
+		}
+	}
+
+	// 10 分钟后会话 1 空闲超时,会话 2 超过最长持续时间
+	sm.Reap(time.Now().Add(10 * time.Minute))
+	if _, ok := sm.Sessions["3"]; len(sm.Sessions) != 1 || !ok {
+		t.Errorf("expired sessions should be closed, got %v", sm.Sessions)
+	}
+}
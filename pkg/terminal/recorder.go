@@ -0,0 +1,164 @@
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultRecordWidth  = 80
+	defaultRecordHeight = 24
+)
+
+// RecordHeader asciicast v2 文件的头部
+type RecordHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder 以 asciicast v2 格式记录终端的输出,可以使用 asciinema player 回放
+type Recorder struct {
+	lock        sync.Mutex
+	file        *os.File
+	writer      *bufio.Writer
+	start       time.Time
+	recordStdin bool
+	// 上一次输出末尾不完整的 utf8 字符,和下一次输出合并后再记录
+	pending []byte
+	size    int64
+	closed  bool
+}
+
+// NewRecorder 创建录像文件并写入头部
+func NewRecorder(path string, title string, shell string, recordStdin bool) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		file:        file,
+		writer:      bufio.NewWriter(file),
+		start:       time.Now(),
+		recordStdin: recordStdin,
+	}
+	header, err := json.Marshal(RecordHeader{
+		Version:   2,
+		Width:     defaultRecordWidth,
+		Height:    defaultRecordHeight,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"SHELL": shell, "TERM": "xterm"},
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if err := r.writeLine(header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Recorder) writeLine(line []byte) error {
+	n, err := r.writer.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
+
+func (r *Recorder) writeEvent(code string, data string) error {
+	event, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), code, data})
+	if err != nil {
+		return err
+	}
+	return r.writeLine(event)
+}
+
+// splitIncomplete 拆分出末尾不完整的 utf8 字符
+func splitIncomplete(p []byte) ([]byte, []byte) {
+	for i := 1; i <= utf8.UTFMax && i <= len(p); i++ {
+		c := p[len(p)-i]
+		if c < utf8.RuneSelf {
+			return p, nil
+		}
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(p[len(p)-i:]) {
+				return p, nil
+			}
+			return p[:len(p)-i], p[len(p)-i:]
+		}
+	}
+	return p, nil
+}
+
+// Output 记录输出
+func (r *Recorder) Output(p []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	data, pending := splitIncomplete(append(r.pending, p...))
+	r.pending = append([]byte{}, pending...)
+	if len(data) == 0 {
+		return nil
+	}
+	return r.writeEvent("o", string(data))
+}
+
+// Input 记录输入,未开启输入记录时忽略
+func (r *Recorder) Input(p []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed || !r.recordStdin {
+		return nil
+	}
+	return r.writeEvent("i", string(p))
+}
+
+// Resize 记录终端大小的变化
+func (r *Recorder) Resize(cols, rows uint16) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	return r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Size 已写入的字节数
+func (r *Recorder) Size() int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.size
+}
+
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if len(r.pending) > 0 {
+		_ = r.writeEvent("o", string(r.pending))
+	}
+	if err := r.writer.Flush(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,60 @@
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "2021-01-01", "session.cast")
+	r, err := NewRecorder(path, "cluster/default/web/nginx", "sh", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Resize(120, 40)
+	_ = r.Input([]byte("ls\r"))
+	// "你" 被拆分在两次输出中
+	word := []byte("你好")
+	_ = r.Output(append([]byte("hello "), word[:2]...))
+	_ = r.Output(word[2:])
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 events, got %v", lines)
+	}
+	var header RecordHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Env["SHELL"] != "sh" {
+		t.Errorf("unexpected header %s", lines[0])
+	}
+	var events [][]interface{}
+	for _, line := range lines[1:] {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if events[0][1] != "r" || events[0][2] != "120x40" {
+		t.Errorf("unexpected resize event %v", events[0])
+	}
+	if events[1][1] != "o" || events[1][2] != "hello " || events[2][2] != "你好" {
+		t.Errorf("incomplete utf8 characters should be merged, got %v %v", events[1], events[2])
+	}
+	if info, _ := os.Stat(path); info.Size() != r.Size() {
+		t.Errorf("size %d does not match file size %d", r.Size(), info.Size())
+	}
+}
@@ -0,0 +1,349 @@
+package terminal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/igm/sockjs-go.v2/sockjs"
+)
+
+const (
+	// 合并后的输入缓冲区大小
+	sharedInputBuffer = 16
+	// 每个观看者待发送的消息数量上限,超出时断开该连接,避免拖慢其他参与者
+	viewerQueueSize = 256
+)
+
+// Participant 共享会话的参与者
+type Participant struct {
+	User     string    `json:"user"`
+	Owner    bool      `json:"owner"`
+	Writable bool      `json:"writable"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+type viewer struct {
+	Participant
+	id      string
+	session sockjs.Session
+	queue   chan TerminalMessage
+	stopped chan struct{}
+	stop    sync.Once
+}
+
+func newViewer(id string, p Participant) *viewer {
+	return &viewer{
+		id:          id,
+		Participant: p,
+		queue:       make(chan TerminalMessage, viewerQueueSize),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// write 按顺序发送队列中的消息,发送失败或连接移除后停止
+func (v *viewer) write() {
+	for {
+		select {
+		case msg := <-v.queue:
+			if err := sendMessage(v.session, msg); err != nil {
+				v.close(2, "")
+				return
+			}
+		case <-v.stopped:
+			return
+		}
+	}
+}
+
+// enqueue 不阻塞地加入发送队列,队列已满时返回 false
+func (v *viewer) enqueue(msg TerminalMessage) bool {
+	select {
+	case <-v.stopped:
+		return true
+	default:
+	}
+	select {
+	case v.queue <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// close 停止发送并断开连接
+func (v *viewer) close(status uint32, reason string) {
+	v.stop.Do(func() {
+		close(v.stopped)
+		if v.session != nil {
+			_ = v.session.Close(status, reason)
+		}
+	})
+}
+
+type inputEvent struct {
+	msg TerminalMessage
+	err error
+}
+
+// SharedSession 终端会话的共享状态,会话所有者可以邀请其他用户只读观看或共同操作
+// 所有连接的输入合并后交给 exec 的 stdin,输出分发给所有连接
+type SharedSession struct {
+	lock    sync.RWMutex
+	Owner   string
+	Cluster string
+	owner   *viewer
+	input   chan inputEvent
+	done    chan struct{}
+	// 被邀请的用户,值表示是否可以输入
+	invites map[string]bool
+	viewers map[string]*viewer
+	closed  bool
+}
+
+func NewSharedSession(owner, cluster string) *SharedSession {
+	return &SharedSession{
+		Owner:   owner,
+		Cluster: cluster,
+		input:   make(chan inputEvent, sharedInputBuffer),
+		done:    make(chan struct{}),
+		invites: map[string]bool{},
+		viewers: map[string]*viewer{},
+	}
+}
+
+// Invite 邀请用户加入会话,writable 为 false 时只能观看
+func (s *SharedSession) Invite(user string, writable bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.invites[user] = writable
+	// 已加入的连接按新的权限处理
+	for _, v := range s.viewers {
+		if v.User == user {
+			v.Writable = writable
+		}
+	}
+}
+
+// Revoke 取消邀请并断开该用户已加入的连接
+func (s *SharedSession) Revoke(user string) {
+	s.lock.Lock()
+	delete(s.invites, user)
+	for id, v := range s.viewers {
+		if v.User == user {
+			delete(s.viewers, id)
+			v.close(2, "the invitation has been revoked")
+		}
+	}
+	s.lock.Unlock()
+	s.broadcastPresence()
+}
+
+// Invitation 返回用户是否被邀请以及是否可以输入
+func (s *SharedSession) Invitation(user string) (writable bool, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	writable, ok = s.invites[user]
+	return
+}
+
+func (s *SharedSession) Invites() map[string]bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	invites := make(map[string]bool, len(s.invites))
+	for k, v := range s.invites {
+		invites[k] = v
+	}
+	return invites
+}
+
+// Join 为被邀请的用户创建连接 id,客户端使用该 id 绑定 SockJS 连接,超时未绑定时失效
+func (s *SharedSession) Join(user string) (string, bool, error) {
+	id, err := GenTerminalSessionId()
+	if err != nil {
+		return "", false, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return "", false, errors.New("the session has been closed")
+	}
+	writable, ok := s.invites[user]
+	if !ok {
+		return "", false, fmt.Errorf("user %s is not invited", user)
+	}
+	s.viewers[id] = newViewer(id, Participant{User: user, Writable: writable})
+	time.AfterFunc(SessionBindTimeout*time.Minute, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if v, ok := s.viewers[id]; ok && v.session == nil {
+			delete(s.viewers, id)
+		}
+	})
+	return id, writable, nil
+}
+
+// Participants 返回已连接的参与者,会话所有者排在最前
+func (s *SharedSession) Participants() []Participant {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var participants []Participant
+	if s.owner != nil {
+		participants = append(participants, s.owner.Participant)
+	}
+	var others []Participant
+	for _, v := range s.viewers {
+		if v.session != nil {
+			others = append(others, v.Participant)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].JoinedAt.Before(others[j].JoinedAt)
+	})
+	return append(participants, others...)
+}
+
+func (s *SharedSession) hasViewer(id string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	v, ok := s.viewers[id]
+	return ok && v.session == nil
+}
+
+// bindOwner 绑定会话所有者的连接,开始接收输入
+func (s *SharedSession) bindOwner(session sockjs.Session) {
+	s.lock.Lock()
+	s.owner = &viewer{session: session, Participant: Participant{User: s.Owner, Owner: true, Writable: true, JoinedAt: time.Now()}}
+	s.lock.Unlock()
+	go s.receive(s.owner)
+}
+
+// bindViewer 绑定被邀请用户的连接,user 不为空时检查连接 id 是否属于该用户
+func (s *SharedSession) bindViewer(id string, user string, session sockjs.Session) bool {
+	s.lock.Lock()
+	v, ok := s.viewers[id]
+	if !ok || v.session != nil || s.closed || (user != "" && v.User != user) {
+		s.lock.Unlock()
+		return false
+	}
+	v.session = session
+	v.JoinedAt = time.Now()
+	s.lock.Unlock()
+	go v.write()
+	go s.receive(v)
+	s.broadcastPresence()
+	return true
+}
+
+// receive 读取连接的输入,所有者的连接断开时结束会话,其他连接断开时只移除该参与者
+func (s *SharedSession) receive(v *viewer) {
+	for {
+		msg, err := recvMessage(v.session)
+		if err != nil {
+			if v.Owner {
+				s.push(inputEvent{err: err})
+				return
+			}
+			s.remove(v, "")
+			return
+		}
+		if !v.Owner {
+			s.lock.RLock()
+			writable := v.Writable
+			s.lock.RUnlock()
+			// 只有所有者可以调整终端大小
+			if msg.Op != "stdin" {
+				continue
+			}
+			if !writable {
+				v.enqueue(TerminalMessage{Op: "toast", Data: "the session is read-only"})
+				continue
+			}
+		}
+		if !s.push(inputEvent{msg: msg}) {
+			return
+		}
+	}
+}
+
+func (s *SharedSession) push(e inputEvent) bool {
+	select {
+	case s.input <- e:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// next 返回下一条输入
+func (s *SharedSession) next() (TerminalMessage, error) {
+	select {
+	case e := <-s.input:
+		return e.msg, e.err
+	case <-s.done:
+		return TerminalMessage{}, errors.New("the session has been closed")
+	}
+}
+
+// remove 移除参与者并断开连接,通知其他参与者
+func (s *SharedSession) remove(v *viewer, reason string) {
+	s.lock.Lock()
+	if s.viewers[v.id] == v {
+		delete(s.viewers, v.id)
+	}
+	s.lock.Unlock()
+	v.close(2, reason)
+	s.broadcastPresence()
+}
+
+// broadcast 将消息放入所有者以外参与者的发送队列,不等待发送完成
+// 队列已满的参与者被断开,避免一个缓慢的连接阻塞终端输出
+func (s *SharedSession) broadcast(msg TerminalMessage) {
+	s.lock.RLock()
+	viewers := make([]*viewer, 0, len(s.viewers))
+	for _, v := range s.viewers {
+		if v.session != nil {
+			viewers = append(viewers, v)
+		}
+	}
+	s.lock.RUnlock()
+	for _, v := range viewers {
+		if !v.enqueue(msg) {
+			go s.remove(v, "the connection is too slow to follow the terminal output")
+		}
+	}
+}
+
+// broadcastPresence 参与者变化时通知所有连接
+func (s *SharedSession) broadcastPresence() {
+	data, err := json.Marshal(s.Participants())
+	if err != nil {
+		return
+	}
+	msg := TerminalMessage{Op: "presence", Data: string(data)}
+	s.lock.RLock()
+	owner := s.owner
+	s.lock.RUnlock()
+	if owner != nil {
+		_ = sendMessage(owner.session, msg)
+	}
+	s.broadcast(msg)
+}
+
+// close 会话结束时断开所有参与者的连接
+func (s *SharedSession) close(status uint32, reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	for id, v := range s.viewers {
+		v.close(status, reason)
+		delete(s.viewers, id)
+	}
+}
@@ -0,0 +1,205 @@
+package terminal
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSockJS struct {
+	lock   sync.Mutex
+	recv   chan string
+	sent   []TerminalMessage
+	closed bool
+}
+
+func newFakeSockJS() *fakeSockJS {
+	return &fakeSockJS{recv: make(chan string, 10)}
+}
+
+func (f *fakeSockJS) ID() string { return "fake" }
+
+func (f *fakeSockJS) Recv() (string, error) {
+	m, ok := <-f.recv
+	if !ok {
+		return "", errors.New("closed")
+	}
+	return m, nil
+}
+
+func (f *fakeSockJS) Send(m string) error {
+	var msg TerminalMessage
+	_ = json.Unmarshal([]byte(m), &msg)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func (f *fakeSockJS) Close(status uint32, reason string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.recv)
+	}
+	return nil
+}
+
+func (f *fakeSockJS) input(op, data string) {
+	m, _ := json.Marshal(TerminalMessage{Op: op, Data: data})
+	f.recv <- string(m)
+}
+
+func (f *fakeSockJS) messages(op string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var data []string
+	for _, m := range f.sent {
+		if m.Op == op {
+			data = append(data, m.Data)
+		}
+	}
+	return data
+}
+
+func nextInput(t *testing.T, s *SharedSession) TerminalMessage {
+	result := make(chan TerminalMessage, 1)
+	go func() {
+		msg, _ := s.next()
+		result <- msg
+	}()
+	select {
+	case msg := <-result:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no input received")
+	}
+	return TerminalMessage{}
+}
+
+func eventually(t *testing.T, message string, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (f *fakeSockJS) isClosed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.closed
+}
+
+// stalledSockJS 发送一直阻塞,模拟网络卡住的连接
+type stalledSockJS struct {
+	*fakeSockJS
+	release chan struct{}
+}
+
+func (s *stalledSockJS) Send(m string) error {
+	<-s.release
+	return s.fakeSockJS.Send(m)
+}
+
+func TestSharedSession(t *testing.T) {
+	s := NewSharedSession("admin", "c1")
+	owner, watcher, driver := newFakeSockJS(), newFakeSockJS(), newFakeSockJS()
+	s.bindOwner(owner)
+
+	if _, _, err := s.Join("bob"); err == nil {
+		t.Fatal("user without invitation should not join")
+	}
+	s.Invite("bob", false)
+	s.Invite("alice", true)
+	watcherID, writable, err := s.Join("bob")
+	if err != nil || writable {
+		t.Fatalf("unexpected join result %v %v", writable, err)
+	}
+	driverID, _, _ := s.Join("alice")
+	if !s.bindViewer(watcherID, "bob", watcher) || !s.bindViewer(driverID, "", driver) || s.bindViewer(driverID, "", newFakeSockJS()) {
+		t.Fatal("each join id should be bound exactly once")
+	}
+	if participants := s.Participants(); len(participants) != 3 || !participants[0].Owner {
+		t.Fatalf("unexpected participants %+v", participants)
+	}
+
+	// 只读用户的输入被忽略,共同操作的用户的输入和所有者的输入合并
+	watcher.input("stdin", "rm -rf /\r")
+	driver.input("stdin", "ls\r")
+	if msg := nextInput(t, s); msg.Data != "ls\r" {
+		t.Errorf("unexpected input %+v", msg)
+	}
+	owner.input("stdin", "pwd\r")
+	if msg := nextInput(t, s); msg.Data != "pwd\r" {
+		t.Errorf("unexpected input %+v", msg)
+	}
+	s.broadcast(TerminalMessage{Op: "stdout", Data: "hello"})
+	eventually(t, "stdout should be sent to viewers", func() bool {
+		out := watcher.messages("stdout")
+		return len(out) == 1 && out[0] == "hello"
+	})
+
+	s.Revoke("bob")
+	if participants := s.Participants(); len(participants) != 2 || !watcher.isClosed() {
+		t.Errorf("revoked user should be disconnected, got %+v", participants)
+	}
+	if len(owner.messages("presence")) == 0 {
+		t.Error("owner should receive presence updates")
+	}
+	s.close(1, "Process exited")
+	if !driver.isClosed() {
+		t.Error("viewers should be closed with the session")
+	}
+	if _, _, err := s.Join("alice"); err == nil {
+		t.Error("closed session should not be joined")
+	}
+}
+
+func TestSharedSessionSlowViewer(t *testing.T) {
+	s := NewSharedSession("admin", "c1")
+	s.bindOwner(newFakeSockJS())
+	s.Invite("bob", false)
+	s.Invite("alice", false)
+	stalled := &stalledSockJS{fakeSockJS: newFakeSockJS(), release: make(chan struct{})}
+	defer close(stalled.release)
+	fast := newFakeSockJS()
+	stalledID, _, _ := s.Join("bob")
+	fastID, _, _ := s.Join("alice")
+	s.bindViewer(stalledID, "bob", stalled)
+	s.bindViewer(fastID, "alice", fast)
+
+	// 输出不会因为卡住的连接而阻塞,也不会阻塞邀请的管理
+	total := viewerQueueSize + 10
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < total; i++ {
+			s.broadcast(TerminalMessage{Op: "stdout", Data: "x"})
+			// 正常的连接能够跟上输出
+			for len(fast.messages("stdout")) <= i {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		s.Invite("carol", false)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a stalled viewer blocks the terminal output")
+	}
+	eventually(t, "the stalled viewer should be disconnected", stalled.isClosed)
+	if fast.isClosed() || len(fast.messages("stdout")) != total {
+		t.Error("other viewers should receive all output")
+	}
+	for _, p := range s.Participants() {
+		if p.User == "bob" {
+			t.Error("the stalled viewer should be removed from the participants")
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,7 +22,8 @@ import (
 )
 
 const END_OF_TRANSMISSION = "\u0004"
-const SessionTerminalStoreTime = 5 // session timeout (minute)
+const SessionTerminalStoreTime = 5 // default session idle timeout (minute)
+const SessionBindTimeout = 1       // wait for the client to bind the session (minute)
 
 // PtyHandler is what remotecommand expects from a pty
 type PtyHandler interface {
@@ -38,6 +40,23 @@ type TerminalSession struct {
 	SizeChan      chan remotecommand.TerminalSize
 	doneChan      chan struct{}
 	TimeOut       time.Time
+	// 不为空时记录会话的录像
+	Recorder *Recorder
+	// 不为空时审计会话中执行的命令
+	Auditor *CommandAuditor
+	// 不为空时会话可以共享给其他用户
+	Shared *SharedSession
+	// 会话的所有者和连接的容器,用于并发限制和管理员查看
+	User      string
+	Cluster   string
+	Namespace string
+	Pod       string
+	Container string
+	StartTime time.Time
+	// 空闲超时时间,为 0 时使用 SessionTerminalStoreTime
+	IdleTimeout time.Duration
+	// 会话最长持续时间,为 0 时不限制
+	MaxDuration time.Duration
 }
 
 // TerminalMessage is the messaging protocol between ShellController and TerminalSession.
@@ -49,6 +68,7 @@ type TerminalSession struct {
 // resize  fe->be     Rows, Cols     New terminal size
 // stdout  be->fe     Data           Output from the process
 // toast   be->fe     Data           OOB message to be shown to the user
+// presence be->fe    Data           Participants of a shared session (JSON)
 type TerminalMessage struct {
 	Op, Data, SessionID string
 	Rows, Cols          uint16
@@ -69,26 +89,36 @@ func (t TerminalSession) Next() *remotecommand.TerminalSize {
 // Called in a loop from remotecommand as long as the process is running
 func (t TerminalSession) Read(p []byte) (int, error) {
 	session := TerminalSessions.Get(t.Id)
+	if session.Id == "" {
+		return 0, errors.New("the session has been closed")
+	}
 	if session.TimeOut.Before(time.Now()) {
 		_ = TerminalSessions.Sessions[session.Id].sockJSSession.Close(2, "the connection has been disconnected. Please reconnect")
 		return 0, errors.New("the connection has been disconnected. Please reconnect")
 	}
 	TerminalSessions.Set(session.Id, session)
-	m, err := session.sockJSSession.Recv()
+	msg, err := session.recv()
 	if err != nil {
 		// Send terminated signal to process to avoid resource leak
 		return copy(p, END_OF_TRANSMISSION), err
 	}
 
-	var msg TerminalMessage
-	if err := json.Unmarshal([]byte(m), &msg); err != nil {
-		return copy(p, END_OF_TRANSMISSION), err
-	}
-
 	switch msg.Op {
 	case "stdin":
+		if session.Recorder != nil {
+			_ = session.Recorder.Input([]byte(msg.Data))
+		}
+		if session.Auditor != nil {
+			data, blocked := session.Auditor.Audit([]byte(msg.Data))
+			if blocked != "" {
+				return session.block(p, data, blocked)
+			}
+		}
 		return copy(p, msg.Data), nil
 	case "resize":
+		if session.Recorder != nil {
+			_ = session.Recorder.Resize(msg.Cols, msg.Rows)
+		}
 		session.SizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
 		return 0, nil
 	default:
@@ -96,44 +126,97 @@ func (t TerminalSession) Read(p []byte) (int, error) {
 	}
 }
 
+// recv 读取下一条消息,共享会话从合并后的输入中读取
+func (t TerminalSession) recv() (TerminalMessage, error) {
+	if t.Shared != nil {
+		return t.Shared.next()
+	}
+	return recvMessage(t.sockJSSession)
+}
+
+// messageSender 可以直接发送消息的连接,输出不经过 JSON 编码,避免替换非 utf8 字符
+type messageSender interface {
+	SendMessage(msg TerminalMessage) error
+}
+
+// messageReceiver 可以直接读取消息的连接
+type messageReceiver interface {
+	RecvMessage() (TerminalMessage, error)
+}
+
+func sendMessage(session sockjs.Session, msg TerminalMessage) error {
+	if sender, ok := session.(messageSender); ok {
+		return sender.SendMessage(msg)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return session.Send(string(data))
+}
+
+func recvMessage(session sockjs.Session) (TerminalMessage, error) {
+	var msg TerminalMessage
+	if receiver, ok := session.(messageReceiver); ok {
+		return receiver.RecvMessage()
+	}
+	m, err := session.Recv()
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal([]byte(m), &msg)
+	return msg, err
+}
+
+// block 命令被阻断时提示用户并关闭会话,data 为阻断前仍需发送给进程的输入
+func (t TerminalSession) block(p []byte, data []byte, command string) (int, error) {
+	if data == nil {
+		return copy(p, END_OF_TRANSMISSION), fmt.Errorf("command '%s' is not allowed", command)
+	}
+	_ = t.Toast(fmt.Sprintf("command '%s' is not allowed, the session will be closed", command))
+	_ = t.sockJSSession.Close(2, fmt.Sprintf("command '%s' is not allowed", command))
+	return copy(p, data), nil
+}
+
 // Write handles process->pty stdout
 // Called from remotecommand whenever there is any output
 func (t TerminalSession) Write(p []byte) (int, error) {
 	session := TerminalSessions.Get(t.Id)
+	if session.Id == "" {
+		return 0, errors.New("the session has been closed")
+	}
 	if session.TimeOut.Before(time.Now()) {
 		_ = TerminalSessions.Sessions[session.Id].sockJSSession.Close(2, "the connection has been disconnected. Please reconnect")
 		return 0, errors.New("the connection has been disconnected. Please reconnect")
 	}
 	TerminalSessions.Set(session.Id, session)
-	msg, err := json.Marshal(TerminalMessage{
+	stdout := TerminalMessage{
 		Op:   "stdout",
 		Data: string(p),
-	})
-	if err != nil {
-		return 0, err
 	}
-
-	if err = session.sockJSSession.Send(string(msg)); err != nil {
+	if err := sendMessage(session.sockJSSession, stdout); err != nil {
 		return 0, err
 	}
+	if session.Shared != nil {
+		session.Shared.broadcast(stdout)
+	}
+	if session.Recorder != nil {
+		_ = session.Recorder.Output(p)
+	}
 	return len(p), nil
 }
 
 // Toast can be used to send the user any OOB messages
 // hterm puts these in the center of the terminal
 func (t TerminalSession) Toast(p string) error {
-	msg, err := json.Marshal(TerminalMessage{
+	toast := TerminalMessage{
 		Op:   "toast",
 		Data: p,
-	})
-	if err != nil {
-		return err
 	}
-
-	if err = t.sockJSSession.Send(string(msg)); err != nil {
-		return err
+	if t.Shared != nil {
+		t.Shared.broadcast(toast)
 	}
-	return nil
+	return sendMessage(t.sockJSSession, toast)
 }
 
 // SessionMap stores a map of all TerminalSession objects and a lock to avoid concurrent conflict
@@ -153,7 +236,7 @@ func (sm *SessionMap) Get(sessionId string) TerminalSession {
 func (sm *SessionMap) Set(sessionId string, session TerminalSession) {
 	sm.Lock.Lock()
 	defer sm.Lock.Unlock()
-	session.TimeOut = time.Now().Add(SessionTerminalStoreTime * time.Minute)
+	session.TimeOut = time.Now().Add(session.idleTimeout())
 	sm.Sessions[sessionId] = session
 }
 
@@ -161,14 +244,19 @@ func (sm *SessionMap) Set(sessionId string, session TerminalSession) {
 // Can happen if the process exits or if there is an error starting up the process
 // For now the status code is unused and reason is shown to the user (unless "")
 func (sm *SessionMap) Close(sessionId string, status uint32, reason string) {
+	sm.Lock.Lock()
+	defer sm.Lock.Unlock()
 	if _, ok := sm.Sessions[sessionId]; !ok {
 		return
 	}
-	sm.Lock.Lock()
-	defer sm.Lock.Unlock()
-	err := sm.Sessions[sessionId].sockJSSession.Close(status, reason)
-	if err != nil && status != 1 {
-		log.Println(err)
+	if sm.Sessions[sessionId].sockJSSession != nil {
+		err := sm.Sessions[sessionId].sockJSSession.Close(status, reason)
+		if err != nil && status != 1 {
+			log.Println(err)
+		}
+	}
+	if sm.Sessions[sessionId].Shared != nil {
+		sm.Sessions[sessionId].Shared.close(status, reason)
 	}
 
 	delete(sm.Sessions, sessionId)
@@ -178,19 +266,35 @@ func (sm *SessionMap) Close(sessionId string, status uint32, reason string) {
 func (sm *SessionMap) Clean() {
 	for _, v := range sm.Sessions {
 		v.sockJSSession.Close(2, "system is logout, please retry...")
+		if v.Shared != nil {
+			v.Shared.close(2, "system is logout, please retry...")
+		}
 	}
 	sm.Sessions = make(map[string]TerminalSession)
 }
 
+// bindViewer 绑定加入共享会话的连接
+func (sm *SessionMap) bindViewer(id string, user string, session sockjs.Session) bool {
+	sm.Lock.RLock()
+	var shared *SharedSession
+	for _, s := range sm.Sessions {
+		if s.Shared != nil && s.Shared.hasViewer(id) {
+			shared = s.Shared
+			break
+		}
+	}
+	sm.Lock.RUnlock()
+	return shared != nil && shared.bindViewer(id, user, session)
+}
+
 var TerminalSessions = SessionMap{Sessions: make(map[string]TerminalSession)}
 
 // handleTerminalSession is Called by net/http for any new /api/sockjs connections
 func handleTerminalSession(session sockjs.Session) {
 	var (
-		buf             string
-		err             error
-		msg             TerminalMessage
-		terminalSession TerminalSession
+		buf string
+		err error
+		msg TerminalMessage
 	)
 
 	if buf, err = session.Recv(); err != nil {
@@ -208,14 +312,39 @@ func handleTerminalSession(session sockjs.Session) {
 		return
 	}
 
-	if terminalSession = TerminalSessions.Get(msg.SessionID); terminalSession.Id == "" {
-		log.Printf("handleTerminalSession: can't find session '%s'", msg.SessionID)
-		return
+	if err = bindSession(msg.SessionID, "", session); err != nil {
+		log.Printf("handleTerminalSession: %v", err)
 	}
+}
 
-	terminalSession.sockJSSession = session
-	TerminalSessions.Set(msg.SessionID, terminalSession)
+// bindSession 将连接绑定到会话或共享会话的参与者,user 不为空时检查会话是否属于该用户
+func bindSession(sessionId string, user string, session sockjs.Session) error {
+	TerminalSessions.Lock.Lock()
+	terminalSession, ok := TerminalSessions.Sessions[sessionId]
+	if ok {
+		if terminalSession.sockJSSession != nil {
+			TerminalSessions.Lock.Unlock()
+			return fmt.Errorf("session '%s' has been bound", sessionId)
+		}
+		if user != "" && terminalSession.User != "" && terminalSession.User != user {
+			TerminalSessions.Lock.Unlock()
+			return fmt.Errorf("session '%s' does not belong to user %s", sessionId, user)
+		}
+		terminalSession.sockJSSession = session
+		TerminalSessions.Sessions[sessionId] = terminalSession
+	}
+	TerminalSessions.Lock.Unlock()
+	if !ok {
+		if TerminalSessions.bindViewer(sessionId, user, session) {
+			return nil
+		}
+		return fmt.Errorf("can't find session '%s'", sessionId)
+	}
+	if terminalSession.Shared != nil {
+		terminalSession.Shared.bindOwner(session)
+	}
 	terminalSession.Bound <- nil
+	return nil
 }
 
 // CreateAttachHandler is called from main for /api/sockjs
@@ -279,6 +408,14 @@ func isValidShell(validShells []string, shell string) bool {
 	return false
 }
 
+// shellErrorMessage 镜像中没有 shell 时提示使用临时调试容器
+func shellErrorMessage(err error) string {
+	if strings.Contains(err.Error(), "executable file not found") || strings.Contains(err.Error(), "no such file or directory") {
+		return err.Error() + ", the image may not contain a shell, please try an ephemeral debug container"
+	}
+	return err.Error()
+}
+
 // WaitForTerminal is called from apihandler.handleAttach as a goroutine
 // Waits for the SockJS connection to be opened by the client the session to be Bound in handleTerminalSession
 func WaitForTerminal(k8sClient kubernetes.Interface, cfg *rest.Config, namespace string, podName string, containerName string, sessionId string, shell string) {
@@ -304,10 +441,27 @@ func WaitForTerminal(k8sClient kubernetes.Interface, cfg *rest.Config, namespace
 		}
 
 		if err != nil {
-			TerminalSessions.Close(sessionId, 2, err.Error())
+			TerminalSessions.Close(sessionId, 2, shellErrorMessage(err))
 			return
 		}
 
 		TerminalSessions.Close(sessionId, 1, "Process exited")
+	case <-time.After(SessionBindTimeout * time.Minute):
+		TerminalSessions.Close(sessionId, 2, "session bind timeout")
+	}
+}
+
+// WaitForCommand 和 WaitForTerminal 相同,但在容器中执行指定的命令,用于节点终端等场景
+func WaitForCommand(k8sClient kubernetes.Interface, cfg *rest.Config, namespace string, podName string, containerName string, sessionId string, cmd []string) {
+	select {
+	case <-TerminalSessions.Get(sessionId).Bound:
+		close(TerminalSessions.Get(sessionId).Bound)
+		if err := startProcess(k8sClient, cfg, cmd, namespace, podName, containerName, TerminalSessions.Get(sessionId)); err != nil {
+			TerminalSessions.Close(sessionId, 2, err.Error())
+			return
+		}
+		TerminalSessions.Close(sessionId, 1, "Process exited")
+	case <-time.After(SessionBindTimeout * time.Minute):
+		TerminalSessions.Close(sessionId, 2, "session bind timeout")
 	}
 }
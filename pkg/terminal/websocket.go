@@ -0,0 +1,113 @@
+package terminal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/KubeOperator/kubepi/pkg/wschannel"
+)
+
+// ErrSessionNotFound 会话不存在或不属于当前用户
+var ErrSessionNotFound = errors.New("terminal session not found")
+
+// webSocketSession 将按通道传输的 WebSocket 连接适配为 sockjs.Session
+// stdin、stdout 和 resize 使用 Kubernetes 的通道,toast 和 presence 以 JSON 发送到 ControlChannel
+type webSocketSession struct {
+	id   string
+	conn *wschannel.Conn
+}
+
+func (w *webSocketSession) ID() string {
+	return w.id
+}
+
+func (w *webSocketSession) Recv() (string, error) {
+	msg, err := w.RecvMessage()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(msg)
+	return string(data), err
+}
+
+func (w *webSocketSession) Send(data string) error {
+	var msg TerminalMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return w.conn.WriteFrame(wschannel.StdoutChannel, []byte(data))
+	}
+	return w.SendMessage(msg)
+}
+
+// Close status 为 1 时表示进程正常退出
+func (w *webSocketSession) Close(status uint32, reason string) error {
+	var err error
+	if status != 1 {
+		err = errors.New(reason)
+	}
+	_ = w.conn.WriteStatus(err)
+	return w.conn.Close()
+}
+
+func (w *webSocketSession) RecvMessage() (TerminalMessage, error) {
+	for {
+		channel, data, err := w.conn.ReadFrame()
+		if err != nil {
+			return TerminalMessage{}, err
+		}
+		switch channel {
+		case wschannel.StdinChannel:
+			return TerminalMessage{Op: "stdin", Data: string(data)}, nil
+		case wschannel.ResizeChannel:
+			var size struct {
+				Width  uint16
+				Height uint16
+			}
+			if err := json.Unmarshal(data, &size); err != nil {
+				continue
+			}
+			return TerminalMessage{Op: "resize", Cols: size.Width, Rows: size.Height}, nil
+		}
+	}
+}
+
+func (w *webSocketSession) SendMessage(msg TerminalMessage) error {
+	if msg.Op == "stdout" {
+		return w.conn.WriteFrame(wschannel.StdoutChannel, []byte(msg.Data))
+	}
+	return w.conn.WriteJSON(wschannel.ControlChannel, msg)
+}
+
+// canBind 检查会话或共享会话的连接 id 是否可以由 user 绑定
+func canBind(sessionId string, user string) bool {
+	TerminalSessions.Lock.RLock()
+	defer TerminalSessions.Lock.RUnlock()
+	if s, ok := TerminalSessions.Sessions[sessionId]; ok {
+		return s.sockJSSession == nil && (s.User == "" || s.User == user)
+	}
+	for _, s := range TerminalSessions.Sessions {
+		if s.Shared != nil && s.Shared.hasViewer(sessionId) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeWebSocket 使用 WebSocket 连接会话,连接关闭后返回
+// 会话不存在时不升级连接并返回 ErrSessionNotFound
+func ServeWebSocket(w http.ResponseWriter, r *http.Request, sessionId string, user string) error {
+	if !canBind(sessionId, user) {
+		return ErrSessionNotFound
+	}
+	conn, err := wschannel.Upgrade(w, r)
+	if err != nil {
+		return err
+	}
+	session := &webSocketSession{id: sessionId, conn: conn}
+	if err := bindSession(sessionId, user, session); err != nil {
+		_ = session.Close(2, err.Error())
+		return err
+	}
+	<-conn.Done()
+	return nil
+}
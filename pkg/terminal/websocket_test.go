@@ -0,0 +1,77 @@
+package terminal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KubeOperator/kubepi/pkg/wschannel"
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+func TestServeWebSocket(t *testing.T) {
+	TerminalSessions.Set("ws-test", TerminalSession{
+		Id:       "ws-test",
+		User:     "alice",
+		Bound:    make(chan error),
+		SizeChan: make(chan remotecommand.TerminalSize, 1),
+	})
+	defer TerminalSessions.Close("ws-test", 1, "Process exited")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.URL.Query().Get("user")
+		if err := ServeWebSocket(w, r, "ws-test", user); err == ErrSessionNotFound {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dialer := websocket.Dialer{Subprotocols: []string{wschannel.ProtocolV4}}
+
+	if _, resp, err := dialer.Dial(url+"?user=bob", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatal("session of other users should not be bound")
+	}
+	conn, resp, err := dialer.Dial(url+"?user=alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.Header.Get("Sec-WebSocket-Protocol") != wschannel.ProtocolV4 {
+		t.Errorf("unexpected protocol %s", resp.Header.Get("Sec-WebSocket-Protocol"))
+	}
+	select {
+	case <-TerminalSessions.Get("ws-test").Bound:
+	case <-time.After(time.Second):
+		t.Fatal("session should be bound")
+	}
+
+	session := TerminalSessions.Get("ws-test")
+	_ = conn.WriteMessage(websocket.BinaryMessage, append([]byte{wschannel.ResizeChannel}, `{"Width":120,"Height":40}`...))
+	_ = conn.WriteMessage(websocket.BinaryMessage, append([]byte{wschannel.StdinChannel}, "ls\r"...))
+	buf := make([]byte, 32)
+	if n, err := session.Read(buf); err != nil || n != 0 {
+		t.Fatalf("resize should not produce input, got %d %v", n, err)
+	}
+	if size := session.Next(); size.Width != 120 || size.Height != 40 {
+		t.Errorf("unexpected size %+v", size)
+	}
+	if n, err := session.Read(buf); err != nil || string(buf[:n]) != "ls\r" {
+		t.Errorf("unexpected stdin %q %v", buf[:n], err)
+	}
+
+	// 非 utf8 的输出原样发送
+	output := []byte{0xff, 0xfe, 'o', 'k'}
+	if _, err := session.Write(output); err != nil {
+		t.Fatal(err)
+	}
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame[0] != wschannel.StdoutChannel || !bytes.Equal(frame[1:], output) {
+		t.Errorf("unexpected stdout frame %v", frame)
+	}
+}
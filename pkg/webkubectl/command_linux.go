@@ -0,0 +1,47 @@
+// +build linux
+
+package webkubectl
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+)
+
+const sandboxUser = "nobody"
+
+// sandboxOwner 以 root 运行时,会话目录属于 nobody
+func sandboxOwner() (int, int, bool) {
+	if os.Geteuid() != 0 {
+		return 0, 0, false
+	}
+	u, err := user.Lookup(sandboxUser)
+	if err != nil {
+		return 0, 0, false
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, false
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
+
+// shellCommand 以 root 运行时在单独的 pid 和 mount namespace 中以 nobody 用户启动 bash,
+// 否则只有配置允许时才以服务进程的用户启动
+func shellCommand(s *sandbox) (string, []string, error) {
+	shell := []string{"bash", "--rcfile", s.bashrc(), "-i"}
+	if _, _, ok := sandboxOwner(); !ok {
+		if !AllowUnsandboxed {
+			return "", nil, errUnsandboxed
+		}
+		return "env", append(append([]string{"-i"}, s.env()...), shell...), nil
+	}
+	argv := []string{"--fork", "--pid", "--mount-proc", "--mount", "env", "-i"}
+	argv = append(argv, s.env()...)
+	argv = append(argv, "su", "-m", "-s", "/bin/bash", sandboxUser, "-c", "exec bash --rcfile "+shellQuote(s.bashrc())+" -i")
+	return "unshare", argv, nil
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package webkubectl
+
+func sandboxOwner() (int, int, bool) {
+	return 0, 0, false
+}
+
+func shellCommand(s *sandbox) (string, []string, error) {
+	if !AllowUnsandboxed {
+		return "", nil, errUnsandboxed
+	}
+	return "env", append(append([]string{"-i"}, s.env()...), "bash", "--rcfile", s.bashrc(), "-i"), nil
+}
@@ -0,0 +1,102 @@
+package webkubectl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// sandboxRoot 所有会话 home 目录的父目录,只允许进入不允许列出,会话目录使用随机名称
+var sandboxRoot = filepath.Join(os.TempDir(), "kubepi-webkubectl")
+
+// sandbox 每个会话单独的 home 目录,保存 kubeconfig 和 .bashrc,会话结束后删除
+type sandbox struct {
+	home string
+}
+
+func newSandbox(session Session) (*sandbox, error) {
+	if err := os.MkdirAll(sandboxRoot, 0711); err != nil {
+		return nil, err
+	}
+	s := &sandbox{home: filepath.Join(sandboxRoot, uuid.New().String())}
+	if err := os.MkdirAll(filepath.Join(s.home, ".kube"), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.kubeconfig(), session.Config, 0600); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if err := os.WriteFile(s.bashrc(), []byte(bashrc(session)), 0644); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if uid, gid, ok := sandboxOwner(); ok {
+		err := filepath.Walk(s.home, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, uid, gid)
+		})
+		if err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *sandbox) kubeconfig() string {
+	return filepath.Join(s.home, ".kube", "config")
+}
+
+func (s *sandbox) bashrc() string {
+	return filepath.Join(s.home, ".bashrc")
+}
+
+// env shell 的环境变量,不继承 KubePi 进程的环境变量
+func (s *sandbox) env() []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	}
+	return []string{
+		"HOME=" + s.home,
+		"KUBECONFIG=" + s.kubeconfig(),
+		"TMPDIR=" + s.home,
+		"PATH=" + path,
+		"TERM=xterm-256color",
+	}
+}
+
+func (s *sandbox) Close() error {
+	return os.RemoveAll(s.home)
+}
+
+// CleanSandboxes 删除上次运行遗留的会话目录
+func CleanSandboxes() error {
+	return os.RemoveAll(sandboxRoot)
+}
+
+func bashrc(session Session) string {
+	var b strings.Builder
+	b.WriteString("export TERM=xterm-256color\n")
+	b.WriteString("[ -f /usr/share/bash-completion/bash_completion ] && source /usr/share/bash-completion/bash_completion\n")
+	b.WriteString("source <(kubectl completion bash)\n")
+	b.WriteString("alias k=kubectl\n")
+	b.WriteString("complete -F __start_kubectl k\n")
+	b.WriteString("[ -f /opt/kubectl-aliases/.kubectl_aliases ] && source /opt/kubectl-aliases/.kubectl_aliases\n")
+	b.WriteString("[ -f /etc/vim/vimrc.local ] && [ ! -f ~/.vimrc ] && cp /etc/vim/vimrc.local ~/.vimrc\n")
+	b.WriteString(fmt.Sprintf("PS1=%s\n", shellQuote(fmt.Sprintf("[%s@%s]$ ", session.User, session.Cluster))))
+	if banner := os.Getenv("WELCOME_BANNER"); banner != "" {
+		b.WriteString(fmt.Sprintf("echo %s\n", shellQuote(banner)))
+	}
+	b.WriteString("echo \"Welcome to kubepi web terminal, try kubectl --help.\"\n")
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,62 @@
+package webkubectl
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+	s, err := newSandbox(Session{User: "o'neil", Cluster: "test", Config: []byte("apiVersion: v1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.kubeconfig())
+	if err != nil || string(data) != "apiVersion: v1" {
+		t.Fatalf("unexpected kubeconfig %q %v", data, err)
+	}
+	info, err := os.Stat(s.kubeconfig())
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("kubeconfig should only be readable by owner")
+	}
+	data, _ = os.ReadFile(s.bashrc())
+	if !strings.Contains(string(data), `PS1='[o'\''neil@test]$ '`) {
+		t.Errorf("unexpected bashrc %s", data)
+	}
+	for _, env := range s.env() {
+		if strings.HasPrefix(env, "KUBECONFIG=") && env != "KUBECONFIG="+s.kubeconfig() {
+			t.Errorf("unexpected env %s", env)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.home); !os.IsNotExist(err) {
+		t.Errorf("sandbox should be removed")
+	}
+}
+
+func TestShellCommandUnsandboxed(t *testing.T) {
+	if _, _, ok := sandboxOwner(); ok {
+		t.Skip("the shell is isolated when running as root")
+	}
+	s := &sandbox{}
+	if _, _, err := shellCommand(s); err == nil {
+		t.Error("the shell should not start without isolation by default")
+	}
+	AllowUnsandboxed = true
+	defer func() { AllowUnsandboxed = false }()
+	if command, _, err := shellCommand(s); err != nil || command != "env" {
+		t.Errorf("unexpected command %s %v", command, err)
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	token := Sessions.Put(Session{User: "admin", Cluster: "test"})
+	if session, ok := Sessions.Take(token); !ok || session.User != "admin" {
+		t.Fatal("session should exist")
+	}
+	if _, ok := Sessions.Take(token); ok {
+		t.Error("token should only be used once")
+	}
+}
@@ -0,0 +1,46 @@
+package webkubectl
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 会话创建后需要在该时间内连接,超时后失效
+const SessionBindTimeout = time.Minute
+
+// Session web kubectl 会话,Config 为生成的 kubeconfig
+type Session struct {
+	User    string
+	Cluster string
+	Config  []byte
+}
+
+type SessionStore struct {
+	lock     sync.Mutex
+	sessions map[string]Session
+}
+
+var Sessions = &SessionStore{sessions: map[string]Session{}}
+
+// Put 保存会话并返回连接时使用的 token
+func (s *SessionStore) Put(session Session) string {
+	token := uuid.New().String()
+	s.lock.Lock()
+	s.sessions[token] = session
+	s.lock.Unlock()
+	time.AfterFunc(SessionBindTimeout, func() {
+		s.Take(token)
+	})
+	return token
+}
+
+// Take 取出会话,每个 token 只能使用一次
+func (s *SessionStore) Take(token string) (Session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session, ok := s.sessions[token]
+	delete(s.sessions, token)
+	return session, ok
+}
@@ -0,0 +1,172 @@
+package webkubectl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+
+	"github.com/KubeOperator/webkubectl/gotty/backend/localcommand"
+	gottyServer "github.com/KubeOperator/webkubectl/gotty/server"
+	"github.com/KubeOperator/webkubectl/gotty/webtty"
+	"github.com/gorilla/websocket"
+)
+
+const windowTitle = "Webkubectl"
+
+// AllowUnsandboxed 是否允许在无法隔离时直接以服务进程的用户启动 shell
+var AllowUnsandboxed bool
+
+var errUnsandboxed = errors.New("web kubectl requires running as root to isolate the shell, set webkubectl.allowUnsandboxed to allow running without isolation")
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  webtty.MaxBufferSize,
+	WriteBufferSize: webtty.MaxBufferSize,
+	Subprotocols:    webtty.Protocols,
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(string(gottyServer.MustAsset("static/terminal.html"))))
+
+// Serve 处理 web kubectl 的页面、静态文件和 websocket 请求,name 为相对于页面的路径
+func Serve(w http.ResponseWriter, r *http.Request, name string) {
+	switch name {
+	case "":
+		var buf bytes.Buffer
+		if err := indexTemplate.Execute(&buf, map[string]interface{}{"title": windowTitle}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	case "ws":
+		serveWebSocket(w, r)
+	case "auth_token.js":
+		w.Header().Set("Content-Type", "application/javascript")
+		_, _ = w.Write([]byte("var gotty_auth_token = '';"))
+	case "config.js":
+		w.Header().Set("Content-Type", "application/javascript")
+		_, _ = w.Write([]byte("var gotty_term = 'xterm';"))
+	default:
+		data, err := gottyServer.Asset(path.Join("static", path.Clean("/"+name)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(name)))
+		_, _ = w.Write(data)
+	}
+}
+
+// wsConn 以文本帧收发 webtty 消息
+type wsConn struct {
+	*websocket.Conn
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	writer, err := c.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.Close()
+	return writer.Write(p)
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		t, reader, err := c.NextReader()
+		if err != nil {
+			return 0, err
+		}
+		if t != websocket.TextMessage {
+			continue
+		}
+		return reader.Read(p)
+	}
+}
+
+// sessionToken 从连接的第一条消息中读取页面 url 中的 token
+func sessionToken(conn *websocket.Conn) (string, error) {
+	t, data, err := conn.ReadMessage()
+	if err != nil {
+		return "", err
+	}
+	if t != websocket.TextMessage {
+		return "", errors.New("invalid init message")
+	}
+	var init gottyServer.InitMessage
+	if err := json.Unmarshal(data, &init); err != nil {
+		return "", err
+	}
+	query, err := url.ParseQuery(trimQuery(init.Arguments))
+	if err != nil {
+		return "", err
+	}
+	return query.Get("token"), nil
+}
+
+func trimQuery(arguments string) string {
+	if len(arguments) > 0 && arguments[0] == '?' {
+		return arguments[1:]
+	}
+	return arguments
+}
+
+func closeWithReason(conn *websocket.Conn, reason string) {
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
+
+func serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	token, err := sessionToken(conn)
+	if err != nil {
+		closeWithReason(conn, err.Error())
+		return
+	}
+	session, ok := Sessions.Take(token)
+	if !ok {
+		closeWithReason(conn, "the session does not exist or has expired")
+		return
+	}
+	s, err := newSandbox(session)
+	if err != nil {
+		log.Printf("create web kubectl sandbox failed: %s", err)
+		closeWithReason(conn, "create session failed")
+		return
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			log.Printf("clean web kubectl sandbox failed: %s", err)
+		}
+	}()
+	command, argv, err := shellCommand(s)
+	if err != nil {
+		log.Printf("start web kubectl shell failed: %s", err)
+		closeWithReason(conn, err.Error())
+		return
+	}
+	slave, err := localcommand.New(command, argv, localcommand.WithCloseSignal(syscall.SIGHUP))
+	if err != nil {
+		log.Printf("start web kubectl shell failed: %s", err)
+		closeWithReason(conn, "start shell failed")
+		return
+	}
+	defer slave.Close()
+	tty, err := webtty.New(&wsConn{conn}, slave, webtty.WithPermitWrite(), webtty.WithWindowTitle([]byte(windowTitle)))
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	_ = tty.Run(ctx)
+}
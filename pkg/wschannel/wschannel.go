@@ -0,0 +1,141 @@
+package wschannel
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 与 Kubernetes 的 v4.channel.k8s.io 协议相同,每个二进制帧的第一个字节为通道号
+const (
+	StdinChannel byte = iota
+	StdoutChannel
+	StderrChannel
+	// 连接结束时发送 metav1.Status
+	ErrorChannel
+	// 终端大小,内容为 {"Width":80,"Height":24}
+	ResizeChannel
+	// KubePi 扩展的通道,用于发送 toast、presence 等 JSON 消息
+	ControlChannel
+)
+
+const (
+	ProtocolV4 = "v4.channel.k8s.io"
+	Protocol   = "channel.k8s.io"
+
+	pingInterval = 30 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	Subprotocols:    []string{ProtocolV4, Protocol},
+}
+
+// Conn 按通道收发二进制帧的 WebSocket 连接,可以并发写入
+type Conn struct {
+	ws        *websocket.Conn
+	writeLock sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Upgrade 升级 http 请求并定时发送 ping 保持连接
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{ws: ws, done: make(chan struct{})}
+	go c.ping()
+	return c, nil
+}
+
+func (c *Conn) ping() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				_ = c.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ReadFrame 读取一帧,忽略文本帧和空帧
+func (c *Conn) ReadFrame() (byte, []byte, error) {
+	for {
+		t, data, err := c.ws.ReadMessage()
+		if err != nil {
+			_ = c.Close()
+			return 0, nil, err
+		}
+		if t != websocket.BinaryMessage || len(data) == 0 {
+			continue
+		}
+		return data[0], data[1:], nil
+	}
+}
+
+func (c *Conn) WriteFrame(channel byte, data []byte) error {
+	frame := make([]byte, len(data)+1)
+	frame[0] = channel
+	copy(frame[1:], data)
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	select {
+	case <-c.done:
+		return errors.New("the connection has been closed")
+	default:
+	}
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.ws.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// WriteJSON 将 v 编码为 JSON 后写入通道
+func (c *Conn) WriteJSON(channel byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(channel, data)
+}
+
+// WriteStatus 在错误通道中发送结束状态,err 为 nil 时表示成功
+func (c *Conn) WriteStatus(err error) error {
+	status := metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusSuccess}
+	if err != nil {
+		status.Status = metav1.StatusFailure
+		status.Message = err.Error()
+	}
+	return c.WriteJSON(ErrorChannel, status)
+}
+
+// Close 发送关闭帧并关闭连接
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.writeLock.Lock()
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeTimeout))
+		close(c.done)
+		c.writeLock.Unlock()
+		err = c.ws.Close()
+	})
+	return err
+}
+
+// Done 连接关闭时返回
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}